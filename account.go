@@ -0,0 +1,313 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PasswordExpire defines when the password of an account expires.
+type PasswordExpire string
+
+const (
+	PasswordExpireNow     PasswordExpire = "EXPIRE"
+	PasswordExpireDefault PasswordExpire = "EXPIRE DEFAULT"
+	PasswordExpireNever   PasswordExpire = "EXPIRE NEVER"
+)
+
+// PasswordExpireInterval returns a PasswordExpire which makes the password
+// expire each number of days.
+func PasswordExpireInterval(days int) PasswordExpire {
+	return PasswordExpire(fmt.Sprintf("EXPIRE INTERVAL %d DAY", days))
+}
+
+// AccountLock defines whether an account is locked.
+type AccountLock string
+
+const (
+	AccountLocked   AccountLock = "ACCOUNT LOCK"
+	AccountUnlocked AccountLock = "ACCOUNT UNLOCK"
+)
+
+// TLSRequirement defines which kind of encrypted connection is required by
+// an account.
+type TLSRequirement string
+
+const (
+	TLSRequireNone TLSRequirement = "NONE"
+	TLSRequireSSL  TLSRequirement = "SSL"
+	TLSRequireX509 TLSRequirement = "X509"
+)
+
+// TLSOptions holds the requirements for encrypted connections of an account.
+// When Cipher, Issuer or Subject is set, Require is ignored.
+type TLSOptions struct {
+	Require TLSRequirement
+	Cipher  string
+	Issuer  string
+	Subject string
+}
+
+// ResourceLimit is a limit on the use of server resources by an account.
+type ResourceLimit string
+
+const (
+	MaxQueriesPerHour     ResourceLimit = "MAX_QUERIES_PER_HOUR"
+	MaxUpdatesPerHour     ResourceLimit = "MAX_UPDATES_PER_HOUR"
+	MaxConnectionsPerHour ResourceLimit = "MAX_CONNECTIONS_PER_HOUR"
+	MaxUserConnections    ResourceLimit = "MAX_USER_CONNECTIONS"
+)
+
+// AccountOptions holds the options used when creating or altering an account.
+// Options left to their zero value are not part of the statement.
+type AccountOptions struct {
+	// Password is the password of the account. When empty, no password is set
+	// unless AuthPlugin is provided.
+	Password string
+	// AuthPlugin is the authentication plugin, for example "caching_sha2_password".
+	// When empty, the server's default is used.
+	AuthPlugin     string
+	PasswordExpire PasswordExpire
+	Lock           AccountLock
+	// Limits holds the resource limits; a value of 0 removes the limit.
+	Limits map[ResourceLimit]int
+	TLS    TLSOptions
+}
+
+// Account is a MySQL user account as stored in mysql.user.
+type Account struct {
+	User            string
+	Host            string
+	AuthPlugin      string
+	PasswordExpired bool
+	// PasswordLifetime is the number of days after which the password expires.
+	// It is nil when the global policy (default_password_lifetime) applies.
+	PasswordLifetime    *int
+	PasswordLastChanged *time.Time
+	Locked              bool
+	Limits              map[ResourceLimit]int
+	TLS                 TLSOptions
+}
+
+// AccountName returns the quoted account name of user and host as used in
+// account management statements, for example 'app'@'%'. When host is empty,
+// "%" is used.
+func AccountName(user, host string) string {
+	return accountName(user, host, false)
+}
+
+func accountName(user, host string, noBackslashEscapes bool) string {
+	if host == "" {
+		host = "%"
+	}
+	return quoteString(user, noBackslashEscapes) + "@" + quoteString(host, noBackslashEscapes)
+}
+
+// CreateAccount creates the account user@host using the already open connection db.
+// When host is empty, "%" is used. The opts can be nil.
+//
+// When error is returned, it is of type xmysql.Error.
+func CreateAccount(db *sql.DB, user, host string, opts *AccountOptions) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(accountStatement("CREATE USER", user, host, opts, nbe)); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// AlterAccount changes the account user@host using the already open connection db.
+// Only the options which are set are changed. When host is empty, "%" is used.
+//
+// When error is returned, it is of type xmysql.Error.
+func AlterAccount(db *sql.DB, user, host string, opts *AccountOptions) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(accountStatement("ALTER USER", user, host, opts, nbe)); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// DropAccount drops the account user@host using the already open connection db.
+// When host is empty, "%" is used.
+//
+// When error is returned, it is of type xmysql.Error.
+func DropAccount(db *sql.DB, user, host string) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DROP USER " + accountName(user, host, nbe)); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// accountStatement builds the CREATE USER or ALTER USER statement. String
+// literals are quoted for sessions using NO_BACKSLASH_ESCAPES when
+// noBackslashEscapes is true.
+func accountStatement(verb, user, host string, opts *AccountOptions, noBackslashEscapes bool) string {
+	if opts == nil {
+		opts = &AccountOptions{}
+	}
+
+	quote := func(s string) string { return quoteString(s, noBackslashEscapes) }
+
+	var b strings.Builder
+
+	b.WriteString(verb + " " + accountName(user, host, noBackslashEscapes))
+
+	switch {
+	case opts.AuthPlugin != "" && opts.Password != "":
+		b.WriteString(" IDENTIFIED WITH " + QuoteIdentifier(opts.AuthPlugin) + " BY " + quote(opts.Password))
+	case opts.AuthPlugin != "":
+		b.WriteString(" IDENTIFIED WITH " + QuoteIdentifier(opts.AuthPlugin))
+	case opts.Password != "":
+		b.WriteString(" IDENTIFIED BY " + quote(opts.Password))
+	}
+
+	switch {
+	case opts.TLS.Cipher != "" || opts.TLS.Issuer != "" || opts.TLS.Subject != "":
+		var req []string
+		if opts.TLS.Cipher != "" {
+			req = append(req, "CIPHER "+quote(opts.TLS.Cipher))
+		}
+		if opts.TLS.Issuer != "" {
+			req = append(req, "ISSUER "+quote(opts.TLS.Issuer))
+		}
+		if opts.TLS.Subject != "" {
+			req = append(req, "SUBJECT "+quote(opts.TLS.Subject))
+		}
+		b.WriteString(" REQUIRE " + strings.Join(req, " AND "))
+	case opts.TLS.Require != "":
+		b.WriteString(" REQUIRE " + string(opts.TLS.Require))
+	}
+
+	if len(opts.Limits) > 0 {
+		limits := make([]string, 0, len(opts.Limits))
+		for l, v := range opts.Limits {
+			limits = append(limits, fmt.Sprintf("%s %d", l, v))
+		}
+		sort.Strings(limits)
+		b.WriteString(" WITH " + strings.Join(limits, " "))
+	}
+
+	if opts.PasswordExpire != "" {
+		b.WriteString(" PASSWORD " + string(opts.PasswordExpire))
+	}
+
+	if opts.Lock != "" {
+		b.WriteString(" " + string(opts.Lock))
+	}
+
+	return b.String()
+}
+
+// Accounts retrieves the accounts stored in mysql.user using the userLike string,
+// if not empty, to filter on the user name. The accounts are ordered by user
+// and host.
+//
+// When error is returned, it is of type xmysql.Error.
+func Accounts(db *sql.DB, userLike string) ([]*Account, error) {
+	q := "SELECT User, Host, plugin, password_expired, password_lifetime, password_last_changed, " +
+		"account_locked, max_questions, max_updates, max_connections, max_user_connections, " +
+		"ssl_type, ssl_cipher, x509_issuer, x509_subject FROM mysql.user"
+
+	var values []any
+	if userLike != "" {
+		q += " WHERE User LIKE ?"
+		values = append(values, userLike)
+	}
+
+	q += " ORDER BY User, Host"
+
+	rows, err := db.Query(q, values...)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var accounts []*Account
+	for rows.Next() {
+		a := &Account{}
+		var expired, locked, sslType string
+		var lifetime sql.NullInt64
+		var lastChanged sql.NullString
+		var maxQuestions, maxUpdates, maxConnections, maxUserConnections int
+		var cipher, issuer, subject []byte
+
+		if err := rows.Scan(&a.User, &a.Host, &a.AuthPlugin, &expired, &lifetime, &lastChanged,
+			&locked, &maxQuestions, &maxUpdates, &maxConnections, &maxUserConnections,
+			&sslType, &cipher, &issuer, &subject); err != nil {
+			return nil, NewError(err)
+		}
+
+		a.PasswordExpired = expired == "Y"
+		a.Locked = locked == "Y"
+		if lifetime.Valid {
+			n := int(lifetime.Int64)
+			a.PasswordLifetime = &n
+		}
+		if lastChanged.Valid {
+			t, err := parseDatetime(lastChanged.String)
+			if err != nil {
+				return nil, NewError(err)
+			}
+			a.PasswordLastChanged = &t
+		}
+
+		a.Limits = map[ResourceLimit]int{
+			MaxQueriesPerHour:     maxQuestions,
+			MaxUpdatesPerHour:     maxUpdates,
+			MaxConnectionsPerHour: maxConnections,
+			MaxUserConnections:    maxUserConnections,
+		}
+
+		switch sslType {
+		case "ANY":
+			a.TLS.Require = TLSRequireSSL
+		case "X509":
+			a.TLS.Require = TLSRequireX509
+		case "SPECIFIED":
+			a.TLS.Cipher = string(cipher)
+			a.TLS.Issuer = string(issuer)
+			a.TLS.Subject = string(subject)
+		default:
+			a.TLS.Require = TLSRequireNone
+		}
+
+		accounts = append(accounts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return accounts, nil
+}
+
+// parseDatetime parses a DATETIME or TIMESTAMP value as retrieved as string.
+// When the DSN has parseTime set, the driver returns time.Time which
+// database/sql formats using RFC 3339 when scanned into a string.
+func parseDatetime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02 15:04:05.999999", s)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestAccountStatement(t *testing.T) {
+	var cases = map[string]struct {
+		opts *AccountOptions
+		nbe  bool
+		exp  string
+	}{
+		"no options": {
+			exp: "CREATE USER 'app'@'%'",
+		},
+		"password and plugin": {
+			opts: &AccountOptions{Password: "s3cr'et", AuthPlugin: "caching_sha2_password"},
+			exp:  "CREATE USER 'app'@'%' IDENTIFIED WITH `caching_sha2_password` BY 's3cr''et'",
+		},
+		"TLS requirement": {
+			opts: &AccountOptions{TLS: TLSOptions{Require: TLSRequireX509}},
+			exp:  "CREATE USER 'app'@'%' REQUIRE X509",
+		},
+		"TLS specified": {
+			opts: &AccountOptions{TLS: TLSOptions{Require: TLSRequireSSL, Cipher: "EDH-RSA-DES-CBC3-SHA", Subject: "/CN=app"}},
+			exp:  "CREATE USER 'app'@'%' REQUIRE CIPHER 'EDH-RSA-DES-CBC3-SHA' AND SUBJECT '/CN=app'",
+		},
+		"no backslash escapes": {
+			opts: &AccountOptions{Password: `back\slash'quote`},
+			nbe:  true,
+			exp:  `CREATE USER 'app'@'%' IDENTIFIED BY 'back\slash''quote'`,
+		},
+		"everything": {
+			opts: &AccountOptions{
+				Password: "pwd",
+				Limits: map[ResourceLimit]int{
+					MaxUserConnections: 10,
+					MaxQueriesPerHour:  0,
+				},
+				PasswordExpire: PasswordExpireInterval(90),
+				Lock:           AccountLocked,
+			},
+			exp: "CREATE USER 'app'@'%' IDENTIFIED BY 'pwd' " +
+				"WITH MAX_QUERIES_PER_HOUR 0 MAX_USER_CONNECTIONS 10 " +
+				"PASSWORD EXPIRE INTERVAL 90 DAY ACCOUNT LOCK",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			xt.Eq(t, c.exp, accountStatement("CREATE USER", "app", "", c.opts, c.nbe))
+		})
+	}
+}
+
+func TestCreateAccount(t *testing.T) {
+	user := "xmysql_test_account"
+	_ = DropAccount(testDB, user, "localhost")
+	defer func() { _ = DropAccount(testDB, user, "localhost") }()
+
+	t.Run("create", func(t *testing.T) {
+		xt.OK(t, CreateAccount(testDB, user, "localhost", &AccountOptions{
+			Password:       "xmysql",
+			AuthPlugin:     "caching_sha2_password",
+			PasswordExpire: PasswordExpireNever,
+			Limits:         map[ResourceLimit]int{MaxUserConnections: 5},
+			TLS:            TLSOptions{Require: TLSRequireSSL},
+		}))
+
+		accounts, err := Accounts(testDB, user)
+		xt.OK(t, err)
+		xt.Eq(t, 1, len(accounts))
+
+		a := accounts[0]
+		xt.Eq(t, user, a.User)
+		xt.Eq(t, "localhost", a.Host)
+		xt.Eq(t, "caching_sha2_password", a.AuthPlugin)
+		xt.Eq(t, 5, a.Limits[MaxUserConnections])
+		xt.Eq(t, TLSRequireSSL, a.TLS.Require)
+		xt.Assert(t, a.PasswordLifetime != nil && *a.PasswordLifetime == 0)
+		xt.Assert(t, !a.Locked)
+		xt.Assert(t, a.PasswordLastChanged != nil)
+	})
+
+	t.Run("without parseTime", func(t *testing.T) {
+		cfg, err := mysql.ParseDSN(testDSN)
+		xt.OK(t, err)
+		cfg.ParseTime = false
+
+		db, err := sql.Open("mysql", cfg.FormatDSN())
+		xt.OK(t, err)
+		defer func() { _ = db.Close() }()
+
+		accounts, err := Accounts(db, user)
+		xt.OK(t, err)
+		xt.Eq(t, 1, len(accounts))
+		xt.Assert(t, accounts[0].PasswordLastChanged != nil)
+		xt.Assert(t, time.Since(*accounts[0].PasswordLastChanged) < 24*time.Hour)
+	})
+
+	t.Run("create existing", func(t *testing.T) {
+		err := CreateAccount(testDB, user, "localhost", nil)
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, ErrCannotUser))
+	})
+
+	t.Run("alter", func(t *testing.T) {
+		xt.OK(t, AlterAccount(testDB, user, "localhost", &AccountOptions{
+			Lock:   AccountLocked,
+			Limits: map[ResourceLimit]int{MaxUserConnections: 0},
+		}))
+
+		accounts, err := Accounts(testDB, user)
+		xt.OK(t, err)
+		xt.Eq(t, 1, len(accounts))
+		xt.Assert(t, accounts[0].Locked)
+		xt.Eq(t, 0, accounts[0].Limits[MaxUserConnections])
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		xt.OK(t, DropAccount(testDB, user, "localhost"))
+
+		accounts, err := Accounts(testDB, user)
+		xt.OK(t, err)
+		xt.Eq(t, 0, len(accounts))
+
+		err = DropAccount(testDB, user, "localhost")
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, ErrCannotUser))
+	})
+}
+
+func TestCreateAccount_noBackslashEscapes(t *testing.T) {
+	db := testDBNoBackslashEscapes(t)
+	user := `xmysql_test\account`
+
+	exists := func() bool {
+		var n int
+		xt.OK(t, testDB.QueryRow("SELECT COUNT(*) FROM mysql.user WHERE User = ? AND Host = ?",
+			user, "localhost").Scan(&n))
+		return n == 1
+	}
+
+	_ = DropAccount(db, user, "localhost")
+	defer func() { _ = DropAccount(db, user, "localhost") }()
+
+	xt.OK(t, CreateAccount(db, user, "localhost", nil))
+	xt.Assert(t, exists())
+
+	xt.OK(t, DropAccount(db, user, "localhost"))
+	xt.Assert(t, !exists())
+}
+
+func TestParseDatetime(t *testing.T) {
+	exp := time.Date(2023, 11, 14, 22, 13, 20, 500000000, time.UTC)
+
+	for _, s := range []string{"2023-11-14 22:13:20.5", "2023-11-14T22:13:20.5Z"} {
+		have, err := parseDatetime(s)
+		xt.OK(t, err)
+		xt.Eq(t, exp, have)
+	}
+
+	_, err := parseDatetime("yesterday")
+	xt.KO(t, err)
+}
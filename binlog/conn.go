@@ -0,0 +1,510 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Capability flags of the client/server protocol.
+const (
+	clientLongPassword     = 0x00000001
+	clientLongFlag         = 0x00000004
+	clientProtocol41       = 0x00000200
+	clientSSL              = 0x00000800
+	clientTransactions     = 0x00002000
+	clientSecureConnection = 0x00008000
+	clientPluginAuth       = 0x00080000
+	clientPluginAuthLenenc = 0x00200000
+)
+
+// Commands of the client/server protocol.
+const (
+	comQuery          = 0x03
+	comRegisterSlave  = 0x15
+	comBinlogDumpGTID = 0x1e
+)
+
+// Flags of COM_BINLOG_DUMP_GTID.
+const (
+	dumpThroughGTID = 0x0004
+)
+
+const (
+	maxPacketSize  = 1<<24 - 1
+	charsetUTF8MB4 = 45
+)
+
+// conn is a connection using the MySQL client/server protocol, implementing
+// only what is needed to request the binary log from a server.
+type conn struct {
+	netConn net.Conn
+	seq     byte
+}
+
+// dial connects and authenticates using cfg. TLS is used when cfg.TLS is set;
+// when the server does not support TLS, the connection fails unless
+// cfg.AllowFallbackToPlaintext is set (as done by tls=preferred).
+func dial(ctx context.Context, cfg *mysql.Config) (*conn, error) {
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, cfg.Net, cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{netConn: netConn}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = netConn.SetDeadline(deadline)
+	}
+
+	if err := c.handshake(cfg); err != nil {
+		_ = c.netConn.Close()
+		return nil, err
+	}
+
+	_ = c.netConn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (c *conn) Close() error {
+	return c.netConn.Close()
+}
+
+// readPacket reads a packet, joining packets split because of their size.
+func (c *conn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(c.netConn, header); err != nil {
+			return nil, err
+		}
+
+		size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+		if header[3] != c.seq {
+			return nil, fmt.Errorf("binlog: packet out of order (got %d, expected %d)", header[3], c.seq)
+		}
+		c.seq++
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(c.netConn, data); err != nil {
+			return nil, err
+		}
+		payload = append(payload, data...)
+
+		if size < maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+// writePacket writes data, splitting it when it exceeds the maximum packet
+// size.
+func (c *conn) writePacket(data []byte) error {
+	for {
+		size := len(data)
+		if size > maxPacketSize {
+			size = maxPacketSize
+		}
+
+		packet := make([]byte, 4, 4+size)
+		packet[0], packet[1], packet[2], packet[3] = byte(size), byte(size>>8), byte(size>>16), c.seq
+		packet = append(packet, data[:size]...)
+		if _, err := c.netConn.Write(packet); err != nil {
+			return err
+		}
+		c.seq++
+
+		data = data[size:]
+		if size < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+// writeCommand writes the command packet, which starts a new sequence.
+func (c *conn) writeCommand(command byte, data []byte) error {
+	c.seq = 0
+	return c.writePacket(append([]byte{command}, data...))
+}
+
+// readResult reads the OK packet concluding a command or authentication.
+func (c *conn) readResult() error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(data) > 0 && data[0] == 0x00:
+		return nil
+	case len(data) > 0 && data[0] == 0xff:
+		return parseErrPacket(data)
+	default:
+		return fmt.Errorf("binlog: unexpected packet 0x%02x", data[0])
+	}
+}
+
+// exec executes a statement which does not return rows.
+func (c *conn) exec(query string) error {
+	if err := c.writeCommand(comQuery, []byte(query)); err != nil {
+		return err
+	}
+	return c.readResult()
+}
+
+// parseErrPacket returns the error stored in an ERR packet as the error type
+// used by the go-sql-driver/mysql driver, so it is handled by xmysql.Error.
+func parseErrPacket(data []byte) error {
+	if len(data) < 3 {
+		return errors.New("binlog: malformed error packet")
+	}
+
+	e := &mysql.MySQLError{Number: binary.LittleEndian.Uint16(data[1:3])}
+	msg := data[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		copy(e.SQLState[:], msg[1:6])
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+
+	return e
+}
+
+func (c *conn) handshake(cfg *mysql.Config) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[0] == 0xff {
+		return parseErrPacket(data)
+	}
+
+	cur := &cursor{data: data}
+	if v := cur.uint8(); v != 10 {
+		return fmt.Errorf("binlog: unsupported protocol version %d", v)
+	}
+	cur.bytes(bytes.IndexByte(data[1:], 0) + 1) // server version
+	cur.skip(4)                                 // connection ID
+	scramble := append([]byte{}, cur.bytes(8)...)
+	cur.skip(1)
+	capabilities := uint32(cur.uint16())
+	cur.skip(3) // character set, status
+	capabilities |= uint32(cur.uint16()) << 16
+	scrambleLen := int(cur.uint8())
+	cur.skip(10)
+	if n := scrambleLen - 8; n > 0 {
+		// the second part is terminated by NUL, which is not part of it
+		if b := cur.bytes(max(13, n)); len(b) > 0 {
+			scramble = append(scramble, b[:len(b)-1]...)
+		}
+	}
+	plugin := "mysql_native_password"
+	if capabilities&clientPluginAuth != 0 && cur.remaining() > 0 {
+		plugin = nullTerminated(cur.rest())
+	}
+	if cur.err != nil {
+		return fmt.Errorf("binlog: malformed handshake: %w", cur.err)
+	}
+
+	flags := uint32(clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions |
+		clientSecureConnection | clientPluginAuth | clientPluginAuthLenenc)
+
+	secure := false
+	if cfg.TLS != nil && capabilities&clientSSL == 0 && !cfg.AllowFallbackToPlaintext {
+		return errors.New("binlog: server does not support TLS")
+	}
+	if cfg.TLS != nil && capabilities&clientSSL != 0 {
+		flags |= clientSSL
+		if err := c.writePacket(handshakeResponseHeader(flags)); err != nil {
+			return err
+		}
+		tlsConn := tls.Client(c.netConn, cfg.TLS)
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		c.netConn = tlsConn
+		secure = true
+	}
+
+	authResp, err := authResponse(cfg, plugin, scramble, secure)
+	if err != nil {
+		// the plugin of the account is not known yet; the server asks to
+		// switch when it is not the one used
+		plugin = "caching_sha2_password"
+		if authResp, err = authResponse(cfg, plugin, scramble, secure); err != nil {
+			return err
+		}
+	}
+
+	resp := handshakeResponseHeader(flags)
+	resp = append(append(resp, cfg.User...), 0)
+	resp = append(appendPacked(resp, uint64(len(authResp))), authResp...)
+	resp = append(append(resp, plugin...), 0)
+	if err := c.writePacket(resp); err != nil {
+		return err
+	}
+
+	return c.authenticate(cfg, plugin, scramble, secure)
+}
+
+func handshakeResponseHeader(flags uint32) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, flags)
+	b = binary.LittleEndian.AppendUint32(b, maxPacketSize)
+	b = append(b, charsetUTF8MB4)
+	return append(b, make([]byte, 23)...)
+}
+
+// authenticate handles the packets sent by the server after the handshake
+// response, until authentication succeeded or failed.
+func (c *conn) authenticate(cfg *mysql.Config, plugin string, scramble []byte, secure bool) error {
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return errors.New("binlog: empty packet during authentication")
+		}
+
+		switch data[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return parseErrPacket(data)
+		case 0xfe:
+			// authentication switch request
+			rest := data[1:]
+			i := bytes.IndexByte(rest, 0)
+			if i < 0 {
+				return errors.New("binlog: malformed authentication switch request")
+			}
+			plugin = string(rest[:i])
+			scramble = bytes.TrimSuffix(rest[i+1:], []byte{0})
+
+			resp, err := authResponse(cfg, plugin, scramble, secure)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(resp); err != nil {
+				return err
+			}
+		case 0x01:
+			// more data for caching_sha2_password
+			if plugin != "caching_sha2_password" || len(data) < 2 {
+				return fmt.Errorf("binlog: unexpected authentication data for %s", plugin)
+			}
+			switch data[1] {
+			case 3: // fast authentication succeeded; OK packet follows
+			case 4: // full authentication
+				if err := c.fullAuthentication(cfg.Passwd, scramble, secure); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("binlog: unexpected caching_sha2_password state %d", data[1])
+			}
+		default:
+			return fmt.Errorf("binlog: unexpected packet 0x%02x during authentication", data[0])
+		}
+	}
+}
+
+// fullAuthentication sends the password in clear text over a TLS connection,
+// or encrypted using the public key of the server otherwise.
+func (c *conn) fullAuthentication(password string, scramble []byte, secure bool) error {
+	plain := append([]byte(password), 0)
+	if secure {
+		return c.writePacket(plain)
+	}
+
+	if err := c.writePacket([]byte{2}); err != nil {
+		return err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || data[0] != 0x01 {
+		return errors.New("binlog: server did not send its public key")
+	}
+
+	block, _ := pem.Decode(data[1:])
+	if block == nil {
+		return errors.New("binlog: invalid public key of server")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("binlog: public key of server: %w", err)
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("binlog: public key of server is not an RSA key")
+	}
+
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, plain, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.writePacket(encrypted)
+}
+
+// authResponse returns the response to the scramble sent by the server for
+// the authentication plugin. As with the go-sql-driver/mysql driver, the
+// mysql_native_password plugin is only used when cfg.AllowNativePasswords is
+// set, and mysql_clear_password only when cfg.AllowCleartextPasswords is set.
+// Since the latter sends the password as is, it also requires the connection
+// to be secure, that is, using TLS.
+func authResponse(cfg *mysql.Config, plugin string, scramble []byte, secure bool) ([]byte, error) {
+	switch plugin {
+	case "mysql_native_password":
+		if !cfg.AllowNativePasswords {
+			return nil, mysql.ErrNativePassword
+		}
+	case "mysql_clear_password":
+		if !cfg.AllowCleartextPasswords {
+			return nil, mysql.ErrCleartextPassword
+		}
+		if !secure {
+			return nil, errors.New("binlog: mysql_clear_password requires TLS")
+		}
+	case "caching_sha2_password":
+	default:
+		return nil, fmt.Errorf("binlog: unsupported authentication plugin %s", plugin)
+	}
+
+	password := cfg.Passwd
+	if password == "" {
+		return []byte{}, nil
+	}
+
+	switch plugin {
+	case "mysql_native_password":
+		return scrambleNativePassword(scramble, password), nil
+	case "mysql_clear_password":
+		return append([]byte(password), 0), nil
+	default:
+		return scrambleSHA256Password(scramble, password), nil
+	}
+}
+
+// scrambleNativePassword computes SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password))).
+func scrambleNativePassword(scramble []byte, password string) []byte {
+	if len(scramble) > 20 {
+		scramble = scramble[:20]
+	}
+
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+
+	h := sha1.New()
+	h.Write(scramble)
+	h.Write(stage2[:])
+	result := h.Sum(nil)
+
+	for i := range result {
+		result[i] ^= stage1[i]
+	}
+	return result
+}
+
+// scrambleSHA256Password computes SHA256(password) XOR
+// SHA256(SHA256(SHA256(password)) + scramble).
+func scrambleSHA256Password(scramble []byte, password string) []byte {
+	stage1 := sha256.Sum256([]byte(password))
+	stage2 := sha256.Sum256(stage1[:])
+
+	h := sha256.New()
+	h.Write(stage2[:])
+	h.Write(scramble)
+	result := h.Sum(nil)
+
+	for i := range result {
+		result[i] ^= stage1[i]
+	}
+	return result
+}
+
+// appendPacked appends v as length-encoded integer.
+func appendPacked(b []byte, v uint64) []byte {
+	switch {
+	case v < 251:
+		return append(b, byte(v))
+	case v < 1<<16:
+		return append(b, 0xfc, byte(v), byte(v>>8))
+	case v < 1<<24:
+		return append(b, 0xfd, byte(v), byte(v>>8), byte(v>>16))
+	default:
+		return binary.LittleEndian.AppendUint64(append(b, 0xfe), v)
+	}
+}
+
+// registerReplica registers the connection as replica using
+// COM_REGISTER_SLAVE so it is listed by SHOW REPLICAS.
+func (c *conn) registerReplica(serverID uint32, hostname string) error {
+	data := binary.LittleEndian.AppendUint32(nil, serverID)
+	for _, s := range []string{hostname, "", ""} { // host, user, password
+		data = append(append(data, byte(len(s))), s...)
+	}
+	data = binary.LittleEndian.AppendUint16(data, 0) // port
+	data = binary.LittleEndian.AppendUint32(data, 0) // replication rank
+	data = binary.LittleEndian.AppendUint32(data, 0) // source ID
+
+	if err := c.writeCommand(comRegisterSlave, data); err != nil {
+		return err
+	}
+	return c.readResult()
+}
+
+// dumpGTID requests the binary log using COM_BINLOG_DUMP_GTID; the server
+// sends all transactions not in encoded GTID set.
+func (c *conn) dumpGTID(serverID uint32, gtids []byte) error {
+	data := binary.LittleEndian.AppendUint16(nil, dumpThroughGTID)
+	data = binary.LittleEndian.AppendUint32(data, serverID)
+	data = binary.LittleEndian.AppendUint32(data, 0) // binary log name
+	data = binary.LittleEndian.AppendUint64(data, 4) // position
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(gtids)))
+	data = append(data, gtids...)
+
+	return c.writeCommand(comBinlogDumpGTID, data)
+}
+
+// readEvent reads the next event sent by the server after dumpGTID. It returns
+// io.EOF when the server ends the stream.
+func (c *conn) readEvent() ([]byte, error) {
+	data, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("binlog: empty packet")
+	case data[0] == 0x00:
+		return data[1:], nil
+	case data[0] == 0xff:
+		return nil, parseErrPacket(data)
+	case data[0] == 0xfe && len(data) < 9:
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("binlog: unexpected packet 0x%02x", data[0])
+	}
+}
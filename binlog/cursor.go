@@ -0,0 +1,146 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// cursor reads from the data of an event. The first read past the end of the
+// data sets err; reads that follow return zero values.
+type cursor struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (c *cursor) remaining() int {
+	return len(c.data) - c.pos
+}
+
+func (c *cursor) bytes(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if n < 0 || n > c.remaining() {
+		c.err = fmt.Errorf("binlog: need %d bytes at offset %d, have %d", n, c.pos, c.remaining())
+		return nil
+	}
+	b := c.data[c.pos : c.pos+n]
+	c.pos += n
+	return b
+}
+
+func (c *cursor) rest() []byte {
+	return c.bytes(c.remaining())
+}
+
+func (c *cursor) skip(n int) {
+	c.bytes(n)
+}
+
+func (c *cursor) uint8() byte {
+	if b := c.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (c *cursor) uint16() uint16 {
+	if b := c.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (c *cursor) uint32() uint32 {
+	if b := c.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (c *cursor) uint64() uint64 {
+	if b := c.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// uintN reads an unsigned little-endian integer stored using n bytes.
+func (c *cursor) uintN(n int) uint64 {
+	return littleEndian(c.bytes(n))
+}
+
+// packed reads a length-encoded integer as used by the client/server
+// protocol (called net_field_length in the MySQL sources).
+func (c *cursor) packed() uint64 {
+	switch b := c.uint8(); b {
+	case 0xfc:
+		return c.uintN(2)
+	case 0xfd:
+		return c.uintN(3)
+	case 0xfe:
+		return c.uint64()
+	default:
+		return uint64(b)
+	}
+}
+
+// packedString reads a string prefixed with its length as packed integer.
+func (c *cursor) packedString() string {
+	return string(c.bytes(int(c.packed())))
+}
+
+// varlen reads an unsigned integer as stored by the serialization format of
+// MySQL 8.3 and later. The number of bytes used is one more than the number
+// of trailing one bits of the first byte; the value follows these bits. When
+// all bits of the first byte are set, the value is stored in the 8 bytes
+// that follow.
+func (c *cursor) varlen() uint64 {
+	if c.err == nil && c.remaining() == 0 {
+		c.bytes(1)
+	}
+	if c.err != nil {
+		return 0
+	}
+
+	n := bits.TrailingZeros8(^c.data[c.pos]) + 1
+	b := c.bytes(n)
+	switch {
+	case b == nil:
+		return 0
+	case n == 9:
+		return littleEndian(b[1:])
+	default:
+		return littleEndian(b) >> n
+	}
+}
+
+// varlenSigned reads a signed integer as stored by the serialization format
+// of MySQL 8.3 and later: the lowest bit of the unsigned value is the sign.
+func (c *cursor) varlenSigned() int64 {
+	v := c.varlen()
+	if v&1 == 1 {
+		return -int64(v>>1) - 1
+	}
+	return int64(v >> 1)
+}
+
+func littleEndian(b []byte) uint64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
@@ -0,0 +1,615 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderSize is the size of the header of each event (binary log version 4).
+const HeaderSize = 19
+
+// Checksum algorithms as stored in the format description event.
+const (
+	ChecksumNone  byte = 0
+	ChecksumCRC32 byte = 1
+	// checksumUndefined is used by servers which do not know about checksums.
+	checksumUndefined byte = 0xff
+)
+
+// ErrChecksum is returned when the checksum of an event does not match.
+var ErrChecksum = errors.New("binlog: checksum mismatch")
+
+// Decoder decodes events from their raw bytes. It keeps the state needed to
+// decode subsequent events: the format description and the table maps.
+// Events must therefore be passed in the order they were logged.
+type Decoder struct {
+	format   *FormatDescriptionEvent
+	checksum byte
+	tables   map[uint64]*TableMapEvent
+}
+
+// NewDecoder returns a new Decoder. The checksum algorithm of the events is
+// learned from the format description event. Until then, events are assumed
+// to have no checksum.
+func NewDecoder() *Decoder {
+	return &Decoder{
+		tables: map[uint64]*TableMapEvent{},
+	}
+}
+
+// SetChecksum sets the checksum algorithm of the events that follow. This
+// is needed, for example, when events preceding the format description event
+// carry a checksum, as with the rotate event sent by a source server.
+func (d *Decoder) SetChecksum(algorithm byte) {
+	d.checksum = algorithm
+}
+
+// Format returns the last format description event decoded, or nil.
+func (d *Decoder) Format() *FormatDescriptionEvent {
+	return d.format
+}
+
+// Decode decodes the event stored in data, which includes the header and,
+// when used, the checksum.
+func (d *Decoder) Decode(data []byte) (Event, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("binlog: event of %d bytes is too short", len(data))
+	}
+
+	header := decodeHeader(data)
+	if int(header.EventSize) != len(data) {
+		return nil, fmt.Errorf("binlog: event size %d does not match data of %d bytes",
+			header.EventSize, len(data))
+	}
+
+	checksum := d.checksum
+	hasChecksum := checksum == ChecksumCRC32
+	if header.Type == EventFormatDescription {
+		checksum, hasChecksum = formatChecksum(data)
+	}
+
+	body := data[HeaderSize:]
+	if hasChecksum {
+		if len(body) < 4 {
+			return nil, fmt.Errorf("binlog: %s event too short for checksum", header.Type)
+		}
+		n := len(data) - 4
+		if checksum == ChecksumCRC32 && crc32.ChecksumIEEE(data[:n]) != binary.LittleEndian.Uint32(data[n:]) {
+			return nil, fmt.Errorf("%w (%s event at position %d)", ErrChecksum, header.Type, header.LogPos)
+		}
+		body = body[:len(body)-4]
+	}
+
+	event, err := d.decodeBody(header, body)
+	if err != nil {
+		return nil, fmt.Errorf("binlog: decoding %s event: %w", header.Type, err)
+	}
+
+	return event, nil
+}
+
+func decodeHeader(data []byte) EventHeader {
+	return EventHeader{
+		Timestamp: time.Unix(int64(binary.LittleEndian.Uint32(data[0:])), 0).UTC(),
+		Type:      EventType(data[4]),
+		ServerID:  binary.LittleEndian.Uint32(data[5:]),
+		EventSize: binary.LittleEndian.Uint32(data[9:]),
+		LogPos:    binary.LittleEndian.Uint32(data[13:]),
+		Flags:     binary.LittleEndian.Uint16(data[17:]),
+	}
+}
+
+func (d *Decoder) decodeBody(header EventHeader, body []byte) (Event, error) {
+	c := &cursor{data: body}
+
+	var event Event
+	switch header.Type {
+	case EventFormatDescription:
+		e := d.decodeFormatDescription(header, c)
+		d.format = e
+		d.checksum = e.ChecksumAlgorithm
+		if d.checksum == checksumUndefined {
+			d.checksum = ChecksumNone
+		}
+		d.tables = map[uint64]*TableMapEvent{}
+		event = e
+	case EventRotate:
+		e := &RotateEvent{Header: header}
+		if d.postHeaderLength(header.Type, 8) == 8 {
+			e.Position = c.uint64()
+		}
+		e.NextFile = string(c.rest())
+		event = e
+	case EventQuery:
+		event = d.decodeQuery(header, c)
+	case EventXID:
+		event = &XIDEvent{Header: header, XID: c.uint64()}
+	case EventGTID, EventAnonymousGTID:
+		event = decodeGTID(header, c)
+	case EventGTIDTagged:
+		event = decodeGTIDTagged(header, c)
+	case EventTableMap:
+		e, err := d.decodeTableMap(header, c)
+		if err != nil {
+			return nil, err
+		}
+		d.tables[e.TableID] = e
+		event = e
+	case EventWriteRows, EventUpdateRows, EventDeleteRows,
+		EventWriteRowsV1, EventUpdateRowsV1, EventDeleteRowsV1:
+		e, err := d.decodeRows(header, c)
+		if err != nil {
+			return nil, err
+		}
+		event = e
+	default:
+		event = &GenericEvent{Header: header, Data: append([]byte{}, body...)}
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return event, nil
+}
+
+func (d *Decoder) postHeaderLength(t EventType, def int) int {
+	if d.format == nil {
+		return def
+	}
+	return d.format.postHeaderLength(t, def)
+}
+
+// formatChecksum returns the checksum algorithm stored in the format
+// description event data, and whether the event ends with a checksum. When
+// the server supports checksums, the event always ends with the algorithm
+// and 4 bytes for the checksum, even when the algorithm is none.
+func formatChecksum(data []byte) (byte, bool) {
+	const versionOffset = HeaderSize + 2
+	if len(data) < versionOffset+50+5 || !versionHasChecksum(nullTerminated(data[versionOffset:versionOffset+50])) {
+		return ChecksumNone, false
+	}
+	return data[len(data)-5], true
+}
+
+// versionHasChecksum returns whether a server with given version stores
+// the checksum algorithm in the format description event, which is so as of
+// MySQL 5.6.1 and MariaDB 5.3.
+func versionHasChecksum(version string) bool {
+	var parts [3]int
+	for i, p := range strings.SplitN(strings.SplitN(version, "-", 2)[0], ".", 3) {
+		parts[i], _ = strconv.Atoi(p)
+	}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return parts[0] > 5 || (parts[0] == 5 && parts[1] >= 3)
+	}
+	return parts[0] > 5 || (parts[0] == 5 && (parts[1] > 6 || (parts[1] == 6 && parts[2] >= 1)))
+}
+
+func nullTerminated(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
+
+func (d *Decoder) decodeFormatDescription(header EventHeader, c *cursor) *FormatDescriptionEvent {
+	e := &FormatDescriptionEvent{
+		Header:            header,
+		BinlogVersion:     c.uint16(),
+		ServerVersion:     nullTerminated(c.bytes(50)),
+		CreateTimestamp:   time.Unix(int64(c.uint32()), 0).UTC(),
+		HeaderLength:      c.uint8(),
+		ChecksumAlgorithm: ChecksumNone,
+	}
+
+	lengths := c.rest()
+	if versionHasChecksum(e.ServerVersion) && len(lengths) > 0 {
+		// the body is followed by the algorithm; the checksum was removed
+		e.ChecksumAlgorithm = lengths[len(lengths)-1]
+		lengths = lengths[:len(lengths)-1]
+	}
+	e.PostHeaderLengths = append([]byte{}, lengths...)
+
+	return e
+}
+
+func (d *Decoder) decodeQuery(header EventHeader, c *cursor) *QueryEvent {
+	e := &QueryEvent{
+		Header:        header,
+		ThreadID:      c.uint32(),
+		ExecutionTime: time.Duration(c.uint32()) * time.Second,
+	}
+
+	schemaLen := int(c.uint8())
+	e.ErrorCode = c.uint16()
+	statusLen := 0
+	if n := d.postHeaderLength(header.Type, 13); n >= 13 {
+		statusLen = int(c.uint16())
+		c.skip(n - 13)
+	}
+
+	e.StatusVars = append([]byte{}, c.bytes(statusLen)...)
+	e.Schema = string(c.bytes(schemaLen))
+	c.skip(1)
+	e.Query = string(c.rest())
+
+	return e
+}
+
+func decodeGTID(header EventHeader, c *cursor) *GTIDEvent {
+	e := &GTIDEvent{
+		Header: header,
+		Flags:  c.uint8(),
+	}
+
+	uuid := c.bytes(16)
+	e.GNO = int64(c.uint64())
+	if header.Type == EventGTID && uuid != nil {
+		e.UUID = formatUUID(uuid)
+	}
+
+	// logical timestamps, available as of MySQL 5.7.6
+	if c.remaining() >= 17 && c.uint8() == 2 {
+		e.LastCommitted = int64(c.uint64())
+		e.SequenceNumber = int64(c.uint64())
+	}
+
+	// commit timestamps, available as of MySQL 8.0.1; the original commit
+	// timestamp is only stored when it differs from the immediate one
+	if c.remaining() >= 7 {
+		ts := c.uintN(7)
+		if ts&(1<<55) != 0 && c.remaining() >= 7 {
+			ts = c.uintN(7)
+		}
+		ts &^= 1 << 55
+		e.CommitTimestamp = time.UnixMicro(int64(ts)).UTC()
+	}
+
+	return e
+}
+
+// Fields of the tagged GTID event, identified by their ID.
+const (
+	gtidFieldFlags = iota
+	gtidFieldUUID
+	gtidFieldGNO
+	gtidFieldTag
+	gtidFieldLastCommitted
+	gtidFieldSequenceNumber
+	gtidFieldImmediateCommitTimestamp
+	gtidFieldOriginalCommitTimestamp
+	gtidFieldTransactionLength
+	gtidFieldImmediateServerVersion
+	gtidFieldOriginalServerVersion
+	gtidFieldCommitGroupTicket
+)
+
+// decodeGTIDTagged decodes the GTID event written by MySQL 8.3 and later for
+// transactions with a tagged GTID. The event is stored using the
+// serialization format of MySQL: a header holding the format version, the
+// size of the message, and the ID of the last field which cannot be ignored,
+// followed by the fields, each prefixed with its ID. Optional fields are left
+// out, and fields added in later versions are ignored.
+func decodeGTIDTagged(header EventHeader, c *cursor) *GTIDEvent {
+	e := &GTIDEvent{Header: header}
+
+	c.varlen() // format version
+	end := min(int(c.varlen()), len(c.data))
+	c.varlen() // last non-ignorable field
+
+	var immediate, original uint64
+	for c.err == nil && c.pos < end {
+		switch c.varlen() {
+		case gtidFieldFlags:
+			e.Flags = c.uint8()
+		case gtidFieldUUID:
+			if uuid := c.bytes(16); uuid != nil {
+				e.UUID = formatUUID(uuid)
+			}
+		case gtidFieldGNO:
+			e.GNO = c.varlenSigned()
+		case gtidFieldTag:
+			e.Tag = string(c.bytes(int(c.varlen())))
+		case gtidFieldLastCommitted:
+			e.LastCommitted = c.varlenSigned()
+		case gtidFieldSequenceNumber:
+			e.SequenceNumber = c.varlenSigned()
+		case gtidFieldImmediateCommitTimestamp:
+			immediate = c.varlen()
+		case gtidFieldOriginalCommitTimestamp:
+			original = c.varlen()
+		case gtidFieldTransactionLength, gtidFieldImmediateServerVersion,
+			gtidFieldOriginalServerVersion, gtidFieldCommitGroupTicket:
+			c.varlen()
+		default:
+			// the size of unknown fields is not known
+			c.pos = end
+		}
+	}
+
+	// the original commit timestamp is only stored when it differs from
+	// the immediate one
+	if original == 0 {
+		original = immediate
+	}
+	if original != 0 {
+		e.CommitTimestamp = time.UnixMicro(int64(original)).UTC()
+	}
+
+	return e
+}
+
+func formatUUID(b []byte) string {
+	const hex = "0123456789abcdef"
+	var s strings.Builder
+	for i, c := range b {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			s.WriteByte('-')
+		}
+		s.WriteByte(hex[c>>4])
+		s.WriteByte(hex[c&0x0f])
+	}
+	return s.String()
+}
+
+// tableID reads the table ID which is stored using 4 bytes in old servers
+// and 6 bytes otherwise.
+func (d *Decoder) tableID(t EventType, c *cursor) uint64 {
+	if d.postHeaderLength(t, 8) == 6 {
+		return uint64(c.uint32())
+	}
+	return c.uintN(6)
+}
+
+func (d *Decoder) decodeTableMap(header EventHeader, c *cursor) (*TableMapEvent, error) {
+	e := &TableMapEvent{
+		Header:  header,
+		TableID: d.tableID(header.Type, c),
+		Flags:   c.uint16(),
+	}
+
+	e.Schema = string(c.bytes(int(c.uint8())))
+	c.skip(1)
+	e.Table = string(c.bytes(int(c.uint8())))
+	c.skip(1)
+
+	count := int(c.packed())
+	if c.err != nil {
+		return nil, c.err
+	}
+	types := c.bytes(count)
+	meta := &cursor{data: c.bytes(int(c.packed()))}
+	nulls := c.bytes((count + 7) / 8)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	e.Columns = make([]*Column, count)
+	for i, t := range types {
+		col := &Column{
+			Type:     ColumnType(t),
+			Nullable: bitSet(nulls, i),
+		}
+		col.Meta = columnMeta(col.Type, meta)
+
+		if col.Type == ColumnTypeString {
+			realType, length := ColumnType(col.Meta>>8), col.Meta&0xff
+			if realType&0x30 != 0x30 {
+				// CHAR columns longer than 255 bytes store part of the
+				// length in the real type
+				length |= uint16(realType&0x30^0x30) << 4
+				realType |= 0x30
+			}
+			if realType == ColumnTypeEnum || realType == ColumnTypeSet {
+				col.Type = realType
+			}
+			col.Meta = length
+		}
+
+		e.Columns[i] = col
+	}
+	if meta.err != nil {
+		return nil, meta.err
+	}
+
+	if err := decodeOptionalMetadata(e.Columns, c.rest()); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// columnMeta reads the metadata of a column type from the table map event.
+func columnMeta(t ColumnType, c *cursor) uint16 {
+	switch t {
+	case ColumnTypeFloat, ColumnTypeDouble, ColumnTypeBlob, ColumnTypeGeometry,
+		ColumnTypeJSON, ColumnTypeVector, ColumnTypeTimestamp2, ColumnTypeDatetime2,
+		ColumnTypeTime2:
+		return uint16(c.uint8())
+	case ColumnTypeVarchar, ColumnTypeVarString, ColumnTypeBit:
+		return c.uint16()
+	case ColumnTypeNewDecimal, ColumnTypeString, ColumnTypeEnum, ColumnTypeSet:
+		// precision and scale, or real type and length, as big-endian
+		return uint16(c.uint8())<<8 | uint16(c.uint8())
+	default:
+		return 0
+	}
+}
+
+// Types of optional metadata of table map events.
+const (
+	metaSignedness         = 1
+	metaDefaultCharset     = 2
+	metaColumnCharset      = 3
+	metaColumnName         = 4
+	metaSetValues          = 5
+	metaEnumValues         = 6
+	metaSimplePrimaryKey   = 8
+	metaPrimaryKeyWithPref = 9
+)
+
+// decodeOptionalMetadata decodes the metadata added to table map events when
+// binlog_row_metadata is MINIMAL or FULL.
+func decodeOptionalMetadata(columns []*Column, data []byte) error {
+	var numeric, character, enums, sets []*Column
+	for _, col := range columns {
+		switch {
+		case col.Type.isNumeric():
+			numeric = append(numeric, col)
+		case col.Type == ColumnTypeEnum:
+			enums = append(enums, col)
+		case col.Type == ColumnTypeSet:
+			sets = append(sets, col)
+		case col.Type.isCharacter():
+			character = append(character, col)
+		}
+	}
+
+	c := &cursor{data: data}
+	for c.remaining() > 0 && c.err == nil {
+		field := c.uint8()
+		v := &cursor{data: c.bytes(int(c.packed()))}
+		if c.err != nil {
+			break
+		}
+
+		switch field {
+		case metaSignedness:
+			bits := v.rest()
+			for i, col := range numeric {
+				col.Unsigned = bitSetMSB(bits, i)
+			}
+		case metaDefaultCharset:
+			def := v.packed()
+			for _, col := range character {
+				col.Charset = def
+			}
+			for v.remaining() > 0 && v.err == nil {
+				i, charset := int(v.packed()), v.packed()
+				if i < len(character) {
+					character[i].Charset = charset
+				}
+			}
+		case metaColumnCharset:
+			for _, col := range character {
+				col.Charset = v.packed()
+			}
+		case metaColumnName:
+			for _, col := range columns {
+				col.Name = v.packedString()
+			}
+		case metaSetValues:
+			for _, col := range sets {
+				col.SetValues = decodeStringValues(v)
+			}
+		case metaEnumValues:
+			for _, col := range enums {
+				col.EnumValues = decodeStringValues(v)
+			}
+		case metaSimplePrimaryKey, metaPrimaryKeyWithPref:
+			for v.remaining() > 0 && v.err == nil {
+				if i := int(v.packed()); i < len(columns) {
+					columns[i].PrimaryKey = true
+				}
+				if field == metaPrimaryKeyWithPref {
+					v.packed()
+				}
+			}
+		}
+
+		if v.err != nil {
+			return fmt.Errorf("optional metadata field %d: %w", field, v.err)
+		}
+	}
+
+	return c.err
+}
+
+func decodeStringValues(c *cursor) []string {
+	values := make([]string, int(c.packed()))
+	for i := range values {
+		values[i] = c.packedString()
+	}
+	return values
+}
+
+// bitSet returns whether bit i is set in the bitmap b, of which the bits
+// are numbered starting with the least significant bit of the first byte.
+func bitSet(b []byte, i int) bool {
+	if i/8 >= len(b) {
+		return false
+	}
+	return b[i/8]&(1<<(i%8)) != 0
+}
+
+// bitSetMSB is like bitSet, but the bits are numbered starting with the
+// most significant bit of the first byte.
+func bitSetMSB(b []byte, i int) bool {
+	if i/8 >= len(b) {
+		return false
+	}
+	return b[i/8]&(0x80>>(i%8)) != 0
+}
+
+func (d *Decoder) decodeRows(header EventHeader, c *cursor) (*RowsEvent, error) {
+	e := &RowsEvent{
+		Header:  header,
+		TableID: d.tableID(header.Type, c),
+		Flags:   c.uint16(),
+	}
+
+	if header.Type >= EventWriteRows {
+		// version 2 has extra data, of which the length includes itself
+		extra := int(c.uint16())
+		c.skip(extra - 2)
+	}
+
+	table, ok := d.tables[e.TableID]
+	if !ok {
+		return nil, fmt.Errorf("no table map for table ID %d", e.TableID)
+	}
+	e.Table = table
+
+	count := int(c.packed())
+	if count != len(table.Columns) {
+		return nil, fmt.Errorf("rows event has %d columns, table map of %s.%s has %d",
+			count, table.Schema, table.Table, len(table.Columns))
+	}
+
+	before := c.bytes((count + 7) / 8)
+	after := before
+	if header.Type == EventUpdateRows || header.Type == EventUpdateRowsV1 {
+		after = c.bytes((count + 7) / 8)
+	}
+
+	for c.remaining() > 0 && c.err == nil {
+		var row Row
+		var err error
+
+		switch header.Type {
+		case EventWriteRows, EventWriteRowsV1:
+			row.After, err = decodeImage(table.Columns, after, c)
+		case EventDeleteRows, EventDeleteRowsV1:
+			row.Before, err = decodeImage(table.Columns, before, c)
+		default:
+			if row.Before, err = decodeImage(table.Columns, before, c); err == nil {
+				row.After, err = decodeImage(table.Columns, after, c)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		e.Rows = append(e.Rows, row)
+	}
+
+	return e, c.err
+}
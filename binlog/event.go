@@ -0,0 +1,243 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType is the type of binary log event.
+type EventType byte
+
+// Event types as defined by MySQL. Only those marked are decoded; others
+// are returned as GenericEvent.
+const (
+	EventUnknown            EventType = 0
+	EventStart              EventType = 1
+	EventQuery              EventType = 2 // decoded
+	EventStop               EventType = 3
+	EventRotate             EventType = 4 // decoded
+	EventIntvar             EventType = 5
+	EventSlave              EventType = 7
+	EventAppendBlock        EventType = 9
+	EventDeleteFile         EventType = 11
+	EventRand               EventType = 13
+	EventUserVar            EventType = 14
+	EventFormatDescription  EventType = 15 // decoded
+	EventXID                EventType = 16 // decoded
+	EventBeginLoadQuery     EventType = 17
+	EventExecuteLoadQuery   EventType = 18
+	EventTableMap           EventType = 19 // decoded
+	EventWriteRowsV1        EventType = 23 // decoded
+	EventUpdateRowsV1       EventType = 24 // decoded
+	EventDeleteRowsV1       EventType = 25 // decoded
+	EventIncident           EventType = 26
+	EventHeartbeat          EventType = 27
+	EventIgnorable          EventType = 28
+	EventRowsQuery          EventType = 29
+	EventWriteRows          EventType = 30 // decoded
+	EventUpdateRows         EventType = 31 // decoded
+	EventDeleteRows         EventType = 32 // decoded
+	EventGTID               EventType = 33 // decoded
+	EventAnonymousGTID      EventType = 34 // decoded
+	EventPreviousGTIDs      EventType = 35
+	EventTransactionContext EventType = 36
+	EventViewChange         EventType = 37
+	EventXAPrepare          EventType = 38
+	EventPartialUpdateRows  EventType = 39
+	EventTransactionPayload EventType = 40
+	EventHeartbeatV2        EventType = 41
+	EventGTIDTagged         EventType = 42 // decoded
+)
+
+var eventTypeNames = map[EventType]string{
+	EventQuery:             "Query",
+	EventRotate:            "Rotate",
+	EventFormatDescription: "Format_desc",
+	EventXID:               "Xid",
+	EventTableMap:          "Table_map",
+	EventWriteRowsV1:       "Write_rows_v1",
+	EventUpdateRowsV1:      "Update_rows_v1",
+	EventDeleteRowsV1:      "Delete_rows_v1",
+	EventWriteRows:         "Write_rows",
+	EventUpdateRows:        "Update_rows",
+	EventDeleteRows:        "Delete_rows",
+	EventGTID:              "Gtid",
+	EventAnonymousGTID:     "Anonymous_Gtid",
+	EventPreviousGTIDs:     "Previous_gtids",
+	EventRowsQuery:         "Rows_query",
+	EventHeartbeat:         "Heartbeat",
+	EventGTIDTagged:        "Gtid_tagged_log",
+}
+
+// String returns the name of the event type as shown by SHOW BINLOG EVENTS.
+func (t EventType) String() string {
+	if n, ok := eventTypeNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("Unknown(%d)", byte(t))
+}
+
+// EventHeader is the common header of all events.
+type EventHeader struct {
+	Timestamp time.Time
+	Type      EventType
+	ServerID  uint32
+	// EventSize is the size of the event including header and checksum.
+	EventSize uint32
+	// LogPos is the position of the next event within the binary log.
+	LogPos uint32
+	Flags  uint16
+}
+
+// Event is a decoded binary log event.
+type Event interface {
+	EventHeader() *EventHeader
+}
+
+// FormatDescriptionEvent describes the format of the events which follow. It is
+// the first event of each binary log file.
+type FormatDescriptionEvent struct {
+	Header            EventHeader
+	BinlogVersion     uint16
+	ServerVersion     string
+	CreateTimestamp   time.Time
+	HeaderLength      byte
+	PostHeaderLengths []byte
+	// ChecksumAlgorithm is 0 when events have no checksum, and 1 for CRC32.
+	ChecksumAlgorithm byte
+}
+
+func (e *FormatDescriptionEvent) EventHeader() *EventHeader { return &e.Header }
+
+// postHeaderLength returns the length of the post-header of events of type t.
+func (e *FormatDescriptionEvent) postHeaderLength(t EventType, def int) int {
+	if i := int(t) - 1; i >= 0 && i < len(e.PostHeaderLengths) {
+		return int(e.PostHeaderLengths[i])
+	}
+	return def
+}
+
+// RotateEvent points to the next binary log file.
+type RotateEvent struct {
+	Header   EventHeader
+	Position uint64
+	NextFile string
+}
+
+func (e *RotateEvent) EventHeader() *EventHeader { return &e.Header }
+
+// QueryEvent holds a statement, for example DDL or BEGIN, as it was executed.
+type QueryEvent struct {
+	Header        EventHeader
+	ThreadID      uint32
+	ExecutionTime time.Duration
+	ErrorCode     uint16
+	StatusVars    []byte
+	Schema        string
+	Query         string
+}
+
+func (e *QueryEvent) EventHeader() *EventHeader { return &e.Header }
+
+// XIDEvent marks the commit of a transaction.
+type XIDEvent struct {
+	Header EventHeader
+	XID    uint64
+}
+
+func (e *XIDEvent) EventHeader() *EventHeader { return &e.Header }
+
+// GTIDEvent precedes the events of a transaction, and holds its global
+// transaction identifier. For anonymous transactions, UUID is empty. Tag is
+// only set for tagged GTIDs (MySQL 8.3 and later).
+type GTIDEvent struct {
+	Header         EventHeader
+	Flags          byte
+	UUID           string
+	Tag            string
+	GNO            int64
+	LastCommitted  int64
+	SequenceNumber int64
+	// CommitTimestamp is the time the transaction was committed on the
+	// original source; zero when not available.
+	CommitTimestamp time.Time
+}
+
+func (e *GTIDEvent) EventHeader() *EventHeader { return &e.Header }
+
+// GTID returns the global transaction identifier formatted as uuid:gno, or
+// as uuid:tag:gno for tagged GTIDs.
+func (e *GTIDEvent) GTID() string {
+	if e.UUID == "" {
+		return ""
+	}
+	if e.Tag != "" {
+		return fmt.Sprintf("%s:%s:%d", e.UUID, e.Tag, e.GNO)
+	}
+	return fmt.Sprintf("%s:%d", e.UUID, e.GNO)
+}
+
+// TableMapEvent maps a table ID, used by rows events, to a table and
+// describes its columns.
+type TableMapEvent struct {
+	Header  EventHeader
+	TableID uint64
+	Flags   uint16
+	Schema  string
+	Table   string
+	Columns []*Column
+}
+
+func (e *TableMapEvent) EventHeader() *EventHeader { return &e.Header }
+
+// Column describes a column of a table as found in a table map event.
+type Column struct {
+	// Type is the type of the column. ENUM and SET columns, logged as
+	// ColumnTypeString, get their real type from the metadata.
+	Type ColumnType
+	// Meta is the metadata of the type, for example, the precision and scale
+	// of DECIMAL, or the maximum length in bytes of CHAR.
+	Meta     uint16
+	Nullable bool
+	// The following is only available when the server has binlog_row_metadata
+	// set to FULL; Unsigned and Charset also with MINIMAL.
+	Name       string
+	Unsigned   bool
+	Charset    uint64
+	EnumValues []string
+	SetValues  []string
+	PrimaryKey bool
+}
+
+// RowsEvent holds the rows inserted, updated, or deleted by a statement on
+// a single table.
+type RowsEvent struct {
+	Header  EventHeader
+	TableID uint64
+	Flags   uint16
+	// Table is the table map event with given TableID which preceded this event.
+	Table *TableMapEvent
+	// Rows holds one row per changed row. For inserts, only After is set; for
+	// deletes, only Before.
+	Rows []Row
+}
+
+func (e *RowsEvent) EventHeader() *EventHeader { return &e.Header }
+
+// Row holds the before and after images of a changed row. The images hold a
+// value per column of the table; columns not logged (see binlog_row_image)
+// are nil, as well as NULL values.
+type Row struct {
+	Before []any
+	After  []any
+}
+
+// GenericEvent is an event which is not decoded; Data holds its body.
+type GenericEvent struct {
+	Header EventHeader
+	Data   []byte
+}
+
+func (e *GenericEvent) EventHeader() *EventHeader { return &e.Header }
@@ -0,0 +1,282 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Types of values within the binary JSON format of MySQL.
+const (
+	jsonSmallObject = 0x00
+	jsonLargeObject = 0x01
+	jsonSmallArray  = 0x02
+	jsonLargeArray  = 0x03
+	jsonLiteral     = 0x04
+	jsonInt16       = 0x05
+	jsonUint16      = 0x06
+	jsonInt32       = 0x07
+	jsonUint32      = 0x08
+	jsonInt64       = 0x09
+	jsonUint64      = 0x0a
+	jsonDouble      = 0x0b
+	jsonString      = 0x0c
+	jsonOpaque      = 0x0f
+)
+
+// decodeJSON decodes a JSON document stored in the binary format MySQL uses
+// for JSON columns, and returns it as compact JSON text.
+func decodeJSON(data []byte) (json.RawMessage, error) {
+	if len(data) == 0 {
+		// JSON columns can be empty when updated with invalid values while
+		// strict mode is off
+		return json.RawMessage("null"), nil
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONValue(&buf, data[0], data[1:]); err != nil {
+		return nil, fmt.Errorf("JSON: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+var errJSONTruncated = errors.New("truncated value")
+
+func writeJSONValue(buf *bytes.Buffer, t byte, data []byte) error {
+	switch t {
+	case jsonSmallObject, jsonLargeObject:
+		return writeJSONContainer(buf, data, t == jsonLargeObject, true)
+	case jsonSmallArray, jsonLargeArray:
+		return writeJSONContainer(buf, data, t == jsonLargeArray, false)
+	case jsonLiteral:
+		if len(data) < 1 {
+			return errJSONTruncated
+		}
+		switch data[0] {
+		case 0x00:
+			buf.WriteString("null")
+		case 0x01:
+			buf.WriteString("true")
+		case 0x02:
+			buf.WriteString("false")
+		default:
+			return fmt.Errorf("invalid literal %#x", data[0])
+		}
+		return nil
+	case jsonString:
+		n, size, err := jsonVariableLength(data)
+		if err != nil {
+			return err
+		}
+		if size+n > len(data) {
+			return errJSONTruncated
+		}
+		writeJSONString(buf, string(data[size:size+n]))
+		return nil
+	case jsonOpaque:
+		return writeJSONOpaque(buf, data)
+	}
+
+	size := map[byte]int{
+		jsonInt16: 2, jsonUint16: 2, jsonInt32: 4, jsonUint32: 4,
+		jsonInt64: 8, jsonUint64: 8, jsonDouble: 8,
+	}[t]
+	if size == 0 {
+		return fmt.Errorf("invalid value type %#x", t)
+	}
+	if len(data) < size {
+		return errJSONTruncated
+	}
+
+	v := littleEndian(data[:size])
+	switch t {
+	case jsonInt16, jsonInt32, jsonInt64:
+		buf.WriteString(strconv.FormatInt(integer(v, size, false).(int64), 10))
+	case jsonUint16, jsonUint32, jsonUint64:
+		buf.WriteString(strconv.FormatUint(v, 10))
+	case jsonDouble:
+		b, err := json.Marshal(math.Float64frombits(v))
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+
+	return nil
+}
+
+// writeJSONContainer writes an object or array. Offsets are relative to the
+// start of the container, and are stored using 2 bytes for small and 4 bytes
+// for large containers.
+func writeJSONContainer(buf *bytes.Buffer, data []byte, large, isObject bool) error {
+	offsetSize := 2
+	if large {
+		offsetSize = 4
+	}
+
+	if len(data) < 2*offsetSize {
+		return errJSONTruncated
+	}
+	count := int(littleEndian(data[:offsetSize]))
+	if int(littleEndian(data[offsetSize:2*offsetSize])) > len(data) {
+		return errJSONTruncated
+	}
+
+	keyEntrySize := offsetSize + 2
+	valueEntrySize := 1 + offsetSize
+	keyEntries := 2 * offsetSize
+	valueEntries := keyEntries
+	if isObject {
+		valueEntries += count * keyEntrySize
+	}
+	if valueEntries+count*valueEntrySize > len(data) {
+		return errJSONTruncated
+	}
+
+	start, end := byte('['), byte(']')
+	if isObject {
+		start, end = '{', '}'
+	}
+
+	buf.WriteByte(start)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		if isObject {
+			entry := data[keyEntries+i*keyEntrySize:]
+			offset := int(littleEndian(entry[:offsetSize]))
+			length := int(binary.LittleEndian.Uint16(entry[offsetSize:]))
+			if offset+length > len(data) {
+				return errJSONTruncated
+			}
+			writeJSONString(buf, string(data[offset:offset+length]))
+			buf.WriteByte(':')
+		}
+
+		entry := data[valueEntries+i*valueEntrySize:]
+		t := entry[0]
+		if jsonInlined(t, large) {
+			if err := writeJSONValue(buf, t, entry[1:1+offsetSize]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		offset := int(littleEndian(entry[1 : 1+offsetSize]))
+		if offset >= len(data) {
+			return errJSONTruncated
+		}
+		if err := writeJSONValue(buf, t, data[offset:]); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(end)
+
+	return nil
+}
+
+// jsonInlined returns whether values of type t are stored in the value entry
+// of a container instead of at an offset.
+func jsonInlined(t byte, large bool) bool {
+	switch t {
+	case jsonLiteral, jsonInt16, jsonUint16:
+		return true
+	case jsonInt32, jsonUint32:
+		return large
+	}
+	return false
+}
+
+// jsonVariableLength reads a length stored using 7 bits per byte, of which
+// the high bit flags that more bytes follow. It returns the length and the
+// number of bytes used.
+func jsonVariableLength(data []byte) (int, int, error) {
+	var n uint64
+	for i := 0; i < 5 && i < len(data); i++ {
+		n |= uint64(data[i]&0x7f) << (7 * i)
+		if data[i]&0x80 == 0 {
+			return int(n), i + 1, nil
+		}
+	}
+	return 0, 0, errJSONTruncated
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// writeJSONOpaque writes values of MySQL types which JSON does not support.
+// Temporal and DECIMAL values are written as strings, like MySQL does; other
+// values are written base64 encoded prefixed with their type.
+func writeJSONOpaque(buf *bytes.Buffer, data []byte) error {
+	if len(data) < 1 {
+		return errJSONTruncated
+	}
+	t := ColumnType(data[0])
+	n, size, err := jsonVariableLength(data[1:])
+	if err != nil {
+		return err
+	}
+	if 1+size+n > len(data) {
+		return errJSONTruncated
+	}
+	v := data[1+size : 1+size+n]
+
+	switch t {
+	case ColumnTypeNewDecimal:
+		if len(v) < 2 || len(v)-2 < decimalSize(int(v[0]), int(v[1])) {
+			return errJSONTruncated
+		}
+		buf.WriteString(decodeDecimal(v[2:], int(v[0]), int(v[1])))
+		return nil
+	case ColumnTypeDate, ColumnTypeDatetime, ColumnTypeTimestamp, ColumnTypeTime:
+		if len(v) < 8 {
+			return errJSONTruncated
+		}
+		writeJSONString(buf, packedTemporal(t, int64(binary.LittleEndian.Uint64(v))))
+		return nil
+	}
+
+	writeJSONString(buf, fmt.Sprintf("base64:type%d:%s", t, base64.StdEncoding.EncodeToString(v)))
+	return nil
+}
+
+// packedTemporal formats a temporal value stored in the packed format used
+// by MySQL internally: the integer part shifted left 24 bits, and the
+// microseconds in the lower 24 bits.
+func packedTemporal(t ColumnType, packed int64) string {
+	sign := ""
+	if packed < 0 {
+		sign, packed = "-", -packed
+	}
+	usec := packed & (1<<24 - 1)
+	intPart := packed >> 24
+
+	frac := ""
+	if usec > 0 {
+		frac = fractionString(usec, 6)
+	}
+
+	if t == ColumnTypeTime {
+		return fmt.Sprintf("%s%02d:%02d:%02d%s", sign, intPart>>12&1023, intPart>>6&63, intPart&63, frac)
+	}
+
+	ymd, hms := intPart>>17, intPart&(1<<17-1)
+	ym := ymd >> 5
+	date := fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd&31)
+	if t == ColumnTypeDate {
+		return date
+	}
+	return fmt.Sprintf("%s %02d:%02d:%02d%s", date, hms>>12, hms>>6&63, hms&63, frac)
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golistic/xgo/xt"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	var cases = map[string]struct {
+		data []byte
+		exp  string
+	}{
+		"document": {data: testJSONDocument, exp: `{"a":1,"b":[true,null,"x"]}`},
+		"scalar":   {data: []byte{0x0c, 0x03, 'a', '"', 'c'}, exp: `"a\"c"`},
+		"int64":    {data: []byte{0x09, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, exp: `-2`},
+		"double":   {data: []byte{0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f}, exp: `1.5`},
+		"empty":    {data: nil, exp: `null`},
+		"decimal": {
+			data: []byte{0x0f, byte(ColumnTypeNewDecimal), 0x07, 10, 2, 0x80, 0x00, 0x04, 0xd2, 0x32},
+			exp:  `1234.50`,
+		},
+		"large array": {
+			data: []byte{0x03, 0x01, 0x00, 0x00, 0x00, 0x0d, 0x00, 0x00, 0x00, 0x07, 0xff, 0xff, 0xff, 0xff},
+			exp:  `[-1]`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			doc, err := decodeJSON(c.data)
+			xt.OK(t, err)
+			xt.Eq(t, json.RawMessage(c.exp), doc)
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := decodeJSON(testJSONDocument[:20])
+		xt.KO(t, err)
+	})
+}
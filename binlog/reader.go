@@ -0,0 +1,118 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+// Package binlog decodes the events of MySQL binary logs. It can be used to
+// read binary log files, for example to audit which rows were changed, and
+// to decode the events streamed by a MySQL server to its replicas.
+//
+// Format description, rotate, query, table map, rows (write, update, and
+// delete; versions 1 and 2), XID, and GTID events, including tagged GTIDs,
+// are decoded. Other events are returned as GenericEvent. Row images are
+// decoded using the metadata of the preceding table map event; the names of
+// columns, the values of ENUM and SET, and the character set of strings are
+// only available when the server logged them (binlog_row_metadata set to
+// FULL).
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic is the sequence of bytes with which each binary log file starts.
+var Magic = []byte{0xfe, 'b', 'i', 'n'}
+
+// ErrNotBinlog is returned when the data is not a binary log.
+var ErrNotBinlog = errors.New("binlog: not a binary log")
+
+// MaxEventSize is the size of the largest event read. The server does not
+// write events larger than max_allowed_packet, which is at most 1GiB; larger
+// sizes are the result of corrupted data.
+const MaxEventSize = 1 << 30
+
+// Reader reads events from a binary log file.
+type Reader struct {
+	r       *bufio.Reader
+	decoder *Decoder
+	pos     int64
+}
+
+// NewReader returns a Reader reading events from r, which must be positioned
+// at the start of a binary log file. It returns ErrNotBinlog when r does not
+// start with Magic.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNotBinlog
+		}
+		return nil, fmt.Errorf("binlog: %w", err)
+	}
+	if !bytes.Equal(magic, Magic) {
+		return nil, ErrNotBinlog
+	}
+
+	return &Reader{
+		r:       br,
+		decoder: NewDecoder(),
+		pos:     int64(len(Magic)),
+	}, nil
+}
+
+// Next reads and decodes the next event. It returns io.EOF when there are no
+// more events. A binary log which ends in the middle of an event, as can be
+// the case while the server is writing it, results in io.ErrUnexpectedEOF.
+func (r *Reader) Next() (Event, error) {
+	data, err := r.NextRaw()
+	if err != nil {
+		return nil, err
+	}
+	return r.decoder.Decode(data)
+}
+
+// NextRaw reads the next event without decoding it. It returns io.EOF when
+// there are no more events.
+//
+// Note that decoding row events requires the preceding table map events to
+// have been decoded.
+func (r *Reader) NextRaw() ([]byte, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("binlog: reading event header at position %d: %w", r.pos, err)
+	}
+
+	size := int64(binary.LittleEndian.Uint32(header[9:]))
+	if size < HeaderSize || size > MaxEventSize {
+		return nil, fmt.Errorf("binlog: invalid event size %d at position %d", size, r.pos)
+	}
+
+	data := make([]byte, size)
+	copy(data, header)
+	if _, err := io.ReadFull(r.r, data[HeaderSize:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("binlog: reading event at position %d: %w", r.pos, err)
+	}
+	r.pos += size
+
+	return data, nil
+}
+
+// Position returns the position within the binary log file of the next event.
+func (r *Reader) Position() int64 {
+	return r.pos
+}
+
+// Decoder returns the decoder used by r.
+func (r *Reader) Decoder() *Decoder {
+	return r.decoder
+}
@@ -0,0 +1,592 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xt"
+
+	"github.com/golistic/xmysql"
+	"github.com/golistic/xmysql/xmysqltest"
+)
+
+const testUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+// testBinlog builds a binary log as written by MySQL 8.0 using CRC32
+// checksums.
+type testBinlog struct {
+	buf bytes.Buffer
+}
+
+func newTestBinlog() *testBinlog {
+	b := &testBinlog{}
+	b.buf.Write(Magic)
+	b.formatDescription()
+	return b
+}
+
+func (b *testBinlog) event(t EventType, body []byte) {
+	size := HeaderSize + len(body) + 4
+	pos := b.buf.Len() + size
+
+	header := make([]byte, HeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], 1696509296)
+	header[4] = byte(t)
+	binary.LittleEndian.PutUint32(header[5:], 1)
+	binary.LittleEndian.PutUint32(header[9:], uint32(size))
+	binary.LittleEndian.PutUint32(header[13:], uint32(pos))
+
+	data := append(header, body...)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	b.buf.Write(data)
+}
+
+func (b *testBinlog) formatDescription() {
+	body := binary.LittleEndian.AppendUint16(nil, 4)
+	version := make([]byte, 50)
+	copy(version, "8.0.34")
+	body = append(body, version...)
+	body = binary.LittleEndian.AppendUint32(body, 1696509296)
+	body = append(body, HeaderSize)
+
+	lengths := make([]byte, 41)
+	for t, n := range map[EventType]byte{
+		EventQuery: 13, EventRotate: 8, EventTableMap: 8,
+		EventWriteRowsV1: 8, EventUpdateRowsV1: 8, EventDeleteRowsV1: 8,
+		EventWriteRows: 10, EventUpdateRows: 10, EventDeleteRows: 10,
+		EventGTID: 42, EventAnonymousGTID: 42,
+	} {
+		lengths[t-1] = n
+	}
+	body = append(body, lengths...)
+	body = append(body, ChecksumCRC32)
+
+	b.event(EventFormatDescription, body)
+}
+
+func packedString(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func (b *testBinlog) tableMap() {
+	body := []byte{42, 0, 0, 0, 0, 0, 1, 0}
+	body = append(append(append(body, 4), "shop"...), 0)
+	body = append(append(append(body, 5), "items"...), 0)
+
+	types := []ColumnType{
+		ColumnTypeLong, ColumnTypeTiny, ColumnTypeVarchar, ColumnTypeNewDecimal,
+		ColumnTypeDatetime2, ColumnTypeTimestamp2, ColumnTypeTime2, ColumnTypeJSON,
+		ColumnTypeBlob, ColumnTypeString, ColumnTypeVarchar,
+	}
+	body = append(body, byte(len(types)))
+	for _, t := range types {
+		body = append(body, byte(t))
+	}
+
+	meta := []byte{80, 0, 10, 2, 3, 0, 0, 4, 2, byte(ColumnTypeEnum), 1, 40, 0}
+	body = append(body, byte(len(meta)))
+	body = append(body, meta...)
+	body = append(body, 0x00, 0x04) // note is nullable
+
+	// signedness: id is unsigned
+	body = append(body, metaSignedness, 1, 0x80)
+	// default charset utf8mb4_0900_ai_ci, except for data which is binary
+	body = append(body, metaDefaultCharset, 5, 0xfc, 0xff, 0x00, 1, charsetBinary)
+
+	var names []byte
+	for _, n := range []string{"id", "qty", "name", "price", "created", "updated", "dur", "doc", "data",
+		"status", "note"} {
+		names = append(names, packedString(n)...)
+	}
+	body = append(append(body, metaColumnName, byte(len(names))), names...)
+
+	enums := []byte{3}
+	for _, v := range []string{"new", "paid", "shipped"} {
+		enums = append(enums, packedString(v)...)
+	}
+	body = append(append(body, metaEnumValues, byte(len(enums))), enums...)
+	body = append(body, metaSimplePrimaryKey, 1, 0)
+
+	b.event(EventTableMap, body)
+}
+
+// testJSONDocument is {"a":1,"b":[true,null,"x"]} in the binary JSON format.
+var testJSONDocument = []byte{
+	0x00, 0x02, 0x00, 0x23, 0x00,
+	0x12, 0x00, 0x01, 0x00, 0x13, 0x00, 0x01, 0x00,
+	0x05, 0x01, 0x00, 0x02, 0x14, 0x00,
+	'a', 'b',
+	0x03, 0x00, 0x0f, 0x00, 0x04, 0x01, 0x00, 0x04, 0x00, 0x00, 0x0c, 0x0d, 0x00, 0x01, 'x',
+}
+
+func testDatetime2(year, month, day, hour, minute, second, msec int) []byte {
+	ymd := int64((year*13+month)<<5 | day)
+	hms := int64(hour<<12 | minute<<6 | second)
+	v := ymd<<17 | hms + 0x8000000000
+	b := binary.BigEndian.AppendUint64(nil, uint64(v))[3:]
+	return binary.BigEndian.AppendUint16(b, uint16(msec*10))
+}
+
+func testRowImage(qty byte, note *string) []byte {
+	row := []byte{0x00, 0x00}
+	if note == nil {
+		row[1] = 0x04
+	}
+
+	row = binary.LittleEndian.AppendUint32(row, 4294967294)
+	row = append(row, qty)
+	row = append(row, packedString("widget")...)
+	row = append(row, 0x80, 0x00, 0x04, 0xd2, 0x32)
+	row = append(row, testDatetime2(2023, 10, 5, 12, 34, 56, 789)...)
+	row = binary.BigEndian.AppendUint32(row, 1700000000)
+	row = append(row, 0x7f, 0xf0, 0x00) // -01:00:00
+	row = binary.LittleEndian.AppendUint32(row, uint32(len(testJSONDocument)))
+	row = append(row, testJSONDocument...)
+	row = append(row, 3, 0, 0x00, 0x01, 0x02)
+	row = append(row, 2)
+	if note != nil {
+		row = append(row, packedString(*note)...)
+	}
+	return row
+}
+
+func (b *testBinlog) rows(t EventType, images ...[]byte) {
+	body := []byte{42, 0, 0, 0, 0, 0, 1, 0, 2, 0, 11, 0xff, 0x07}
+	if t == EventUpdateRows {
+		body = append(body, 0xff, 0x07)
+	}
+	for _, image := range images {
+		body = append(body, image...)
+	}
+	b.event(t, body)
+}
+
+func (b *testBinlog) transaction() {
+	gtid := []byte{0x01}
+	gtid = append(gtid, 0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62)
+	gtid = binary.LittleEndian.AppendUint64(gtid, 7)
+	gtid = append(gtid, 2)
+	gtid = binary.LittleEndian.AppendUint64(gtid, 3)
+	gtid = binary.LittleEndian.AppendUint64(gtid, 4)
+	gtid = append(gtid, binary.LittleEndian.AppendUint64(nil, 1696509296123456)[:7]...)
+	b.event(EventGTID, gtid)
+
+	query := binary.LittleEndian.AppendUint32(nil, 12)
+	query = binary.LittleEndian.AppendUint32(query, 0)
+	query = append(query, 4, 0, 0, 0, 0)
+	query = append(append(query, "shop"...), 0)
+	query = append(query, "BEGIN"...)
+	b.event(EventQuery, query)
+
+	note := "hi"
+	b.tableMap()
+	b.rows(EventWriteRows, testRowImage(0xff, nil))
+	b.rows(EventUpdateRows, testRowImage(0xff, nil), testRowImage(5, &note))
+	b.rows(EventDeleteRows, testRowImage(5, &note))
+
+	b.event(EventXID, binary.LittleEndian.AppendUint64(nil, 99))
+}
+
+// testVarlen encodes v as done by the serialization format of MySQL 8.3.
+func testVarlen(v uint64) []byte {
+	n := 1
+	for n < 9 && v >= 1<<(7*n) {
+		n++
+	}
+	if n == 9 {
+		return binary.LittleEndian.AppendUint64([]byte{0xff}, v)
+	}
+	return binary.LittleEndian.AppendUint64(nil, v<<n|(1<<(n-1)-1))[:n]
+}
+
+// taggedTransaction adds a GTID event for a transaction with a tagged GTID,
+// as written by MySQL 8.3.
+func (b *testBinlog) taggedTransaction(tag string, gno int64) {
+	uuid := []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+	var fields []byte
+	for id, value := range [][]byte{
+		{0x01},
+		uuid,
+		testVarlen(uint64(gno) << 1),
+		append(testVarlen(uint64(len(tag))), tag...),
+		testVarlen(3 << 1),
+		testVarlen(4 << 1),
+		testVarlen(1696509296123456),
+		nil, // original commit timestamp is the same
+		testVarlen(512),
+		testVarlen(80300),
+	} {
+		if value != nil {
+			fields = append(append(fields, testVarlen(uint64(id))...), value...)
+		}
+	}
+
+	body := append(testVarlen(1), byte(0)) // size is set below
+	body = append(append(body, testVarlen(9)...), fields...)
+	body[1] = testVarlen(uint64(len(body)))[0]
+
+	b.event(EventGTIDTagged, body)
+}
+
+func (b *testBinlog) rotate(next string) {
+	body := binary.LittleEndian.AppendUint64(nil, 4)
+	b.event(EventRotate, append(body, next...))
+}
+
+func readAll(t *testing.T, data []byte) []Event {
+	t.Helper()
+
+	r, err := NewReader(bytes.NewReader(data))
+	xt.OK(t, err)
+
+	var events []Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		xt.OK(t, err)
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func TestReader_Next(t *testing.T) {
+	b := newTestBinlog()
+	b.transaction()
+	b.rotate("binlog.000002")
+
+	events := readAll(t, b.buf.Bytes())
+
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.EventHeader().Type)
+	}
+	xt.Eq(t, []EventType{
+		EventFormatDescription, EventGTID, EventQuery, EventTableMap,
+		EventWriteRows, EventUpdateRows, EventDeleteRows, EventXID, EventRotate,
+	}, types)
+
+	t.Run("format description", func(t *testing.T) {
+		fde := events[0].(*FormatDescriptionEvent)
+		xt.Eq(t, "8.0.34", fde.ServerVersion)
+		xt.Eq(t, ChecksumCRC32, fde.ChecksumAlgorithm)
+		xt.Eq(t, uint32(1), fde.Header.ServerID)
+	})
+
+	t.Run("GTID", func(t *testing.T) {
+		e := events[1].(*GTIDEvent)
+		xt.Eq(t, testUUID+":7", e.GTID())
+		xt.Eq(t, int64(3), e.LastCommitted)
+		xt.Eq(t, int64(4), e.SequenceNumber)
+		xt.Eq(t, time.UnixMicro(1696509296123456).UTC(), e.CommitTimestamp)
+	})
+
+	t.Run("query", func(t *testing.T) {
+		e := events[2].(*QueryEvent)
+		xt.Eq(t, "shop", e.Schema)
+		xt.Eq(t, "BEGIN", e.Query)
+		xt.Eq(t, uint32(12), e.ThreadID)
+	})
+
+	t.Run("table map", func(t *testing.T) {
+		e := events[3].(*TableMapEvent)
+		xt.Eq(t, uint64(42), e.TableID)
+		xt.Eq(t, "shop", e.Schema)
+		xt.Eq(t, "items", e.Table)
+		xt.Eq(t, 11, len(e.Columns))
+
+		xt.Eq(t, "id", e.Columns[0].Name)
+		xt.Assert(t, e.Columns[0].Unsigned)
+		xt.Assert(t, e.Columns[0].PrimaryKey)
+		xt.Assert(t, !e.Columns[1].Unsigned)
+		xt.Eq(t, ColumnTypeEnum, e.Columns[9].Type)
+		xt.Eq(t, []string{"new", "paid", "shipped"}, e.Columns[9].EnumValues)
+		xt.Eq(t, uint64(255), e.Columns[2].Charset)
+		xt.Eq(t, uint64(charsetBinary), e.Columns[8].Charset)
+		xt.Assert(t, e.Columns[10].Nullable)
+		xt.Assert(t, !e.Columns[0].Nullable)
+	})
+
+	expRow := []any{
+		uint64(4294967294), int64(-1), "widget", "1234.50", "2023-10-05 12:34:56.789",
+		time.Unix(1700000000, 0).UTC(), -time.Hour, json.RawMessage(`{"a":1,"b":[true,null,"x"]}`),
+		[]byte{0, 1, 2}, "paid", nil,
+	}
+	expUpdated := append([]any{}, expRow...)
+	expUpdated[1] = int64(5)
+	expUpdated[10] = "hi"
+
+	t.Run("write rows", func(t *testing.T) {
+		e := events[4].(*RowsEvent)
+		xt.Eq(t, "items", e.Table.Table)
+		xt.Eq(t, 1, len(e.Rows))
+		xt.Assert(t, e.Rows[0].Before == nil)
+		xt.Eq(t, expRow, e.Rows[0].After)
+	})
+
+	t.Run("update rows", func(t *testing.T) {
+		e := events[5].(*RowsEvent)
+		xt.Eq(t, 1, len(e.Rows))
+		xt.Eq(t, expRow, e.Rows[0].Before)
+		xt.Eq(t, expUpdated, e.Rows[0].After)
+	})
+
+	t.Run("delete rows", func(t *testing.T) {
+		e := events[6].(*RowsEvent)
+		xt.Eq(t, 1, len(e.Rows))
+		xt.Eq(t, expUpdated, e.Rows[0].Before)
+		xt.Assert(t, e.Rows[0].After == nil)
+	})
+
+	t.Run("XID and rotate", func(t *testing.T) {
+		xt.Eq(t, uint64(99), events[7].(*XIDEvent).XID)
+
+		e := events[8].(*RotateEvent)
+		xt.Eq(t, "binlog.000002", e.NextFile)
+		xt.Eq(t, uint64(4), e.Position)
+		xt.Eq(t, uint32(b.buf.Len()), e.Header.LogPos)
+	})
+}
+
+func TestReader_taggedGTID(t *testing.T) {
+	b := newTestBinlog()
+	b.taggedTransaction("batch", 300)
+
+	events := readAll(t, b.buf.Bytes())
+	xt.Eq(t, 2, len(events))
+
+	e := events[1].(*GTIDEvent)
+	xt.Eq(t, EventGTIDTagged, e.Header.Type)
+	xt.Eq(t, byte(1), e.Flags)
+	xt.Eq(t, testUUID, e.UUID)
+	xt.Eq(t, "batch", e.Tag)
+	xt.Eq(t, int64(300), e.GNO)
+	xt.Eq(t, testUUID+":batch:300", e.GTID())
+	xt.Eq(t, int64(3), e.LastCommitted)
+	xt.Eq(t, int64(4), e.SequenceNumber)
+	xt.Eq(t, time.UnixMicro(1696509296123456).UTC(), e.CommitTimestamp)
+}
+
+func TestCursor_varlen(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, 1<<56 - 1, 1 << 56, 1<<64 - 1} {
+		c := &cursor{data: testVarlen(v)}
+		xt.Eq(t, v, c.varlen())
+		xt.OK(t, c.err)
+		xt.Eq(t, 0, c.remaining())
+	}
+
+	c := &cursor{data: []byte{0x07}} // 4 bytes announced
+	c.varlen()
+	xt.KO(t, c.err)
+
+	c = &cursor{data: append(testVarlen(5<<1|1), testVarlen(5<<1)...)}
+	xt.Eq(t, int64(-6), c.varlenSigned())
+	xt.Eq(t, int64(5), c.varlenSigned())
+}
+
+func TestReader_errors(t *testing.T) {
+	t.Run("not a binary log", func(t *testing.T) {
+		_, err := NewReader(bytes.NewReader([]byte("SELECT 1")))
+		xt.Assert(t, errors.Is(err, ErrNotBinlog))
+
+		_, err = NewReader(bytes.NewReader(nil))
+		xt.Assert(t, errors.Is(err, ErrNotBinlog))
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		b := newTestBinlog()
+		b.rotate("binlog.000002")
+		data := b.buf.Bytes()
+		data[len(data)-6] ^= 0xff
+
+		r, err := NewReader(bytes.NewReader(data))
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.Assert(t, errors.Is(err, ErrChecksum))
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		b := newTestBinlog()
+		b.rotate("binlog.000002")
+		data := b.buf.Bytes()
+
+		r, err := NewReader(bytes.NewReader(data[:len(data)-3]))
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.Assert(t, errors.Is(err, io.ErrUnexpectedEOF))
+	})
+
+	t.Run("event too large", func(t *testing.T) {
+		b := newTestBinlog()
+		b.rotate("binlog.000002")
+		data := b.buf.Bytes()
+		rotate := data[len(data)-HeaderSize-8-len("binlog.000002")-4:]
+		binary.LittleEndian.PutUint32(rotate[9:], MaxEventSize+1)
+
+		r, err := NewReader(bytes.NewReader(data))
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.KO(t, err)
+		xt.MatchString(t, `^binlog: invalid event size 1073741825 at position \d+$`, err.Error())
+	})
+
+	t.Run("rows without table map", func(t *testing.T) {
+		b := newTestBinlog()
+		b.rows(EventWriteRows, testRowImage(1, nil))
+
+		r, err := NewReader(bytes.NewReader(b.buf.Bytes()))
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.OK(t, err)
+		_, err = r.Next()
+		xt.KO(t, err)
+		xt.Eq(t, "binlog: decoding Write_rows event: no table map for table ID 42", err.Error())
+	})
+}
+
+// TestReader_server decodes the events of a binary log written by the server.
+// The events are read using the replication protocol, which sends them as
+// stored in the binary log file.
+func TestReader_server(t *testing.T) {
+	dsn := os.Getenv("XMYSQL_DSN")
+	if dsn == "" {
+		dsn = xmysqltest.DefaultDSN
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ping, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	err = ping.PingContext(ctx)
+	_ = ping.Close()
+	if err != nil {
+		err = xmysql.NewError(err)
+		if xmysql.ErrorIs(err, xmysql.ErrClientConnRefused) || xmysql.ErrorIs(err, xmysql.ErrClientConnHost) {
+			t.Skip("no MySQL server available:", err)
+		}
+		t.Fatal(err)
+	}
+
+	db := xmysqltest.New(t, &xmysqltest.Options{DSN: dsn})
+
+	var gtidMode, binlogFormat string
+	xt.OK(t, db.QueryRow("SELECT @@GLOBAL.gtid_mode, @@GLOBAL.binlog_format").Scan(&gtidMode, &binlogFormat))
+	if gtidMode != "ON" || binlogFormat != "ROW" {
+		t.Skip("server does not use GTIDs with row-based binary logging")
+	}
+
+	var schema string
+	xt.OK(t, db.QueryRow("SELECT DATABASE()").Scan(&schema))
+
+	_, err = db.Exec("CREATE TABLE items (id INT UNSIGNED PRIMARY KEY, name VARCHAR(20))")
+	xt.OK(t, err)
+
+	info, err := xmysql.Probe(ctx, db)
+	xt.OK(t, err)
+	// tagged GTIDs are available as of MySQL 8.3
+	tagged := info.Flavor != xmysql.FlavorMariaDB && info.Version.AtLeast(8, 3, 0)
+
+	executed, err := xmysql.GTIDExecuted(db)
+	xt.OK(t, err)
+
+	conn, err := db.Conn(ctx)
+	xt.OK(t, err)
+	defer func() { _ = conn.Close() }()
+
+	statements := []string{"INSERT INTO items VALUES (1, 'widget')"}
+	if tagged {
+		statements = append(statements,
+			"SET gtid_next = 'AUTOMATIC:xmysql'",
+			"INSERT INTO items VALUES (2, 'gadget')",
+			"SET gtid_next = 'AUTOMATIC'",
+		)
+	}
+	for _, q := range statements {
+		_, err := conn.ExecContext(ctx, q)
+		xt.OK(t, err, q)
+	}
+
+	stream, err := NewStream(ctx, dsn, &StreamOptions{GTIDSet: &executed})
+	xt.OK(t, err)
+	defer func() { _ = stream.Close() }()
+	deadline, _ := ctx.Deadline()
+	xt.OK(t, stream.conn.netConn.SetReadDeadline(deadline))
+
+	// events preceding the format description event are not stored in the
+	// binary log file
+	want := 1
+	if tagged {
+		want = 2
+	}
+	file := append([]byte{}, Magic...)
+	for started := false; want > 0; {
+		data, err := stream.conn.readEvent()
+		xt.OK(t, err)
+
+		e, err := stream.decoder.Decode(data)
+		xt.OK(t, err)
+		if _, ok := e.(*FormatDescriptionEvent); ok {
+			started = true
+		}
+		if !started {
+			continue
+		}
+		file = append(file, data...)
+
+		if rows, ok := e.(*RowsEvent); ok && rows.Table.Schema == schema {
+			want--
+		}
+	}
+
+	var gtids []*GTIDEvent
+	var rows []*RowsEvent
+	var current *GTIDEvent
+	for _, e := range readAll(t, file) {
+		switch e := e.(type) {
+		case *GTIDEvent:
+			current = e
+		case *RowsEvent:
+			if e.Table.Schema == schema {
+				gtids = append(gtids, current)
+				rows = append(rows, e)
+			}
+		}
+	}
+
+	xt.Eq(t, EventWriteRows, rows[0].Header.Type)
+	xt.Eq(t, "items", rows[0].Table.Table)
+	xt.Eq(t, []any{uint64(1), "widget"}, rows[0].Rows[0].After)
+	xt.Eq(t, EventGTID, gtids[0].Header.Type)
+	xt.Eq(t, info.ServerUUID, gtids[0].UUID)
+	xt.Eq(t, "", gtids[0].Tag)
+	xt.Assert(t, !gtids[0].CommitTimestamp.IsZero())
+
+	if tagged {
+		xt.Eq(t, []any{uint64(2), "gadget"}, rows[1].Rows[0].After)
+		xt.Eq(t, EventGTIDTagged, gtids[1].Header.Type)
+		xt.Eq(t, info.ServerUUID, gtids[1].UUID)
+		xt.Eq(t, "xmysql", gtids[1].Tag)
+		xt.Assert(t, gtids[1].GNO > 0)
+	}
+}
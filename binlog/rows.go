@@ -0,0 +1,396 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the type of a column as stored in the binary log.
+type ColumnType byte
+
+// Column types as defined by MySQL.
+const (
+	ColumnTypeDecimal    ColumnType = 0
+	ColumnTypeTiny       ColumnType = 1
+	ColumnTypeShort      ColumnType = 2
+	ColumnTypeLong       ColumnType = 3
+	ColumnTypeFloat      ColumnType = 4
+	ColumnTypeDouble     ColumnType = 5
+	ColumnTypeNull       ColumnType = 6
+	ColumnTypeTimestamp  ColumnType = 7
+	ColumnTypeLongLong   ColumnType = 8
+	ColumnTypeInt24      ColumnType = 9
+	ColumnTypeDate       ColumnType = 10
+	ColumnTypeTime       ColumnType = 11
+	ColumnTypeDatetime   ColumnType = 12
+	ColumnTypeYear       ColumnType = 13
+	ColumnTypeNewDate    ColumnType = 14
+	ColumnTypeVarchar    ColumnType = 15
+	ColumnTypeBit        ColumnType = 16
+	ColumnTypeTimestamp2 ColumnType = 17
+	ColumnTypeDatetime2  ColumnType = 18
+	ColumnTypeTime2      ColumnType = 19
+	ColumnTypeVector     ColumnType = 242
+	ColumnTypeJSON       ColumnType = 245
+	ColumnTypeNewDecimal ColumnType = 246
+	ColumnTypeEnum       ColumnType = 247
+	ColumnTypeSet        ColumnType = 248
+	ColumnTypeTinyBlob   ColumnType = 249
+	ColumnTypeMediumBlob ColumnType = 250
+	ColumnTypeLongBlob   ColumnType = 251
+	ColumnTypeBlob       ColumnType = 252
+	ColumnTypeVarString  ColumnType = 253
+	ColumnTypeString     ColumnType = 254
+	ColumnTypeGeometry   ColumnType = 255
+)
+
+// charsetBinary is the ID of the binary collation.
+const charsetBinary = 63
+
+// isNumeric returns whether the signedness of columns of type t is stored in
+// the optional metadata of table map events.
+func (t ColumnType) isNumeric() bool {
+	switch t {
+	case ColumnTypeTiny, ColumnTypeShort, ColumnTypeInt24, ColumnTypeLong, ColumnTypeLongLong,
+		ColumnTypeFloat, ColumnTypeDouble, ColumnTypeNewDecimal:
+		return true
+	}
+	return false
+}
+
+// isCharacter returns whether the character set of columns of type t is
+// stored in the optional metadata of table map events.
+func (t ColumnType) isCharacter() bool {
+	switch t {
+	case ColumnTypeString, ColumnTypeVarString, ColumnTypeVarchar, ColumnTypeBlob:
+		return true
+	}
+	return false
+}
+
+// decodeImage decodes a row image of which present flags the columns which
+// were logged.
+func decodeImage(columns []*Column, present []byte, c *cursor) ([]any, error) {
+	var count int
+	for i := range columns {
+		if bitSet(present, i) {
+			count++
+		}
+	}
+
+	nulls := c.bytes((count + 7) / 8)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	image := make([]any, len(columns))
+	n := 0
+	for i, col := range columns {
+		if !bitSet(present, i) {
+			continue
+		}
+		isNull := bitSet(nulls, n)
+		n++
+		if isNull {
+			continue
+		}
+
+		v, err := decodeValue(col, c)
+		if err != nil {
+			name := col.Name
+			if name == "" {
+				name = "#" + strconv.Itoa(i)
+			}
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		image[i] = v
+	}
+
+	return image, nil
+}
+
+// decodeValue decodes the value of a column. Integers are returned as int64,
+// or uint64 when unsigned, DECIMAL as string, DATE and DATETIME as string
+// (they can hold values not valid for time.Time), TIMESTAMP as time.Time in
+// UTC, and TIME as time.Duration. Strings are returned as string, unless the
+// character set is binary or unknown; JSON is returned as json.RawMessage.
+func decodeValue(col *Column, c *cursor) (any, error) {
+	meta := col.Meta
+
+	var v any
+	switch col.Type {
+	case ColumnTypeTiny:
+		v = integer(c.uintN(1), 1, col.Unsigned)
+	case ColumnTypeShort:
+		v = integer(c.uintN(2), 2, col.Unsigned)
+	case ColumnTypeInt24:
+		v = integer(c.uintN(3), 3, col.Unsigned)
+	case ColumnTypeLong:
+		v = integer(c.uintN(4), 4, col.Unsigned)
+	case ColumnTypeLongLong:
+		v = integer(c.uintN(8), 8, col.Unsigned)
+	case ColumnTypeFloat:
+		v = math.Float32frombits(c.uint32())
+	case ColumnTypeDouble:
+		v = math.Float64frombits(c.uint64())
+	case ColumnTypeYear:
+		if y := c.uint8(); y > 0 {
+			v = int64(y) + 1900
+		} else {
+			v = int64(0)
+		}
+	case ColumnTypeNewDecimal:
+		precision, scale := int(meta>>8), int(meta&0xff)
+		b := c.bytes(decimalSize(precision, scale))
+		if b != nil {
+			v = decodeDecimal(b, precision, scale)
+		}
+	case ColumnTypeDate, ColumnTypeNewDate:
+		d := c.uintN(3)
+		v = fmt.Sprintf("%04d-%02d-%02d", d>>9, d>>5&15, d&31)
+	case ColumnTypeDatetime:
+		d := c.uint64()
+		date, tm := d/1000000, d%1000000
+		v = fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+			date/10000, date/100%100, date%100, tm/10000, tm/100%100, tm%100)
+	case ColumnTypeDatetime2:
+		v = decodeDatetime2(c, int(meta))
+	case ColumnTypeTimestamp:
+		v = time.Unix(int64(c.uint32()), 0).UTC()
+	case ColumnTypeTimestamp2:
+		sec := bigEndian(c.bytes(4))
+		usec := fraction(c, int(meta))
+		v = time.Unix(int64(sec), usec*1000).UTC()
+	case ColumnTypeTime:
+		t := int64(c.uintN(3))
+		if t&0x800000 != 0 {
+			t -= 1 << 24
+		}
+		sign := time.Duration(1)
+		if t < 0 {
+			sign, t = -1, -t
+		}
+		v = sign * (time.Duration(t/10000)*time.Hour + time.Duration(t/100%100)*time.Minute +
+			time.Duration(t%100)*time.Second)
+	case ColumnTypeTime2:
+		v = decodeTime2(c, int(meta))
+	case ColumnTypeBit:
+		bits := int(meta>>8)*8 + int(meta&0xff)
+		v = bigEndian(c.bytes((bits + 7) / 8))
+	case ColumnTypeVarchar, ColumnTypeVarString, ColumnTypeString:
+		n := 1
+		if meta > 255 {
+			n = 2
+		}
+		v = text(col, c.bytes(int(c.uintN(n))))
+	case ColumnTypeEnum:
+		i := c.uintN(int(meta))
+		if col.EnumValues == nil {
+			v = int64(i)
+		} else if i > 0 && int(i) <= len(col.EnumValues) {
+			v = col.EnumValues[i-1]
+		} else {
+			v = ""
+		}
+	case ColumnTypeSet:
+		bits := c.uintN(int(meta))
+		if col.SetValues == nil {
+			v = bits
+		} else {
+			var members []string
+			for i, name := range col.SetValues {
+				if bits&(1<<i) != 0 {
+					members = append(members, name)
+				}
+			}
+			v = strings.Join(members, ",")
+		}
+	case ColumnTypeBlob, ColumnTypeTinyBlob, ColumnTypeMediumBlob, ColumnTypeLongBlob:
+		v = text(col, c.bytes(int(c.uintN(int(meta)))))
+	case ColumnTypeGeometry, ColumnTypeVector:
+		v = append([]byte{}, c.bytes(int(c.uintN(int(meta))))...)
+	case ColumnTypeJSON:
+		b := c.bytes(int(c.uintN(int(meta))))
+		if c.err == nil {
+			doc, err := decodeJSON(b)
+			if err != nil {
+				return nil, err
+			}
+			v = doc
+		}
+	case ColumnTypeNull:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported column type %d", col.Type)
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return v, nil
+}
+
+// integer returns v, stored using size bytes, as int64, or as uint64 when
+// unsigned.
+func integer(v uint64, size int, unsigned bool) any {
+	if unsigned {
+		return v
+	}
+	shift := 64 - 8*size
+	return int64(v<<shift) >> shift
+}
+
+func text(col *Column, b []byte) any {
+	if b == nil {
+		return nil
+	}
+	if col.Charset == 0 || col.Charset == charsetBinary {
+		return append([]byte{}, b...)
+	}
+	return string(b)
+}
+
+// fraction reads the fractional seconds stored using (fsp+1)/2 bytes, and
+// returns them as microseconds.
+func fraction(c *cursor, fsp int) int64 {
+	switch fsp {
+	case 1, 2:
+		return int64(c.uint8()) * 10000
+	case 3, 4:
+		return int64(bigEndian(c.bytes(2))) * 100
+	case 5, 6:
+		return int64(bigEndian(c.bytes(3)))
+	}
+	return 0
+}
+
+func decodeDatetime2(c *cursor, fsp int) string {
+	packed := int64(bigEndian(c.bytes(5))) - 0x8000000000
+	usec := fraction(c, fsp)
+
+	if packed < 0 {
+		// negative values are not valid DATETIME values
+		packed = -packed
+	}
+	ymd, hms := packed>>17, packed&(1<<17-1)
+	ym := ymd >> 5
+
+	s := fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+		ym/13, ym%13, ymd&31, hms>>12, hms>>6&63, hms&63)
+	return s + fractionString(usec, fsp)
+}
+
+func fractionString(usec int64, fsp int) string {
+	if fsp == 0 {
+		return ""
+	}
+	return "." + fmt.Sprintf("%06d", usec)[:fsp]
+}
+
+func decodeTime2(c *cursor, fsp int) time.Duration {
+	const (
+		intOffset  = 0x800000
+		fullOffset = 0x800000000000
+	)
+
+	var packed int64
+	switch fsp {
+	case 1, 2:
+		intPart := int64(bigEndian(c.bytes(3))) - intOffset
+		frac := int64(c.uint8())
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x100
+		}
+		packed = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart := int64(bigEndian(c.bytes(3))) - intOffset
+		frac := int64(bigEndian(c.bytes(2)))
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		packed = intPart<<24 + frac*100
+	case 5, 6:
+		packed = int64(bigEndian(c.bytes(6))) - fullOffset
+	default:
+		packed = (int64(bigEndian(c.bytes(3))) - intOffset) << 24
+	}
+
+	sign := time.Duration(1)
+	if packed < 0 {
+		sign, packed = -1, -packed
+	}
+
+	hms := packed >> 24
+	d := time.Duration(hms>>12&1023)*time.Hour + time.Duration(hms>>6&63)*time.Minute +
+		time.Duration(hms&63)*time.Second + time.Duration(packed&(1<<24-1))*time.Microsecond
+
+	return sign * d
+}
+
+// decimalDigitBytes is the number of bytes needed to store a group of
+// decimal digits with fewer than 9 digits.
+var decimalDigitBytes = [...]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+func decimalSize(precision, scale int) int {
+	intg := precision - scale
+	return intg/9*4 + decimalDigitBytes[intg%9] + scale/9*4 + decimalDigitBytes[scale%9]
+}
+
+// decodeDecimal decodes the binary representation of a DECIMAL value. The
+// result is a string to not lose precision.
+func decodeDecimal(data []byte, precision, scale int) string {
+	b := append([]byte{}, data...)
+
+	negative := b[0]&0x80 == 0
+	b[0] ^= 0x80
+	if negative {
+		for i := range b {
+			b[i] ^= 0xff
+		}
+	}
+
+	intg := precision - scale
+	var s strings.Builder
+	if negative {
+		s.WriteByte('-')
+	}
+
+	pos := 0
+	next := func(n int) uint64 {
+		v := bigEndian(b[pos : pos+n])
+		pos += n
+		return v
+	}
+
+	var digits strings.Builder
+	if n := decimalDigitBytes[intg%9]; n > 0 {
+		digits.WriteString(strconv.FormatUint(next(n), 10))
+	}
+	for i := 0; i < intg/9; i++ {
+		fmt.Fprintf(&digits, "%09d", next(4))
+	}
+	integral := strings.TrimLeft(digits.String(), "0")
+	if integral == "" {
+		integral = "0"
+	}
+	s.WriteString(integral)
+
+	if scale > 0 {
+		s.WriteByte('.')
+		for i := 0; i < scale/9; i++ {
+			fmt.Fprintf(&s, "%09d", next(4))
+		}
+		if n := scale % 9; n > 0 {
+			fmt.Fprintf(&s, "%0*d", n, next(decimalDigitBytes[n]))
+		}
+	}
+
+	return s.String()
+}
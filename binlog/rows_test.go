@@ -0,0 +1,101 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xt"
+)
+
+func TestDecodeDecimal(t *testing.T) {
+	var cases = map[string]struct {
+		data      []byte
+		precision int
+		scale     int
+		exp       string
+	}{
+		"positive":       {data: []byte{0x80, 0x00, 0x04, 0xd2, 0x32}, precision: 10, scale: 2, exp: "1234.50"},
+		"negative":       {data: []byte{0x7f, 0xff, 0xfb, 0x2d, 0xcd}, precision: 10, scale: 2, exp: "-1234.50"},
+		"zero":           {data: []byte{0x80, 0x00, 0x00, 0x00, 0x00}, precision: 10, scale: 2, exp: "0.00"},
+		"no scale":       {data: []byte{0x80, 0x00, 0x2a}, precision: 5, scale: 0, exp: "42"},
+		"only fraction":  {data: []byte{0x85}, precision: 2, scale: 2, exp: "0.05"},
+		"nine digits":    {data: []byte{0x87, 0x5b, 0xcd, 0x15, 0x00, 0x7b}, precision: 12, scale: 3, exp: "123456789.123"},
+		"multiple words": {data: []byte{0x80, 0x00, 0x00, 0x01, 0x07, 0x5b, 0xcd, 0x15}, precision: 18, scale: 0, exp: "1123456789"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			xt.Eq(t, len(c.data), decimalSize(c.precision, c.scale))
+			xt.Eq(t, c.exp, decodeDecimal(c.data, c.precision, c.scale))
+		})
+	}
+}
+
+func TestDecodeValue_temporal(t *testing.T) {
+	t.Run("DATETIME2", func(t *testing.T) {
+		c := &cursor{data: testDatetime2(2023, 1, 31, 23, 59, 0, 10)}
+		xt.Eq(t, "2023-01-31 23:59:00.010", decodeDatetime2(c, 3))
+		xt.OK(t, c.err)
+	})
+
+	t.Run("TIME2", func(t *testing.T) {
+		var cases = map[string]struct {
+			data []byte
+			fsp  int
+			exp  time.Duration
+		}{
+			"positive":          {data: []byte{0x80, 0x10, 0x83}, exp: time.Hour + 2*time.Minute + 3*time.Second},
+			"negative":          {data: []byte{0x7f, 0xf0, 0x00}, exp: -time.Hour},
+			"fraction":          {data: []byte{0x80, 0x10, 0x00, 0x32}, fsp: 2, exp: time.Hour + 500*time.Millisecond},
+			"negative fraction": {data: []byte{0x7f, 0xff, 0xff, 0xce}, fsp: 2, exp: -500 * time.Millisecond},
+			"microseconds":      {data: []byte{0x80, 0x00, 0x01, 0x00, 0x00, 0x07}, fsp: 6, exp: time.Second + 7*time.Microsecond},
+		}
+
+		for name, c := range cases {
+			t.Run(name, func(t *testing.T) {
+				cur := &cursor{data: c.data}
+				xt.Eq(t, c.exp, decodeTime2(cur, c.fsp))
+				xt.OK(t, cur.err)
+				xt.Eq(t, 0, cur.remaining())
+			})
+		}
+	})
+
+	t.Run("DATE", func(t *testing.T) {
+		v, err := decodeValue(&Column{Type: ColumnTypeDate}, &cursor{data: []byte{0x45, 0xcf, 0x0f}})
+		xt.OK(t, err)
+		xt.Eq(t, "2023-10-05", v)
+	})
+}
+
+func TestDecodeValue(t *testing.T) {
+	t.Run("integers", func(t *testing.T) {
+		v, err := decodeValue(&Column{Type: ColumnTypeInt24}, &cursor{data: []byte{0xff, 0xff, 0xff}})
+		xt.OK(t, err)
+		xt.Eq(t, int64(-1), v)
+
+		v, err = decodeValue(&Column{Type: ColumnTypeInt24, Unsigned: true}, &cursor{data: []byte{0xff, 0xff, 0xff}})
+		xt.OK(t, err)
+		xt.Eq(t, uint64(16777215), v)
+	})
+
+	t.Run("SET", func(t *testing.T) {
+		col := &Column{Type: ColumnTypeSet, Meta: 1, SetValues: []string{"a", "b", "c"}}
+		v, err := decodeValue(col, &cursor{data: []byte{0x05}})
+		xt.OK(t, err)
+		xt.Eq(t, "a,c", v)
+	})
+
+	t.Run("BIT", func(t *testing.T) {
+		v, err := decodeValue(&Column{Type: ColumnTypeBit, Meta: 0x0102}, &cursor{data: []byte{0x01, 0x02}})
+		xt.OK(t, err)
+		xt.Eq(t, uint64(0x0102), v)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := decodeValue(&Column{Type: ColumnTypeVarchar, Meta: 10}, &cursor{data: []byte{0x05, 'a'}})
+		xt.KO(t, err)
+	})
+}
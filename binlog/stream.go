@@ -0,0 +1,397 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/golistic/xmysql"
+)
+
+// ChangeType is the kind of change made to a row.
+type ChangeType string
+
+const (
+	ChangeInsert ChangeType = "insert"
+	ChangeUpdate ChangeType = "update"
+	ChangeDelete ChangeType = "delete"
+)
+
+// RowChange is a change made to a row by a transaction.
+type RowChange struct {
+	Type   ChangeType
+	Schema string
+	Table  string
+	// Columns describes the columns of the images as found in the table map
+	// event; see Column.
+	Columns []*Column
+	// Before is the row before the change, and is nil for inserts.
+	Before []any
+	// After is the row after the change, and is nil for deletes.
+	After []any
+	// GTID is the global transaction identifier of the transaction which
+	// made the change, formatted as uuid:number, or uuid:tag:number for
+	// tagged GTIDs.
+	GTID string
+	// Timestamp is the time the change was logged by the source.
+	Timestamp time.Time
+	// LogFile and LogPos locate the rows event within the binary logs of
+	// the server.
+	LogFile string
+	LogPos  uint32
+}
+
+// StreamOptions configures a Stream.
+type StreamOptions struct {
+	// ServerID identifies the stream as replica and must be unique among all
+	// servers and replicas of the replication topology. When 0, a random ID
+	// is used.
+	ServerID uint32
+	// GTIDSet holds the transactions already processed; only transactions
+	// not in the set are streamed. Use Stream.GTIDSet to resume a stream. When
+	// nil, the stream starts with the transactions committed after it was
+	// opened, using the gtid_executed variable of the server.
+	GTIDSet *xmysql.GTIDSet
+	// Filter reports whether the changes of a table are streamed. When nil,
+	// changes of all tables are streamed.
+	Filter func(schema, table string) bool
+	// Heartbeat is the interval at which the server sends heartbeats while
+	// there are no events. When no data is received for three times this
+	// interval, the connection is considered lost. Defaults to 30 seconds.
+	Heartbeat time.Duration
+}
+
+// Stream streams the changes made to rows using the replication protocol.
+// The server must use row-based binary logging (binlog_format=ROW) with
+// GTIDs enabled (gtid_mode=ON). The user needs the REPLICATION SLAVE
+// privilege (and REPLICATION CLIENT, or SELECT on performance_schema, to
+// read the checksum algorithm and executed GTIDs).
+//
+// Changes are delivered at least once: when a stream is resumed using
+// GTIDSet, transactions of which not all changes were consumed are
+// streamed again.
+type Stream struct {
+	conn      *conn
+	decoder   *Decoder
+	opts      StreamOptions
+	heartbeat time.Duration
+
+	executed xmysql.GTIDSet
+	current  *GTIDEvent
+	logFile  string
+	pending  []*RowChange
+	err      error
+}
+
+// NewStream connects to the server using the data source name dsn, as used
+// by the go-sql-driver/mysql driver, registers as replica, and requests the
+// binary log from the transactions not in opts.GTIDSet.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func NewStream(ctx context.Context, dsn string, opts *StreamOptions) (*Stream, error) {
+	o := StreamOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Heartbeat <= 0 {
+		o.Heartbeat = 30 * time.Second
+	}
+	if o.ServerID == 0 {
+		o.ServerID = randomServerID()
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("binlog: %w", err)
+	}
+
+	checksum, executed, err := streamSetup(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if o.GTIDSet != nil {
+		executed = *o.GTIDSet
+	}
+
+	gtids, err := encodeGTIDSet(executed)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := dial(ctx, cfg)
+	if err != nil {
+		return nil, xmysql.NewError(err)
+	}
+
+	statements := []string{
+		"SET @master_binlog_checksum = @@global.binlog_checksum, @source_binlog_checksum = @@global.binlog_checksum",
+		fmt.Sprintf("SET @master_heartbeat_period = %d, @source_heartbeat_period = %[1]d", o.Heartbeat.Nanoseconds()),
+		"SET @slave_uuid = UUID(), @replica_uuid = @slave_uuid",
+	}
+	for _, q := range statements {
+		if err := c.exec(q); err != nil {
+			_ = c.Close()
+			return nil, xmysql.NewErrorQuery(err, q, nil)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	if err := c.registerReplica(o.ServerID, hostname); err != nil {
+		_ = c.Close()
+		return nil, xmysql.NewError(err)
+	}
+
+	if err := c.dumpGTID(o.ServerID, gtids); err != nil {
+		_ = c.Close()
+		return nil, xmysql.NewError(err)
+	}
+
+	decoder := NewDecoder()
+	decoder.SetChecksum(checksum)
+
+	return &Stream{
+		conn:      c,
+		decoder:   decoder,
+		opts:      o,
+		heartbeat: o.Heartbeat,
+		executed:  executed,
+	}, nil
+}
+
+// streamSetup returns the checksum algorithm used by the server, and the
+// GTIDs of the transactions it executed.
+func streamSetup(ctx context.Context, dsn string) (byte, xmysql.GTIDSet, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return 0, xmysql.GTIDSet{}, xmysql.NewError(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var checksum string
+	q := "SELECT @@global.binlog_checksum"
+	if err := db.QueryRowContext(ctx, q).Scan(&checksum); err != nil {
+		return 0, xmysql.GTIDSet{}, xmysql.NewErrorQuery(err, q, nil)
+	}
+
+	executed, err := xmysql.GTIDExecuted(db)
+	if err != nil {
+		return 0, xmysql.GTIDSet{}, err
+	}
+
+	if strings.EqualFold(checksum, "CRC32") {
+		return ChecksumCRC32, executed, nil
+	}
+	return ChecksumNone, executed, nil
+}
+
+func randomServerID() uint32 {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	// stay clear of the IDs commonly used for servers
+	return binary.LittleEndian.Uint32(b)>>2 | 1<<30
+}
+
+// encodeGTIDSet encodes set as expected by COM_BINLOG_DUMP_GTID. Intervals
+// are stored with an exclusive end. Sets holding tagged GTIDs use the format
+// introduced with MySQL 8.3: the number of sources is stored between two
+// bytes holding the format, and each UUID is followed by its tag.
+func encodeGTIDSet(set xmysql.GTIDSet) ([]byte, error) {
+	const formatTagged = 1
+
+	uuids := set.UUIDs()
+
+	var sources uint64
+	tagged := false
+	for _, uuid := range uuids {
+		for _, tag := range set.Tags(uuid) {
+			sources++
+			tagged = tagged || tag != ""
+		}
+	}
+
+	header := sources
+	if tagged {
+		header = formatTagged<<56 | sources<<8 | formatTagged
+	}
+
+	data := binary.LittleEndian.AppendUint64(nil, header)
+	for _, uuid := range uuids {
+		b, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+		if err != nil {
+			return nil, fmt.Errorf("binlog: invalid UUID %s", uuid)
+		}
+
+		for _, tag := range set.Tags(uuid) {
+			data = append(data, b...)
+			if tagged {
+				// tags are at most 32 characters, so their length is
+				// stored using a single byte
+				data = append(append(data, byte(len(tag))<<1), tag...)
+			}
+
+			intervals := set.Intervals(uuid, tag)
+			data = binary.LittleEndian.AppendUint64(data, uint64(len(intervals)))
+			for _, iv := range intervals {
+				data = binary.LittleEndian.AppendUint64(data, iv.Start)
+				data = binary.LittleEndian.AppendUint64(data, iv.End+1)
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// Next returns the next row change. It blocks until a change is available,
+// ctx is done, or the connection fails. Once an error is returned, the
+// stream cannot be used anymore and Next keeps returning the error; use
+// GTIDSet to open a new stream resuming where this one left off. It returns
+// io.EOF when the server ended the stream.
+func (s *Stream) Next(ctx context.Context) (*RowChange, error) {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+
+		event, err := s.nextEvent(ctx)
+		if err != nil {
+			s.err = err
+			_ = s.conn.Close()
+			return nil, err
+		}
+
+		s.process(event)
+	}
+
+	change := s.pending[0]
+	s.pending = s.pending[1:]
+	return change, nil
+}
+
+// Changes returns an iterator over the row changes, which stops after the
+// first error is yielded. With Go 1.23 and later, it can be used with the
+// range clause:
+//
+//	for change, err := range stream.Changes(ctx) { ... }
+func (s *Stream) Changes(ctx context.Context) func(yield func(*RowChange, error) bool) {
+	return func(yield func(*RowChange, error) bool) {
+		for {
+			change, err := s.Next(ctx)
+			if !yield(change, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// GTIDSet returns the GTIDs of the transactions of which all changes were
+// returned by Next and of which the commit was received, including those in
+// StreamOptions.GTIDSet.
+func (s *Stream) GTIDSet() xmysql.GTIDSet {
+	return s.executed
+}
+
+// Close closes the connection with the server.
+func (s *Stream) Close() error {
+	if s.err == nil {
+		s.err = errors.New("binlog: stream closed")
+		return s.conn.Close()
+	}
+	return nil
+}
+
+func (s *Stream) nextEvent(ctx context.Context) (Event, error) {
+	deadline := time.Now().Add(3 * s.heartbeat)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = s.conn.netConn.SetReadDeadline(deadline)
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = s.conn.netConn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	data, err := s.conn.readEvent()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, xmysql.NewError(err)
+	}
+
+	return s.decoder.Decode(data)
+}
+
+// process handles an event, adding the row changes it holds to the pending
+// changes, and keeping track of the executed transactions.
+func (s *Stream) process(event Event) {
+	switch e := event.(type) {
+	case *RotateEvent:
+		s.logFile = e.NextFile
+	case *GTIDEvent:
+		s.current = e
+	case *XIDEvent:
+		s.commit()
+	case *QueryEvent:
+		// DDL, and transactions on non-transactional tables, are not
+		// concluded with an XID event
+		if e.Query != "BEGIN" {
+			s.commit()
+		}
+	case *RowsEvent:
+		table := e.Table
+		if s.opts.Filter != nil && !s.opts.Filter(table.Schema, table.Table) {
+			return
+		}
+
+		changeType := ChangeUpdate
+		switch e.Header.Type {
+		case EventWriteRows, EventWriteRowsV1:
+			changeType = ChangeInsert
+		case EventDeleteRows, EventDeleteRowsV1:
+			changeType = ChangeDelete
+		}
+
+		gtid := ""
+		if s.current != nil {
+			gtid = s.current.GTID()
+		}
+
+		for _, row := range e.Rows {
+			s.pending = append(s.pending, &RowChange{
+				Type:      changeType,
+				Schema:    table.Schema,
+				Table:     table.Table,
+				Columns:   table.Columns,
+				Before:    row.Before,
+				After:     row.After,
+				GTID:      gtid,
+				Timestamp: e.Header.Timestamp,
+				LogFile:   s.logFile,
+				LogPos:    e.Header.LogPos,
+			})
+		}
+	}
+}
+
+func (s *Stream) commit() {
+	if s.current != nil && s.current.UUID != "" {
+		s.executed = s.executed.Add(s.current.UUID, s.current.Tag, uint64(s.current.GNO))
+	}
+	s.current = nil
+}
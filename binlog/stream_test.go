@@ -0,0 +1,362 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package binlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golistic/xgo/xt"
+
+	"github.com/golistic/xmysql"
+	"github.com/golistic/xmysql/xmysqltest"
+)
+
+func TestEncodeGTIDSet(t *testing.T) {
+	t.Run("intervals", func(t *testing.T) {
+		data, err := encodeGTIDSet(xmysql.MustParseGTIDSet(testUUID + ":1-5:7"))
+		xt.OK(t, err)
+		xt.Eq(t, "0100000000000000"+
+			"3e11fa4771ca11e19e33c80aa9429562"+
+			"0200000000000000"+
+			"0100000000000000"+"0600000000000000"+
+			"0700000000000000"+"0800000000000000",
+			hex.EncodeToString(data))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		data, err := encodeGTIDSet(xmysql.GTIDSet{})
+		xt.OK(t, err)
+		xt.Eq(t, make([]byte, 8), data)
+	})
+
+	t.Run("tagged", func(t *testing.T) {
+		data, err := encodeGTIDSet(xmysql.MustParseGTIDSet(testUUID + ":1-5:batch:1"))
+		xt.OK(t, err)
+		xt.Eq(t, "0102000000000001"+
+			"3e11fa4771ca11e19e33c80aa9429562"+"00"+
+			"0100000000000000"+
+			"0100000000000000"+"0600000000000000"+
+			"3e11fa4771ca11e19e33c80aa9429562"+"0a"+hex.EncodeToString([]byte("batch"))+
+			"0100000000000000"+
+			"0100000000000000"+"0200000000000000",
+			hex.EncodeToString(data))
+	})
+}
+
+func TestScramble(t *testing.T) {
+	scramble := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+
+	xt.Eq(t, "b32bb3a583e1340c0a1108d58b1be49781ad8c2f",
+		hex.EncodeToString(scrambleNativePassword(scramble, "secret")))
+	xt.Eq(t, "746ebe205d56a0707acb3e796e834e0dd7b1d61743b26bd5202c7a623230c7c9",
+		hex.EncodeToString(scrambleSHA256Password(scramble, "secret")))
+
+}
+
+func TestAuthResponse(t *testing.T) {
+	scramble := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+
+	cfg := mysql.NewConfig()
+	cfg.Passwd = "secret"
+
+	t.Run("empty password", func(t *testing.T) {
+		resp, err := authResponse(&mysql.Config{}, "caching_sha2_password", scramble, false)
+		xt.OK(t, err)
+		xt.Eq(t, 0, len(resp))
+	})
+
+	t.Run("native passwords", func(t *testing.T) {
+		resp, err := authResponse(cfg, "mysql_native_password", scramble, false)
+		xt.OK(t, err)
+		xt.Eq(t, scrambleNativePassword(scramble, "secret"), resp)
+
+		disallowed := *cfg
+		disallowed.AllowNativePasswords = false
+		_, err = authResponse(&disallowed, "mysql_native_password", scramble, false)
+		xt.Assert(t, errors.Is(err, mysql.ErrNativePassword))
+	})
+
+	t.Run("cleartext passwords", func(t *testing.T) {
+		_, err := authResponse(cfg, "mysql_clear_password", scramble, true)
+		xt.Assert(t, errors.Is(err, mysql.ErrCleartextPassword))
+
+		allowed := *cfg
+		allowed.AllowCleartextPasswords = true
+		_, err = authResponse(&allowed, "mysql_clear_password", scramble, false)
+		xt.KO(t, err)
+		xt.Eq(t, "binlog: mysql_clear_password requires TLS", err.Error())
+
+		resp, err := authResponse(&allowed, "mysql_clear_password", scramble, true)
+		xt.OK(t, err)
+		xt.Eq(t, []byte("secret\x00"), resp)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := authResponse(cfg, "authentication_ldap_sasl", scramble, false)
+		xt.KO(t, err)
+	})
+}
+
+// testHandshake returns the initial handshake packet of a server with the
+// given capabilities, using mysql_native_password.
+func testHandshake(capabilities uint32) []byte {
+	data := append([]byte{10}, "8.0.34\x00"...)
+	data = append(data, 1, 0, 0, 0)        // connection ID
+	data = append(data, "abcdefgh\x00"...) // scramble, first part
+	data = binary.LittleEndian.AppendUint16(data, uint16(capabilities))
+	data = append(data, charsetUTF8MB4, 2, 0) // character set, status
+	data = binary.LittleEndian.AppendUint16(data, uint16(capabilities>>16))
+	data = append(data, 21)
+	data = append(data, make([]byte, 10)...)
+	data = append(data, "ijklmnopqrst\x00"...) // scramble, second part
+	return append(data, "mysql_native_password\x00"...)
+}
+
+func TestConn_handshake(t *testing.T) {
+	serve := func(server net.Conn, capabilities uint32) <-chan []byte {
+		responses := make(chan []byte, 1)
+		go func() {
+			defer func() { _ = server.Close() }()
+			defer close(responses)
+
+			s := &conn{netConn: server}
+			if err := s.writePacket(testHandshake(capabilities)); err != nil {
+				return
+			}
+			resp, err := s.readPacket()
+			if err != nil {
+				return
+			}
+			responses <- resp
+			_ = s.writePacket([]byte{0x00, 0, 0, 2, 0, 0, 0})
+		}()
+		return responses
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = "repl"
+	cfg.Passwd = "secret"
+	cfg.TLS = &tls.Config{InsecureSkipVerify: true}
+	capabilities := uint32(clientProtocol41 | clientSecureConnection | clientPluginAuth)
+
+	t.Run("TLS not supported", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer func() { _ = client.Close() }()
+		serve(server, capabilities)
+
+		c := &conn{netConn: client}
+		err := c.handshake(cfg)
+		xt.KO(t, err)
+		xt.Eq(t, "binlog: server does not support TLS", err.Error())
+	})
+
+	t.Run("truncated handshake", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer func() { _ = client.Close() }()
+
+		go func() {
+			s := &conn{netConn: server}
+			data := testHandshake(capabilities)
+			_ = s.writePacket(data[:len(data)-40])
+		}()
+
+		c := &conn{netConn: client}
+		err := c.handshake(cfg)
+		xt.KO(t, err)
+		xt.MatchString(t, `^binlog: malformed handshake: `, err.Error())
+	})
+
+	t.Run("fallback to plaintext", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer func() { _ = client.Close() }()
+		responses := serve(server, capabilities)
+
+		preferred := *cfg
+		preferred.AllowFallbackToPlaintext = true
+		c := &conn{netConn: client}
+		xt.OK(t, c.handshake(&preferred))
+
+		resp := <-responses
+		xt.Assert(t, binary.LittleEndian.Uint32(resp)&clientSSL == 0)
+		xt.Assert(t, bytes.Contains(resp, []byte("repl\x00")))
+	})
+}
+
+func TestConn_readEvent(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+
+	go func() {
+		for seq, payload := range [][]byte{
+			{0x00, 'e', 'v'},
+			append([]byte{0xff, 0xc4, 0x04, '#'}, "HY000Could not find first log file name"...),
+		} {
+			_, _ = server.Write(append([]byte{byte(len(payload)), 0, 0, byte(seq)}, payload...))
+		}
+		_ = server.Close()
+	}()
+
+	c := &conn{netConn: client}
+
+	data, err := c.readEvent()
+	xt.OK(t, err)
+	xt.Eq(t, []byte("ev"), data)
+
+	_, err = c.readEvent()
+	var myErr *mysql.MySQLError
+	xt.Assert(t, errors.As(err, &myErr))
+	xt.Eq(t, uint16(1220), myErr.Number)
+	xt.Eq(t, "HY000", string(myErr.SQLState[:]))
+	xt.Eq(t, "Could not find first log file name", myErr.Message)
+}
+
+func processAll(t *testing.T, s *Stream, data []byte) {
+	t.Helper()
+
+	r, err := NewReader(bytes.NewReader(data))
+	xt.OK(t, err)
+
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return
+		}
+		xt.OK(t, err)
+		s.process(e)
+	}
+}
+
+func TestStream_process(t *testing.T) {
+	b := newTestBinlog()
+	b.transaction()
+
+	t.Run("all tables", func(t *testing.T) {
+		s := &Stream{logFile: "binlog.000001"}
+		processAll(t, s, b.buf.Bytes())
+
+		xt.Eq(t, 3, len(s.pending))
+		var types []ChangeType
+		for _, c := range s.pending {
+			types = append(types, c.Type)
+			xt.Eq(t, testUUID+":7", c.GTID)
+			xt.Eq(t, "shop", c.Schema)
+			xt.Eq(t, "items", c.Table)
+			xt.Eq(t, "binlog.000001", c.LogFile)
+		}
+		xt.Eq(t, []ChangeType{ChangeInsert, ChangeUpdate, ChangeDelete}, types)
+		xt.Assert(t, s.pending[0].Before == nil)
+		xt.Eq(t, "hi", s.pending[1].After[10])
+		xt.Assert(t, s.pending[2].After == nil)
+
+		xt.Eq(t, testUUID+":7", s.GTIDSet().String())
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		s := &Stream{
+			executed: xmysql.MustParseGTIDSet(testUUID + ":1-6"),
+			opts: StreamOptions{Filter: func(schema, table string) bool {
+				return table != "items"
+			}},
+		}
+		processAll(t, s, b.buf.Bytes())
+
+		xt.Eq(t, 0, len(s.pending))
+		xt.Eq(t, testUUID+":1-7", s.GTIDSet().String())
+	})
+
+	t.Run("tagged", func(t *testing.T) {
+		b := newTestBinlog()
+		b.taggedTransaction("batch", 3)
+		b.tableMap()
+		b.rows(EventWriteRows, testRowImage(1, nil))
+		b.event(EventXID, binary.LittleEndian.AppendUint64(nil, 100))
+
+		s := &Stream{executed: xmysql.MustParseGTIDSet(testUUID + ":1-7")}
+		processAll(t, s, b.buf.Bytes())
+
+		xt.Eq(t, 1, len(s.pending))
+		xt.Eq(t, testUUID+":batch:3", s.pending[0].GTID)
+		xt.Eq(t, testUUID+":1-7:batch:3", s.GTIDSet().String())
+	})
+}
+
+func TestNewStream(t *testing.T) {
+	db := xmysqltest.New(t, nil)
+
+	var gtidMode, binlogFormat string
+	xt.OK(t, db.QueryRow("SELECT @@GLOBAL.gtid_mode, @@GLOBAL.binlog_format").Scan(&gtidMode, &binlogFormat))
+	if gtidMode != "ON" || binlogFormat != "ROW" {
+		t.Skip("server does not use GTIDs with row-based binary logging")
+	}
+
+	var schema string
+	xt.OK(t, db.QueryRow("SELECT DATABASE()").Scan(&schema))
+
+	_, err := db.Exec("CREATE TABLE items (id INT UNSIGNED PRIMARY KEY, name VARCHAR(20), price DECIMAL(8,2))")
+	xt.OK(t, err)
+
+	dsn := os.Getenv("XMYSQL_DSN")
+	if dsn == "" {
+		dsn = xmysqltest.DefaultDSN
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stream, err := NewStream(ctx, dsn, &StreamOptions{
+		Filter: func(s, _ string) bool { return s == schema },
+	})
+	xt.OK(t, err)
+	defer func() { _ = stream.Close() }()
+
+	for _, q := range []string{
+		"INSERT INTO items VALUES (1, 'widget', 9.95)",
+		"UPDATE items SET price = 12.50 WHERE id = 1",
+		"DELETE FROM items WHERE id = 1",
+	} {
+		_, err := db.Exec(q)
+		xt.OK(t, err)
+	}
+
+	var changes []*RowChange
+	stream.Changes(ctx)(func(change *RowChange, err error) bool {
+		xt.OK(t, err)
+		changes = append(changes, change)
+		return len(changes) < 3
+	})
+
+	xt.Eq(t, ChangeInsert, changes[0].Type)
+	xt.Eq(t, "items", changes[0].Table)
+	xt.Eq(t, []any{uint64(1), "widget", "9.95"}, changes[0].After)
+	xt.Eq(t, ChangeUpdate, changes[1].Type)
+	xt.Eq(t, "12.50", changes[1].After[2])
+	xt.Eq(t, ChangeDelete, changes[2].Type)
+	xt.Assert(t, changes[2].GTID != "")
+
+	t.Run("resume", func(t *testing.T) {
+		// the commit of the last transaction was not yet received
+		executed := stream.GTIDSet()
+		resumed, err := NewStream(ctx, dsn, &StreamOptions{
+			GTIDSet: &executed,
+			Filter:  func(s, _ string) bool { return s == schema },
+		})
+		xt.OK(t, err)
+		defer func() { _ = resumed.Close() }()
+
+		change, err := resumed.Next(ctx)
+		xt.OK(t, err)
+		xt.Eq(t, ChangeDelete, change.Type)
+		xt.Eq(t, changes[2].GTID, change.GTID)
+	})
+}
@@ -0,0 +1,364 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BulkMode defines how rows conflicting with existing rows on a primary key
+// or unique index are handled by BulkInserter.
+type BulkMode string
+
+const (
+	// BulkModeInsert uses INSERT; conflicting rows cause an error.
+	BulkModeInsert BulkMode = "INSERT"
+	// BulkModeIgnore uses INSERT IGNORE; conflicting rows are skipped.
+	BulkModeIgnore BulkMode = "INSERT IGNORE"
+	// BulkModeReplace uses REPLACE; conflicting rows are replaced.
+	BulkModeReplace BulkMode = "REPLACE"
+	// BulkModeUpdate uses INSERT ... ON DUPLICATE KEY UPDATE; conflicting rows
+	// are updated.
+	BulkModeUpdate BulkMode = "ON DUPLICATE KEY UPDATE"
+)
+
+// bulkRowAlias is the alias of the inserted row used by BulkModeUpdate.
+const bulkRowAlias = "new"
+
+// bulkPacketOverhead is kept free within max_allowed_packet for the protocol.
+const bulkPacketOverhead = 1024
+
+// BulkOptions configures a BulkInserter.
+type BulkOptions struct {
+	// Schema is the schema of the table; defaults to the current schema.
+	Schema string
+	// Mode defines how conflicting rows are handled; defaults to BulkModeInsert.
+	Mode BulkMode
+	// UpdateColumns are the columns set using the inserted values when
+	// Mode is BulkModeUpdate; defaults to all columns.
+	UpdateColumns []string
+	// MaxStatementSize is the maximum size in bytes of a statement. It
+	// defaults to, and cannot exceed, the max_allowed_packet global variable.
+	MaxStatementSize int
+	// MaxRows is the maximum number of rows per statement; 0 means no limit.
+	MaxRows int
+	// Location is the time zone to which time.Time values are converted
+	// before being written. It should match the loc parameter of the data
+	// source name, so values are stored like go-sql-driver/mysql does when
+	// passed as query arguments; defaults to UTC.
+	Location *time.Location
+	// OnBatch, when not nil, is called after each executed statement.
+	OnBatch func(BulkResult)
+}
+
+// BulkResult holds the outcome of a statement executed by BulkInserter.
+type BulkResult struct {
+	// Rows is the number of rows sent.
+	Rows int
+	// Affected is the number of affected rows as reported by the server.
+	Affected int64
+	// Inserted is the number of rows added as new rows. For BulkModeReplace
+	// this is derived from Affected assuming each conflicting row conflicts
+	// with a single existing row. For BulkModeUpdate it cannot be derived,
+	// since updated rows which were left unchanged are not counted as affected,
+	// and it is always 0.
+	Inserted int64
+}
+
+// BulkInserter builds and executes multi-row INSERT (or REPLACE) statements
+// for rows added using Add. Rows are batched so that statements stay within
+// max_allowed_packet.
+type BulkInserter struct {
+	db      *sql.DB
+	opts    BulkOptions
+	columns []*Column
+	maxSize int
+	// noBackslashEscapes is whether sessions use the NO_BACKSLASH_ESCAPES
+	// SQL mode, which changes how string literals are quoted.
+	noBackslashEscapes bool
+
+	prefix string
+	suffix string
+
+	stmt    strings.Builder
+	rows    int
+	results []BulkResult
+}
+
+// NewBulkInserter returns a BulkInserter adding rows to table using the given
+// columns. The columns are looked up, so that values are written using the
+// correct type, and the max_allowed_packet global variable is read to size
+// the statements. The version and SQL mode of the server are read so that
+// statements use the syntax it supports and literals are quoted correctly.
+// The opts can be nil in which case defaults are used.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func NewBulkInserter(db *sql.DB, table string, columns []string, opts *BulkOptions) (*BulkInserter, error) {
+	o := BulkOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Mode == "" {
+		o.Mode = BulkModeInsert
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("xmysql: bulk insert requires columns")
+	}
+
+	var schema []string
+	if o.Schema != "" {
+		schema = []string{o.Schema}
+	}
+	tableColumns, err := TableColumns(db, table, schema...)
+	if err != nil {
+		return nil, err
+	}
+	if len(tableColumns) == 0 {
+		return nil, fmt.Errorf("xmysql: table %s does not exist", table)
+	}
+
+	byName := map[string]*Column{}
+	for _, c := range tableColumns {
+		byName[strings.ToLower(c.Name)] = c
+	}
+
+	b := &BulkInserter{
+		db:   db,
+		opts: o,
+	}
+
+	quoted := make([]string, len(columns))
+	for i, name := range columns {
+		c, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("xmysql: table %s has no column %s", table, name)
+		}
+		b.columns = append(b.columns, c)
+		quoted[i] = QuoteIdentifier(c.Name)
+	}
+
+	v, err := GlobalVariable(db, "max_allowed_packet")
+	if err != nil {
+		return nil, NewError(err)
+	}
+	packet, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("xmysql: invalid max_allowed_packet %q", v)
+	}
+	b.maxSize = packet - bulkPacketOverhead
+	if o.MaxStatementSize > 0 && o.MaxStatementSize < b.maxSize {
+		b.maxSize = o.MaxStatementSize
+	}
+
+	name := QuoteIdentifier(table)
+	if o.Schema != "" {
+		name = QuoteIdentifier(o.Schema) + "." + name
+	}
+
+	if b.noBackslashEscapes, err = noBackslashEscapes(context.Background(), db); err != nil {
+		return nil, err
+	}
+
+	switch o.Mode {
+	case BulkModeInsert, BulkModeIgnore, BulkModeReplace:
+		b.prefix = string(o.Mode)
+	case BulkModeUpdate:
+		b.prefix = string(BulkModeInsert)
+
+		update := o.UpdateColumns
+		if len(update) == 0 {
+			update = columns
+		}
+
+		var version string
+		if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+			return nil, NewError(err)
+		}
+		v, err := ParseServerVersion(version)
+		rowAlias := err == nil && serverFlavor(version, "") != FlavorMariaDB && v.AtLeast(8, 0, 19)
+
+		b.suffix = bulkUpdateClause(update, rowAlias)
+	default:
+		return nil, fmt.Errorf("xmysql: unsupported bulk mode %q", o.Mode)
+	}
+
+	b.prefix += " INTO " + name + " (" + strings.Join(quoted, ", ") + ") VALUES "
+
+	return b, nil
+}
+
+// Add adds a row holding a value for each column. When the statement being
+// built would become too large, or holds the maximum number of rows, it is
+// first executed.
+// Values are converted like database/sql does for query arguments, for
+// example, using driver.Valuer.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func (b *BulkInserter) Add(ctx context.Context, values ...any) error {
+	if len(values) != len(b.columns) {
+		return fmt.Errorf("xmysql: bulk insert expects %d values; got %d", len(b.columns), len(values))
+	}
+
+	var row strings.Builder
+	row.WriteByte('(')
+	for i, v := range values {
+		if i > 0 {
+			row.WriteString(", ")
+		}
+		lit, err := goValueLiteral(b.columns[i], v, b.opts.Location, b.noBackslashEscapes)
+		if err != nil {
+			return fmt.Errorf("xmysql: bulk insert column %s: %w", b.columns[i].Name, err)
+		}
+		row.WriteString(lit)
+	}
+	row.WriteByte(')')
+
+	if len(b.prefix)+row.Len()+len(b.suffix) > b.maxSize {
+		return fmt.Errorf("xmysql: bulk insert row of %d bytes exceeds maximum statement size", row.Len())
+	}
+
+	full := b.opts.MaxRows > 0 && b.rows >= b.opts.MaxRows
+	if b.rows > 0 && (full || b.stmt.Len()+2+row.Len()+len(b.suffix) > b.maxSize) {
+		if err := b.Flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	if b.rows == 0 {
+		b.stmt.WriteString(b.prefix)
+	} else {
+		b.stmt.WriteString(", ")
+	}
+	b.stmt.WriteString(row.String())
+	b.rows++
+
+	return nil
+}
+
+// Flush executes the statement holding the rows added since the last
+// execution. No-op when there are no such rows. Flush must be called after
+// the last row was added.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func (b *BulkInserter) Flush(ctx context.Context) error {
+	if b.rows == 0 {
+		return nil
+	}
+
+	q := b.stmt.String() + b.suffix
+	rows := b.rows
+	b.stmt.Reset()
+	b.rows = 0
+
+	res, err := b.db.ExecContext(ctx, q)
+	if err != nil {
+		return NewError(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	r := BulkResult{
+		Rows:     rows,
+		Affected: affected,
+		Inserted: affected,
+	}
+
+	switch b.opts.Mode {
+	case BulkModeReplace:
+		// new rows count as 1 affected row, replaced rows as 2
+		r.Inserted = min(max(2*int64(rows)-affected, 0), int64(rows))
+	case BulkModeUpdate:
+		r.Inserted = 0
+	}
+
+	b.results = append(b.results, r)
+	if b.opts.OnBatch != nil {
+		b.opts.OnBatch(r)
+	}
+
+	return nil
+}
+
+// Results returns the results of the statements executed so far.
+func (b *BulkInserter) Results() []BulkResult {
+	return b.results
+}
+
+// Total returns the sum of the results of the statements executed so far.
+func (b *BulkInserter) Total() BulkResult {
+	var total BulkResult
+	for _, r := range b.results {
+		total.Rows += r.Rows
+		total.Affected += r.Affected
+		total.Inserted += r.Inserted
+	}
+	return total
+}
+
+// bulkUpdateClause returns the ON DUPLICATE KEY UPDATE clause setting columns
+// to the inserted values. When rowAlias is true, the inserted row is referred
+// to using an alias, as supported since MySQL 8.0.19; otherwise using the
+// VALUES() function, which is deprecated since MySQL 8.0.20.
+func bulkUpdateClause(columns []string, rowAlias bool) string {
+	assignments := make([]string, len(columns))
+	for i, c := range columns {
+		q := QuoteIdentifier(c)
+		if rowAlias {
+			assignments[i] = q + " = " + bulkRowAlias + "." + q
+		} else {
+			assignments[i] = q + " = VALUES(" + q + ")"
+		}
+	}
+
+	clause := " ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+	if rowAlias {
+		clause = " AS " + bulkRowAlias + clause
+	}
+
+	return clause
+}
+
+// goValueLiteral returns v as SQL literal for column c. Values are converted
+// like database/sql does, for example, using driver.Valuer, and time.Time
+// values are converted to loc. String literals are quoted for sessions using
+// NO_BACKSLASH_ESCAPES when noBackslashEscapes is true.
+func goValueLiteral(c *Column, v any, loc *time.Location, noBackslashEscapes bool) (string, error) {
+	if u, ok := v.(uint64); ok {
+		// not supported by the default converter when the high bit is set
+		return strconv.FormatUint(u, 10), nil
+	}
+
+	dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return "", err
+	}
+
+	if t, ok := dv.(time.Time); ok {
+		dv = t.In(loc)
+	}
+
+	// unlike values read from the server, text is never written as-is
+	if isNumericType(c.DataType) {
+		switch t := dv.(type) {
+		case string:
+			return quoteString(t, noBackslashEscapes), nil
+		case []byte:
+			return quoteString(string(t), noBackslashEscapes), nil
+		}
+	}
+
+	return sqlLiteral(c, dv, false, noBackslashEscapes), nil
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestGoValueLiteral(t *testing.T) {
+	var cases = map[string]struct {
+		column *Column
+		value  any
+		exp    string
+		expNBE string
+	}{
+		"NULL":            {column: &Column{DataType: "int"}, value: nil, exp: "NULL"},
+		"int":             {column: &Column{DataType: "int"}, value: 42, exp: "42"},
+		"int8":            {column: &Column{DataType: "tinyint"}, value: int8(-3), exp: "-3"},
+		"uint64 high bit": {column: &Column{DataType: "bigint"}, value: uint64(math.MaxUint64), exp: "18446744073709551615"},
+		"text as number":  {column: &Column{DataType: "int"}, value: "1); DROP TABLE t; --", exp: `'1); DROP TABLE t; --'`},
+		"bool":            {column: &Column{DataType: "tinyint"}, value: true, exp: "1"},
+		"string":          {column: &Column{DataType: "varchar"}, value: "it's\\", exp: `'it''s\\'`, expNBE: `'it''s\'`},
+		"binary":          {column: &Column{DataType: "blob"}, value: []byte{0, 'a'}, exp: `_binary '\0a'`},
+		"datetime":        {column: &Column{DataType: "datetime"}, value: time.Date(2023, 2, 1, 10, 4, 5, 0, time.UTC), exp: "'2023-02-01 10:04:05'"},
+		"datetime to UTC": {column: &Column{DataType: "datetime"}, value: time.Date(2023, 2, 1, 10, 4, 5, 0, time.FixedZone("CET", 3600)), exp: "'2023-02-01 09:04:05'"},
+		"valuer":          {column: &Column{DataType: "varchar"}, value: sql.NullString{String: "a", Valid: true}, exp: "'a'"},
+		"null valuer":     {column: &Column{DataType: "varchar"}, value: sql.NullString{}, exp: "NULL"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			have, err := goValueLiteral(c.column, c.value, time.UTC, false)
+			xt.OK(t, err)
+			xt.Eq(t, c.exp, have)
+
+			if c.expNBE != "" {
+				have, err := goValueLiteral(c.column, c.value, time.UTC, true)
+				xt.OK(t, err)
+				xt.Eq(t, c.expNBE, have)
+			}
+		})
+	}
+
+	t.Run("location", func(t *testing.T) {
+		tokyo := time.FixedZone("JST", 9*3600)
+		have, err := goValueLiteral(&Column{DataType: "datetime"},
+			time.Date(2023, 2, 1, 10, 4, 5, 0, time.UTC), tokyo, false)
+		xt.OK(t, err)
+		xt.Eq(t, "'2023-02-01 19:04:05'", have)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := goValueLiteral(&Column{DataType: "int"}, struct{}{}, time.UTC, false)
+		xt.KO(t, err)
+	})
+}
+
+func TestBulkUpdateClause(t *testing.T) {
+	xt.Eq(t, " ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `qty` = VALUES(`qty`)",
+		bulkUpdateClause([]string{"name", "qty"}, false))
+	xt.Eq(t, " AS new ON DUPLICATE KEY UPDATE `name` = new.`name`, `qty` = new.`qty`",
+		bulkUpdateClause([]string{"name", "qty"}, true))
+}
+
+func TestBulkInserter(t *testing.T) {
+	schemaName := "xmysql_test_bulk"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	_, err = db.Exec("CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(100), qty INT)")
+	xt.OK(t, err)
+
+	ctx := context.Background()
+	columns := []string{"id", "name", "qty"}
+
+	t.Run("batches", func(t *testing.T) {
+		var batches int
+		b, err := NewBulkInserter(db, "items", columns, &BulkOptions{
+			MaxRows: 40,
+			OnBatch: func(BulkResult) { batches++ },
+		})
+		xt.OK(t, err)
+
+		for i := 1; i <= 100; i++ {
+			xt.OK(t, b.Add(ctx, i, "item", i))
+		}
+		xt.OK(t, b.Flush(ctx))
+
+		xt.Eq(t, 3, batches)
+		xt.Eq(t, []BulkResult{
+			{Rows: 40, Affected: 40, Inserted: 40},
+			{Rows: 40, Affected: 40, Inserted: 40},
+			{Rows: 20, Affected: 20, Inserted: 20},
+		}, b.Results())
+	})
+
+	t.Run("statement size", func(t *testing.T) {
+		b, err := NewBulkInserter(db, "items", columns, &BulkOptions{
+			Mode:             BulkModeIgnore,
+			MaxStatementSize: 200,
+		})
+		xt.OK(t, err)
+
+		for i := 95; i <= 120; i++ {
+			xt.OK(t, b.Add(ctx, i, "item", i))
+		}
+		xt.OK(t, b.Flush(ctx))
+
+		xt.Assert(t, len(b.Results()) > 1)
+		xt.Eq(t, BulkResult{Rows: 26, Affected: 20, Inserted: 20}, b.Total())
+
+		xt.KO(t, b.Add(ctx, 1000, string(make([]byte, 300)), 0))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		b, err := NewBulkInserter(db, "items", columns, &BulkOptions{
+			Mode:          BulkModeUpdate,
+			UpdateColumns: []string{"qty"},
+		})
+		xt.OK(t, err)
+
+		xt.OK(t, b.Add(ctx, 1, "changed", 1000))
+		xt.OK(t, b.Add(ctx, 2, "changed", 2000))
+		xt.OK(t, b.Add(ctx, 500, "new", 5))
+		xt.OK(t, b.Flush(ctx))
+
+		xt.Eq(t, BulkResult{Rows: 3, Affected: 5, Inserted: 0}, b.Total())
+
+		var name string
+		var qty int
+		xt.OK(t, db.QueryRow("SELECT name, qty FROM items WHERE id = 2").Scan(&name, &qty))
+		xt.Eq(t, "item", name)
+		xt.Eq(t, 2000, qty)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		b, err := NewBulkInserter(db, "items", columns, &BulkOptions{Mode: BulkModeReplace})
+		xt.OK(t, err)
+
+		xt.OK(t, b.Add(ctx, 3, "replaced", nil))
+		xt.OK(t, b.Add(ctx, 501, "new", nil))
+		xt.OK(t, b.Flush(ctx))
+
+		xt.Eq(t, BulkResult{Rows: 2, Affected: 3, Inserted: 1}, b.Total())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := NewBulkInserter(db, "items", []string{"id", "nope"}, nil)
+		xt.KO(t, err)
+
+		_, err = NewBulkInserter(db, "nope", columns, nil)
+		xt.KO(t, err)
+
+		b, err := NewBulkInserter(db, "items", columns, nil)
+		xt.OK(t, err)
+		xt.KO(t, b.Add(ctx, 1))
+
+		xt.OK(t, b.Add(ctx, 1, "duplicate", 1))
+		err = b.Flush(ctx)
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, ErrDubEntry))
+	})
+}
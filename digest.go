@@ -0,0 +1,194 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+// StatementDigest holds the statistics of a normalized statement, or "query
+// shape", as reported by performance_schema.events_statements_summary_by_digest.
+type StatementDigest struct {
+	// Schema is the default schema used when executing the statements; it is
+	// empty when there was none.
+	Schema string
+	// Digest is the hash of DigestText. It is empty for the row counting the
+	// statements which did not fit in the summary table.
+	Digest     string
+	DigestText string
+
+	Count        uint64
+	TotalLatency time.Duration
+	AvgLatency   time.Duration
+	MaxLatency   time.Duration
+
+	RowsExamined uint64
+	RowsSent     uint64
+	RowsAffected uint64
+
+	TmpTables       uint64
+	TmpDiskTables   uint64
+	SortMergePasses uint64
+	NoIndexUsed     uint64
+	NoGoodIndexUsed uint64
+}
+
+type digestKey struct {
+	schema string
+	digest string
+}
+
+func (d *StatementDigest) key() digestKey {
+	return digestKey{schema: d.Schema, digest: d.Digest}
+}
+
+// StatementDigests returns the statistics of the statements executed since
+// the digest summary was last reset, ordered by total latency, the slowest
+// first. When schema is not empty, only statements executed with schema as
+// default schema are returned.
+// The Performance Schema must be enabled, which is the default since MySQL 5.6.6.
+//
+// When error is returned, it is of type xmysql.Error.
+func StatementDigests(ctx context.Context, db *sql.DB, schema string) ([]*StatementDigest, error) {
+	q := "SELECT SCHEMA_NAME, DIGEST, DIGEST_TEXT, COUNT_STAR, " +
+		"SUM_TIMER_WAIT, AVG_TIMER_WAIT, MAX_TIMER_WAIT, " +
+		"SUM_ROWS_EXAMINED, SUM_ROWS_SENT, SUM_ROWS_AFFECTED, " +
+		"SUM_CREATED_TMP_TABLES, SUM_CREATED_TMP_DISK_TABLES, SUM_SORT_MERGE_PASSES, " +
+		"SUM_NO_INDEX_USED, SUM_NO_GOOD_INDEX_USED " +
+		"FROM performance_schema.events_statements_summary_by_digest"
+
+	var values []any
+	if schema != "" {
+		q += " WHERE SCHEMA_NAME = ?"
+		values = append(values, schema)
+	}
+	q += " ORDER BY SUM_TIMER_WAIT DESC"
+
+	rows, err := db.QueryContext(ctx, q, values...)
+	if err != nil {
+		return nil, NewErrorQuery(err, q, values)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var digests []*StatementDigest
+	for rows.Next() {
+		var schemaName, digest, digestText sql.NullString
+		var total, avg, maxWait uint64 // picoseconds
+		d := &StatementDigest{}
+
+		if err := rows.Scan(&schemaName, &digest, &digestText, &d.Count,
+			&total, &avg, &maxWait,
+			&d.RowsExamined, &d.RowsSent, &d.RowsAffected,
+			&d.TmpTables, &d.TmpDiskTables, &d.SortMergePasses,
+			&d.NoIndexUsed, &d.NoGoodIndexUsed); err != nil {
+			return nil, NewError(err)
+		}
+
+		d.Schema, d.Digest, d.DigestText = schemaName.String, digest.String, digestText.String
+		d.TotalLatency = picoseconds(total)
+		d.AvgLatency = picoseconds(avg)
+		d.MaxLatency = picoseconds(maxWait)
+
+		digests = append(digests, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return digests, nil
+}
+
+// ResetStatementDigests empties the digest summary of the Performance Schema.
+//
+// When error is returned, it is of type xmysql.Error.
+func ResetStatementDigests(ctx context.Context, db *sql.DB) error {
+	q := "TRUNCATE TABLE performance_schema.events_statements_summary_by_digest"
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return NewErrorQuery(err, q, nil)
+	}
+	return nil
+}
+
+// DiffStatementDigests returns the statistics of the statements executed
+// between taking the snapshots before and after, both obtained using
+// StatementDigests. The result is ordered by total latency, the slowest first.
+//
+// Since the maximum latency cannot be derived from two snapshots, MaxLatency
+// is taken from after, and is the maximum since the digest summary was reset.
+// When the digest summary was reset between the snapshots, statements are
+// counted as if before did not include them.
+func DiffStatementDigests(before, after []*StatementDigest) []*StatementDigest {
+	previous := make(map[digestKey]*StatementDigest, len(before))
+	for _, d := range before {
+		previous[d.key()] = d
+	}
+
+	var diff []*StatementDigest
+	for _, a := range after {
+		d := *a
+		if b, ok := previous[a.key()]; ok && b.Count <= a.Count && b.TotalLatency <= a.TotalLatency {
+			d.Count -= b.Count
+			d.TotalLatency -= b.TotalLatency
+			d.RowsExamined -= b.RowsExamined
+			d.RowsSent -= b.RowsSent
+			d.RowsAffected -= b.RowsAffected
+			d.TmpTables -= b.TmpTables
+			d.TmpDiskTables -= b.TmpDiskTables
+			d.SortMergePasses -= b.SortMergePasses
+			d.NoIndexUsed -= b.NoIndexUsed
+			d.NoGoodIndexUsed -= b.NoGoodIndexUsed
+		}
+
+		if d.Count == 0 {
+			continue
+		}
+		d.AvgLatency = d.TotalLatency / time.Duration(d.Count)
+		diff = append(diff, &d)
+	}
+
+	sort.SliceStable(diff, func(i, j int) bool {
+		return diff[i].TotalLatency > diff[j].TotalLatency
+	})
+
+	return diff
+}
+
+// MeasureStatementDigests takes a snapshot of the digest summary, calls fn,
+// and returns the statistics of the statements executed while fn ran, ordered
+// by total latency, the slowest first. Statements executed by other clients
+// at the same time are included. See StatementDigests for schema and
+// DiffStatementDigests for how the statistics are calculated.
+//
+// When error is returned, it is of type xmysql.Error.
+func MeasureStatementDigests(ctx context.Context, db *sql.DB, schema string,
+	fn func(ctx context.Context) error) ([]*StatementDigest, error) {
+
+	before, err := StatementDigests(ctx, db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(ctx); err != nil {
+		var e Error
+		if !errors.As(err, &e) {
+			e = NewError(err)
+		}
+		return nil, e
+	}
+
+	after, err := StatementDigests(ctx, db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffStatementDigests(before, after), nil
+}
+
+// picoseconds converts timer values of the Performance Schema.
+func picoseconds(ps uint64) time.Duration {
+	return time.Duration(ps / 1000)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestDiffStatementDigests(t *testing.T) {
+	before := []*StatementDigest{
+		{Schema: "shop", Digest: "a", Count: 10, TotalLatency: 10 * time.Millisecond, RowsExamined: 100, NoIndexUsed: 10},
+		{Schema: "shop", Digest: "b", Count: 5, TotalLatency: time.Millisecond},
+		{Schema: "shop", Digest: "c", Count: 50, TotalLatency: time.Second},
+	}
+	after := []*StatementDigest{
+		{Schema: "shop", Digest: "a", Count: 14, TotalLatency: 30 * time.Millisecond, RowsExamined: 140,
+			NoIndexUsed: 14, MaxLatency: 6 * time.Millisecond},
+		{Schema: "shop", Digest: "b", Count: 5, TotalLatency: time.Millisecond},
+		{Schema: "shop", Digest: "c", Count: 2, TotalLatency: 100 * time.Millisecond}, // reset in between
+		{Schema: "other", Digest: "a", Count: 1, TotalLatency: 5 * time.Millisecond},
+	}
+
+	diff := DiffStatementDigests(before, after)
+	xt.Eq(t, 3, len(diff))
+
+	xt.Eq(t, "c", diff[0].Digest)
+	xt.Eq(t, uint64(2), diff[0].Count)
+	xt.Eq(t, 50*time.Millisecond, diff[0].AvgLatency)
+
+	xt.Eq(t, "shop", diff[1].Schema)
+	xt.Eq(t, "a", diff[1].Digest)
+	xt.Eq(t, uint64(4), diff[1].Count)
+	xt.Eq(t, 20*time.Millisecond, diff[1].TotalLatency)
+	xt.Eq(t, 5*time.Millisecond, diff[1].AvgLatency)
+	xt.Eq(t, 6*time.Millisecond, diff[1].MaxLatency)
+	xt.Eq(t, uint64(40), diff[1].RowsExamined)
+	xt.Eq(t, uint64(4), diff[1].NoIndexUsed)
+
+	xt.Eq(t, "other", diff[2].Schema)
+
+	// snapshots are not modified
+	xt.Eq(t, uint64(14), after[0].Count)
+}
+
+func TestMeasureStatementDigests(t *testing.T) {
+	ctx := context.Background()
+
+	schemaName := "xmysql_test_digests"
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+	xt.OK(t, CreateSchema(testDB, schemaName))
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	_, err = db.Exec("CREATE TABLE users (id INT PRIMARY KEY, email VARCHAR(100))")
+	xt.OK(t, err)
+	_, err = db.Exec("INSERT INTO users VALUES (1, 'alice@example.com'), (2, 'bob@example.com')")
+	xt.OK(t, err)
+
+	digests, err := MeasureStatementDigests(ctx, db, schemaName, func(ctx context.Context) error {
+		for i := 0; i < 3; i++ {
+			rows, err := db.QueryContext(ctx, "SELECT id FROM users WHERE email = ?", "bob@example.com")
+			if err != nil {
+				return err
+			}
+			_ = rows.Close()
+		}
+		return nil
+	})
+	xt.OK(t, err)
+
+	var found *StatementDigest
+	for _, d := range digests {
+		xt.Eq(t, schemaName, d.Schema)
+		if strings.Contains(d.DigestText, "`email` = ?") {
+			found = d
+		}
+	}
+	xt.Assert(t, found != nil)
+	xt.Eq(t, uint64(3), found.Count)
+	xt.Eq(t, uint64(3), found.RowsSent)
+	xt.Eq(t, uint64(6), found.RowsExamined)
+	xt.Eq(t, uint64(3), found.NoIndexUsed)
+	xt.Assert(t, found.TotalLatency > 0)
+
+	t.Run("error of workload", func(t *testing.T) {
+		_, err := MeasureStatementDigests(ctx, db, schemaName, func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "SELECT * FROM no_such_table")
+			return err
+		})
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, 1146))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		xt.OK(t, ResetStatementDigests(ctx, db))
+		digests, err := StatementDigests(ctx, db, schemaName)
+		xt.OK(t, err)
+		// only the TRUNCATE statement itself is left
+		for _, d := range digests {
+			xt.Assert(t, !strings.Contains(d.DigestText, "`users`"))
+		}
+	})
+}
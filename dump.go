@@ -0,0 +1,703 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultDumpMaxStatementSize = 1024 * 1024
+
+// DumpOptions configures what Dump writes.
+type DumpOptions struct {
+	// SingleTransaction dumps all data within one transaction started using
+	// START TRANSACTION WITH CONSISTENT SNAPSHOT.
+	SingleTransaction bool
+	// Tables holds patterns (see path.Match) of the tables and views to dump.
+	// When empty, all tables and views are dumped.
+	Tables []string
+	// ExcludeTables holds patterns of tables and views not to dump.
+	ExcludeTables []string
+	// Where holds, per table, the condition used to filter the rows to dump,
+	// for example `"orders": "created > '2023-01-01'"`.
+	Where map[string]string
+	// HexBlob writes values of binary columns using hexadecimal notation.
+	HexBlob bool
+	// CreateSchema adds statements creating and using the schema.
+	CreateSchema bool
+	// MaxStatementSize is the size in bytes after which a new INSERT statement
+	// is started; defaults to 1MiB.
+	MaxStatementSize int
+
+	SkipData     bool
+	SkipViews    bool
+	SkipRoutines bool
+	SkipTriggers bool
+	SkipEvents   bool
+}
+
+func (o *DumpOptions) includes(table string) bool {
+	if len(o.Tables) > 0 && !matchAny(o.Tables, table) {
+		return false
+	}
+	return !matchAny(o.ExcludeTables, table)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Dump writes a SQL script to w which recreates schema: tables, routines, views,
+// triggers and events, as well as the data of the tables using extended INSERT
+// statements. Tables are created in order of their foreign keys, and views
+// in order of the views they use. The script is compatible with the one
+// written by mysqldump and can be loaded using the mysql client or LoadScript.
+// The opts can be nil in which case defaults are used.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func Dump(ctx context.Context, db *sql.DB, schema string, w io.Writer, opts *DumpOptions) error {
+	o := DumpOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxStatementSize <= 0 {
+		o.MaxStatementSize = defaultDumpMaxStatementSize
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return NewError(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// TIMESTAMP values are dumped, and loaded, in UTC; the time zone is
+	// restored since the connection returns to the pool
+	var timeZone string
+	if err := conn.QueryRowContext(ctx, "SELECT @@SESSION.time_zone").Scan(&timeZone); err != nil {
+		return NewError(err)
+	}
+	if _, err := conn.ExecContext(ctx, "SET SESSION time_zone = '+00:00'"); err != nil {
+		return NewError(err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SET SESSION time_zone = ?", timeZone)
+	}()
+
+	if o.SingleTransaction {
+		// only applies to the next transaction
+		if _, err := conn.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+			return NewError(err)
+		}
+		if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+			return ErrorTxBegin(err)
+		}
+		defer func() { _, _ = conn.ExecContext(context.Background(), "ROLLBACK") }()
+	}
+
+	d := &dumper{
+		ctx:    ctx,
+		db:     db,
+		conn:   conn,
+		schema: schema,
+		opts:   &o,
+		w:      bufio.NewWriter(w),
+	}
+
+	if err := d.dump(); err != nil {
+		return err
+	}
+
+	return d.w.Flush()
+}
+
+type dumper struct {
+	ctx    context.Context
+	db     *sql.DB
+	conn   *sql.Conn
+	schema string
+	opts   *DumpOptions
+	w      *bufio.Writer
+}
+
+func (d *dumper) printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(d.w, format, a...)
+}
+
+func (d *dumper) dump() error {
+	tables, views, err := d.tablesAndViews()
+	if err != nil {
+		return err
+	}
+
+	d.printf("-- xmysql dump of schema %s\n", QuoteIdentifier(d.schema))
+	d.printf("-- Dumped on %s\n\n", time.Now().UTC().Format(time.RFC3339))
+	d.printf("/*!40101 SET NAMES utf8mb4 */;\n")
+	d.printf("/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;\n")
+	d.printf("/*!40103 SET TIME_ZONE='+00:00' */;\n")
+	d.printf("/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;\n")
+	d.printf("/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;\n")
+	d.printf("/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;\n\n")
+
+	if d.opts.CreateSchema {
+		create, err := d.showCreate("SHOW CREATE SCHEMA "+QuoteIdentifier(d.schema), "Create Database")
+		if err != nil {
+			return err
+		}
+		d.printf("%s;\n\nUSE %s;\n\n", create, QuoteIdentifier(d.schema))
+	}
+
+	for _, table := range tables {
+		if err := d.dumpTable(table); err != nil {
+			return err
+		}
+	}
+
+	if !d.opts.SkipRoutines {
+		if err := d.dumpRoutines(); err != nil {
+			return err
+		}
+	}
+
+	if !d.opts.SkipViews {
+		for _, view := range views {
+			create, err := d.showCreate("SHOW CREATE VIEW "+d.qualified(view), "Create View")
+			if err != nil {
+				return err
+			}
+			d.printf("--\n-- View structure for view %s\n--\n\n", QuoteIdentifier(view))
+			d.printf("DROP VIEW IF EXISTS %s;\n%s;\n\n", QuoteIdentifier(view), create)
+		}
+	}
+
+	if !d.opts.SkipTriggers {
+		if err := d.dumpTriggers(tables); err != nil {
+			return err
+		}
+	}
+
+	if !d.opts.SkipEvents {
+		if err := d.dumpEvents(); err != nil {
+			return err
+		}
+	}
+
+	d.printf("/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;\n")
+	d.printf("/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;\n")
+	d.printf("/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;\n")
+	d.printf("/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;\n\n")
+	d.printf("-- Dump completed on %s\n", time.Now().UTC().Format(time.RFC3339))
+
+	return nil
+}
+
+func (d *dumper) qualified(name string) string {
+	return QuoteIdentifier(d.schema) + "." + QuoteIdentifier(name)
+}
+
+// tablesAndViews returns the tables sorted by their foreign keys, and the
+// views sorted by the views they use.
+func (d *dumper) tablesAndViews() ([]string, []string, error) {
+	q := "SELECT TABLE_NAME, TABLE_TYPE FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME"
+
+	rows, err := d.conn.QueryContext(d.ctx, q, d.schema)
+	if err != nil {
+		return nil, nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tables, views []string
+	for rows.Next() {
+		var name, tableType string
+		if err := rows.Scan(&name, &tableType); err != nil {
+			return nil, nil, NewError(err)
+		}
+		if !d.opts.includes(name) {
+			continue
+		}
+		switch tableType {
+		case "BASE TABLE":
+			tables = append(tables, name)
+		case "VIEW":
+			views = append(views, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, NewError(err)
+	}
+
+	keys, err := ForeignKeys(d.db, d.schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tableDeps := map[string][]string{}
+	for _, fk := range keys {
+		if fk.ReferencedSchema == d.schema {
+			tableDeps[fk.Table] = append(tableDeps[fk.Table], fk.ReferencedTable)
+		}
+	}
+
+	viewDeps, err := d.viewDependencies(views)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sortByDependencies(tables, tableDeps), sortByDependencies(views, viewDeps), nil
+}
+
+// viewDependencies returns, for each of the views, the tables and views of
+// the schema it uses. These are read from information_schema.VIEW_TABLE_USAGE,
+// available since MySQL 8.0.13. Otherwise, a view is taken to use the views
+// whose quoted name appears in its definition.
+func (d *dumper) viewDependencies(views []string) (map[string][]string, error) {
+	deps := map[string][]string{}
+	if len(views) == 0 {
+		return deps, nil
+	}
+
+	var version string
+	if err := d.conn.QueryRowContext(d.ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		return nil, NewError(err)
+	}
+
+	v, err := ParseServerVersion(version)
+	if err == nil && serverFlavor(version, "") != FlavorMariaDB && v.AtLeast(8, 0, 13) {
+		q := "SELECT VIEW_NAME, TABLE_NAME FROM information_schema.VIEW_TABLE_USAGE " +
+			"WHERE VIEW_SCHEMA = ? AND TABLE_SCHEMA = ?"
+		rows, err := d.conn.QueryContext(d.ctx, q, d.schema, d.schema)
+		if err != nil {
+			return nil, NewError(err)
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var view, table string
+			if err := rows.Scan(&view, &table); err != nil {
+				return nil, NewError(err)
+			}
+			deps[view] = append(deps[view], table)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, NewError(err)
+		}
+
+		return deps, nil
+	}
+
+	for _, view := range views {
+		var definition string
+		q := "SELECT VIEW_DEFINITION FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
+		if err := d.conn.QueryRowContext(d.ctx, q, d.schema, view).Scan(&definition); err != nil {
+			return nil, NewError(err)
+		}
+		for _, other := range views {
+			if other != view && strings.Contains(definition, QuoteIdentifier(other)) {
+				deps[view] = append(deps[view], other)
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// sortByDependencies sorts names so that each name comes after the names it
+// depends on. Names which are part of circular dependencies are added last,
+// in their original order.
+func sortByDependencies(names []string, deps map[string][]string) []string {
+	known := map[string]bool{}
+	for _, n := range names {
+		known[n] = true
+	}
+
+	var sorted []string
+	done := map[string]bool{}
+	for len(sorted) < len(names) {
+		progress := false
+		for _, n := range names {
+			if done[n] {
+				continue
+			}
+
+			ready := true
+			for _, dep := range deps[n] {
+				if dep != n && known[dep] && !done[dep] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				sorted = append(sorted, n)
+				done[n] = true
+				progress = true
+			}
+		}
+
+		if !progress {
+			for _, n := range names {
+				if !done[n] {
+					sorted = append(sorted, n)
+					done[n] = true
+				}
+			}
+		}
+	}
+
+	return sorted
+}
+
+// showCreate executes one of the SHOW CREATE statements and returns the
+// value of column.
+func (d *dumper) showCreate(q string, column string) (string, error) {
+	result, err := d.showCreateColumns(q, column)
+	if err != nil {
+		return "", err
+	}
+	return result[column], nil
+}
+
+func (d *dumper) showCreateColumns(q string, columns ...string) (map[string]string, error) {
+	rows, err := d.conn.QueryContext(d.ctx, q)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, NewError(err)
+		}
+		return nil, NewErrorSprintf(sql.ErrNoRows, "no result for %s", q)
+	}
+
+	values := make([]sql.NullString, len(names))
+	dest := make([]any, len(names))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, NewError(err)
+	}
+
+	result := map[string]string{}
+	for i, n := range names {
+		result[n] = values[i].String
+	}
+
+	for _, c := range columns {
+		if _, ok := result[c]; !ok {
+			return nil, NewErrorSprintf(nil, "column %s missing in result of %s", c, q)
+		}
+		if result[c] == "" {
+			return nil, NewErrorSprintf(nil, "no definition in result of %s (missing privileges?)", q)
+		}
+	}
+
+	return result, nil
+}
+
+func (d *dumper) dumpTable(table string) error {
+	create, err := d.showCreate("SHOW CREATE TABLE "+d.qualified(table), "Create Table")
+	if err != nil {
+		return err
+	}
+
+	d.printf("--\n-- Table structure for table %s\n--\n\n", QuoteIdentifier(table))
+	d.printf("DROP TABLE IF EXISTS %s;\n%s;\n\n", QuoteIdentifier(table), create)
+
+	if d.opts.SkipData {
+		return nil
+	}
+
+	columns, err := TableColumns(d.db, table, d.schema)
+	if err != nil {
+		return err
+	}
+
+	var selected, names []string
+	var hasGenerated bool
+	var dumped []*Column
+	for _, c := range columns {
+		if c.IsGenerated() {
+			hasGenerated = true
+			continue
+		}
+		dumped = append(dumped, c)
+		selected = append(selected, QuoteIdentifier(c.Name))
+		names = append(names, QuoteIdentifier(c.Name))
+	}
+
+	q := "SELECT " + strings.Join(selected, ", ") + " FROM " + d.qualified(table)
+	if where := d.opts.Where[table]; where != "" {
+		q += " WHERE " + where
+	}
+
+	rows, err := d.conn.QueryContext(d.ctx, q)
+	if err != nil {
+		return NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	insert := "INSERT INTO " + QuoteIdentifier(table)
+	if hasGenerated {
+		insert += " (" + strings.Join(names, ", ") + ")"
+	}
+	insert += " VALUES "
+
+	d.printf("--\n-- Dumping data for table %s\n--\n\n", QuoteIdentifier(table))
+
+	values := make([]any, len(dumped))
+	dest := make([]any, len(dumped))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	var stmtSize int
+	var row strings.Builder
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return NewError(err)
+		}
+
+		row.Reset()
+		row.WriteByte('(')
+		for i, c := range dumped {
+			if i > 0 {
+				row.WriteByte(',')
+			}
+			row.WriteString(sqlLiteral(c, values[i], d.opts.HexBlob, false))
+		}
+		row.WriteByte(')')
+
+		if stmtSize > 0 && stmtSize+row.Len() > d.opts.MaxStatementSize {
+			d.printf(";\n")
+			stmtSize = 0
+		}
+
+		if stmtSize == 0 {
+			d.printf("%s", insert)
+			stmtSize = len(insert)
+		} else {
+			d.printf(",")
+			stmtSize++
+		}
+
+		d.printf("%s", row.String())
+		stmtSize += row.Len()
+	}
+
+	if err := rows.Err(); err != nil {
+		return NewError(err)
+	}
+
+	if stmtSize > 0 {
+		d.printf(";\n")
+	}
+	d.printf("\n")
+
+	return nil
+}
+
+func (d *dumper) dumpRoutines() error {
+	q := "SELECT ROUTINE_TYPE, ROUTINE_NAME FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? " +
+		"ORDER BY ROUTINE_TYPE DESC, ROUTINE_NAME"
+
+	objects, err := d.listObjects(q)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		kind, name := obj[0], obj[1]
+		result, err := d.showCreateColumns("SHOW CREATE "+kind+" "+d.qualified(name), "Create "+titleCase(kind), "sql_mode")
+		if err != nil {
+			return err
+		}
+
+		d.printf("--\n-- Dumping routine %s\n--\n\n", QuoteIdentifier(name))
+		d.printf("DROP %s IF EXISTS %s;\n", kind, QuoteIdentifier(name))
+		d.writeCompound(result["sql_mode"], result["Create "+titleCase(kind)])
+	}
+
+	return nil
+}
+
+func (d *dumper) dumpTriggers(tables []string) error {
+	q := "SELECT EVENT_OBJECT_TABLE, TRIGGER_NAME FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ? " +
+		"ORDER BY EVENT_OBJECT_TABLE, ACTION_ORDER"
+
+	objects, err := d.listObjects(q)
+	if err != nil {
+		return err
+	}
+
+	dumped := map[string]bool{}
+	for _, t := range tables {
+		dumped[t] = true
+	}
+
+	for _, obj := range objects {
+		table, name := obj[0], obj[1]
+		if !dumped[table] {
+			continue
+		}
+
+		result, err := d.showCreateColumns("SHOW CREATE TRIGGER "+d.qualified(name), "SQL Original Statement", "sql_mode")
+		if err != nil {
+			return err
+		}
+
+		d.printf("--\n-- Dumping trigger %s of table %s\n--\n\n", QuoteIdentifier(name), QuoteIdentifier(table))
+		d.printf("DROP TRIGGER IF EXISTS %s;\n", QuoteIdentifier(name))
+		d.writeCompound(result["sql_mode"], result["SQL Original Statement"])
+	}
+
+	return nil
+}
+
+func (d *dumper) dumpEvents() error {
+	q := "SELECT 'EVENT', EVENT_NAME FROM information_schema.EVENTS WHERE EVENT_SCHEMA = ? ORDER BY EVENT_NAME"
+
+	objects, err := d.listObjects(q)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		name := obj[1]
+		result, err := d.showCreateColumns("SHOW CREATE EVENT "+d.qualified(name), "Create Event", "sql_mode")
+		if err != nil {
+			return err
+		}
+
+		d.printf("--\n-- Dumping event %s\n--\n\n", QuoteIdentifier(name))
+		d.printf("DROP EVENT IF EXISTS %s;\n", QuoteIdentifier(name))
+		d.writeCompound(result["sql_mode"], result["Create Event"])
+	}
+
+	return nil
+}
+
+func (d *dumper) listObjects(q string) ([][2]string, error) {
+	rows, err := d.conn.QueryContext(d.ctx, q, d.schema)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var objects [][2]string
+	for rows.Next() {
+		var obj [2]string
+		if err := rows.Scan(&obj[0], &obj[1]); err != nil {
+			return nil, NewError(err)
+		}
+		objects = append(objects, obj)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return objects, nil
+}
+
+// writeCompound writes a statement which can contain other statements, such as
+// CREATE PROCEDURE, using a different delimiter and the SQL mode it was created with.
+func (d *dumper) writeCompound(sqlMode, create string) {
+	d.printf("/*!50003 SET @saved_sql_mode = @@sql_mode */;\n")
+	d.printf("/*!50003 SET sql_mode = %s */;\n", QuoteString(sqlMode))
+	d.printf("DELIMITER ;;\n%s ;;\nDELIMITER ;\n", create)
+	d.printf("/*!50003 SET sql_mode = @saved_sql_mode */;\n\n")
+}
+
+func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + strings.ToLower(s[1:])
+}
+
+// sqlLiteral returns v, which was retrieved from column c, as SQL literal.
+// String literals are quoted for sessions using NO_BACKSLASH_ESCAPES when
+// noBackslashEscapes is true.
+func sqlLiteral(c *Column, v any, hexBinary, noBackslashEscapes bool) string {
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return bytesLiteral(c, t, hexBinary, noBackslashEscapes)
+	case string:
+		return bytesLiteral(c, []byte(t), hexBinary, noBackslashEscapes)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case uint64:
+		return strconv.FormatUint(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'g', -1, 32)
+	case bool:
+		if t {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		if c.DataType == "date" {
+			return quoteString(t.Format("2006-01-02"), noBackslashEscapes)
+		}
+		return quoteString(t.Format("2006-01-02 15:04:05.999999"), noBackslashEscapes)
+	default:
+		return quoteString(fmt.Sprint(t), noBackslashEscapes)
+	}
+}
+
+func bytesLiteral(c *Column, b []byte, hexBinary, noBackslashEscapes bool) string {
+	switch {
+	case isNumericType(c.DataType):
+		return string(b)
+	case c.DataType == "bit":
+		return "0x" + hex.EncodeToString(b)
+	case isBinaryType(c.DataType):
+		if hexBinary && len(b) > 0 {
+			return "0x" + hex.EncodeToString(b)
+		}
+		return "_binary " + quoteString(string(b), noBackslashEscapes)
+	default:
+		return quoteString(string(b), noBackslashEscapes)
+	}
+}
+
+func isNumericType(dataType string) bool {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "decimal", "float", "double", "year":
+		return true
+	}
+	return false
+}
+
+func isBinaryType(dataType string) bool {
+	switch dataType {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "geometry", "point",
+		"linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestSortByDependencies(t *testing.T) {
+	t.Run("dependencies first", func(t *testing.T) {
+		have := sortByDependencies(
+			[]string{"a", "b", "c", "d"},
+			map[string][]string{"a": {"c"}, "c": {"d", "x"}, "b": {"b"}},
+		)
+		xt.Eq(t, []string{"b", "d", "c", "a"}, have)
+	})
+
+	t.Run("circular", func(t *testing.T) {
+		have := sortByDependencies(
+			[]string{"a", "b", "c"},
+			map[string][]string{"a": {"b"}, "b": {"a"}},
+		)
+		xt.Eq(t, []string{"c", "a", "b"}, have)
+	})
+}
+
+func TestSQLLiteral(t *testing.T) {
+	var cases = map[string]struct {
+		column  *Column
+		value   any
+		hexBlob bool
+		exp     string
+	}{
+		"NULL":              {column: &Column{DataType: "int"}, value: nil, exp: "NULL"},
+		"integer as text":   {column: &Column{DataType: "int"}, value: []byte("-12"), exp: "-12"},
+		"decimal as text":   {column: &Column{DataType: "decimal"}, value: []byte("10.50"), exp: "10.50"},
+		"string":            {column: &Column{DataType: "varchar"}, value: []byte("it's"), exp: `'it''s'`},
+		"binary":            {column: &Column{DataType: "varbinary"}, value: []byte{0, 'a'}, exp: `_binary '\0a'`},
+		"binary as hex":     {column: &Column{DataType: "blob"}, value: []byte{0, 'a'}, hexBlob: true, exp: "0x0061"},
+		"empty binary":      {column: &Column{DataType: "blob"}, value: []byte{}, hexBlob: true, exp: "_binary ''"},
+		"bit":               {column: &Column{DataType: "bit"}, value: []byte{5}, exp: "0x05"},
+		"int64":             {column: &Column{DataType: "bigint"}, value: int64(42), exp: "42"},
+		"date":              {column: &Column{DataType: "date"}, value: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), exp: "'2023-02-01'"},
+		"datetime":          {column: &Column{DataType: "datetime"}, value: time.Date(2023, 2, 1, 10, 4, 5, 0, time.UTC), exp: "'2023-02-01 10:04:05'"},
+		"datetime fraction": {column: &Column{DataType: "datetime"}, value: time.Date(2023, 2, 1, 10, 4, 5, 120000000, time.UTC), exp: "'2023-02-01 10:04:05.12'"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			xt.Eq(t, c.exp, sqlLiteral(c.column, c.value, c.hexBlob, false))
+		})
+	}
+}
+
+func TestDump(t *testing.T) {
+	schemaName := "xmysql_test_dump"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	for _, stmt := range []string{
+		"CREATE TABLE z_parent (id INT PRIMARY KEY, name VARCHAR(20), data VARBINARY(10))",
+		"CREATE TABLE a_child (id INT PRIMARY KEY, parent_id INT, doubled INT AS (id * 2), " +
+			"FOREIGN KEY (parent_id) REFERENCES z_parent (id))",
+		"CREATE TABLE skipped (id INT)",
+		"INSERT INTO z_parent VALUES (1, 'it''s', 0x00ff), (2, NULL, NULL), (3, 'three', '')",
+		"INSERT INTO a_child (id, parent_id) VALUES (10, 1), (20, 2)",
+		"CREATE VIEW z_view AS SELECT id, name FROM z_parent",
+		// sorts before the view it uses
+		"CREATE VIEW a_view AS SELECT * FROM z_view",
+		// mentions, but does not use, the view using it
+		"CREATE VIEW n_view AS SELECT '`m_view`' AS note",
+		"CREATE VIEW m_view AS SELECT * FROM n_view",
+		"CREATE FUNCTION add_one(i INT) RETURNS INT DETERMINISTIC RETURN i + 1",
+		"CREATE TRIGGER trg_child BEFORE INSERT ON a_child FOR EACH ROW BEGIN SET NEW.id = NEW.id + 0; END",
+		"CREATE EVENT ev_noop ON SCHEDULE EVERY 1 DAY DISABLE DO SELECT 1",
+	} {
+		_, err := db.Exec(stmt)
+		xt.OK(t, err, stmt)
+	}
+
+	ctx := context.Background()
+
+	t.Run("everything", func(t *testing.T) {
+		var buf bytes.Buffer
+		xt.OK(t, Dump(ctx, testDB, schemaName, &buf, &DumpOptions{
+			SingleTransaction: true,
+			ExcludeTables:     []string{"skip*"},
+			HexBlob:           true,
+		}))
+		have := buf.String()
+
+		order := []string{
+			"CREATE TABLE `z_parent`",
+			"INSERT INTO `z_parent` VALUES (1,'it''s',0x00ff),(2,NULL,NULL),(3,'three',_binary '');",
+			"CREATE TABLE `a_child`",
+			"INSERT INTO `a_child` (`id`, `parent_id`) VALUES (10,1),(20,2);",
+			"FUNCTION `add_one`",
+			"VIEW `z_view`",
+			"VIEW `a_view`",
+			"TRIGGER `trg_child`",
+			"EVENT `ev_noop`",
+		}
+
+		pos := 0
+		for _, s := range order {
+			i := strings.Index(have[pos:], s)
+			xt.Assert(t, i >= 0, "expected (in order): "+s)
+			pos += i + len(s)
+		}
+
+		xt.Assert(t, strings.Index(have, "VIEW `n_view`") < strings.Index(have, "VIEW `m_view`"))
+		xt.Assert(t, !strings.Contains(have, "`skipped`"))
+	})
+
+	t.Run("session restored", func(t *testing.T) {
+		single, err := sql.Open("mysql", dsn)
+		xt.OK(t, err)
+		defer func() { _ = single.Close() }()
+		single.SetMaxOpenConns(1)
+
+		for _, q := range []string{
+			"SET SESSION time_zone = '+02:00'",
+			"SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED",
+		} {
+			_, err := single.Exec(q)
+			xt.OK(t, err)
+		}
+
+		xt.OK(t, Dump(ctx, single, schemaName, &bytes.Buffer{}, &DumpOptions{SingleTransaction: true}))
+
+		var timeZone, isolation string
+		xt.OK(t, single.QueryRow("SELECT @@SESSION.time_zone, @@SESSION.transaction_isolation").Scan(&timeZone, &isolation))
+		xt.Eq(t, "+02:00", timeZone)
+		xt.Eq(t, "READ-COMMITTED", isolation)
+	})
+
+	t.Run("where and statement size", func(t *testing.T) {
+		var buf bytes.Buffer
+		xt.OK(t, Dump(ctx, testDB, schemaName, &buf, &DumpOptions{
+			Tables:           []string{"z_parent"},
+			Where:            map[string]string{"z_parent": "id > 1"},
+			MaxStatementSize: 10,
+			SkipRoutines:     true,
+			SkipEvents:       true,
+		}))
+		have := buf.String()
+
+		xt.Assert(t, strings.Contains(have, "INSERT INTO `z_parent` VALUES (2,NULL,NULL);\n"+
+			"INSERT INTO `z_parent` VALUES (3,'three',_binary '');"))
+		xt.Assert(t, !strings.Contains(have, "CREATE TABLE `a_child`"))
+		xt.Assert(t, !strings.Contains(have, "add_one"))
+	})
+}
@@ -5,8 +5,8 @@ package xmysql
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
-	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
@@ -19,7 +19,7 @@ var (
 	reQuoteStrings       = regexp.MustCompile(`'(.*?)'`)
 	reGoPkg              = regexp.MustCompile(`.*?/go/(src|pkg)/`)
 	reCnxRefused         = regexp.MustCompile(`dial (\w+) (.*?): connect: connection refused`)
-	reGoMySQLDriverError = regexp.MustCompile(`Error (\w+): (.*)`)
+	reGoMySQLDriverError = regexp.MustCompile(`Error (\w+)(?: \((\w+)\))?: (.*)`)
 )
 
 // Error numbers of MySQL handled by this package.
@@ -27,7 +27,13 @@ const (
 	ErrDBCreateExists    int = 1007
 	ErrDBDropExists      int = 1008
 	ErrDubEntry          int = 1062
+	ErrParse             int = 1064
+	ErrLockWaitTimeout   int = 1205
+	ErrLockDeadlock      int = 1213
+	ErrCannotUser        int = 1396
+	ErrClientConnHost    int = 2003
 	ErrClientConnRefused int = 2005
+	ErrClientServerLost  int = 2013
 )
 
 // Error wraps mysql.MySQLError with additional information such
@@ -41,11 +47,21 @@ type Error struct {
 	Filename    string
 	Line        int
 	Number      int
+	SQLState    string
+	// Attempts is the number of times an operation was tried, for example
+	// by WithTx when retrying transactions. It is 0 when not applicable.
+	Attempts int
+	// ScriptLine is the line within a SQL script at which the failing statement
+	// starts, for example when using LoadScript. It is 0 when not applicable.
+	ScriptLine int
+
+	stack *callStack
 }
 
 // NewError returns a new xmysql.Error, storing err.
-// The filename and line number where the error occurred is saved.
-// Panics when the app.Package is not part of the caller's filename.
+// The call stack is captured, and the filename and line number of the first
+// frame outside this package is saved. The stack trace is printed when
+// formatting the error using "%+v".
 func NewError(err error) Error {
 	return newError(err)
 }
@@ -71,38 +87,76 @@ func NewErrorQuery(err error, query string, values []any) Error {
 func newError(err error) Error {
 	e := Error{DriverError: err}
 
-	rv := reflect.ValueOf(err)
-	if rv.Kind() == reflect.Pointer {
-		rv = rv.Elem()
+	if info, ok := ExtractError(err); ok {
+		e.Number = info.Number
+		e.SQLState = info.SQLState
 	}
 
-	if rv.IsValid() && rv.Kind() == reflect.Struct {
-		for _, n := range []string{"Code", "Number"} {
-			f := rv.FieldByName(n)
-			if f.IsValid() && !f.IsZero() {
-				switch f.Kind() {
-				case reflect.Uint16:
-					// github.com/go-sql-driver/mysql uses uint16
-					e.Number = int(f.Uint())
-				case reflect.Int:
-					// github.com/golistic/pxmysql uses int
-					e.Number = int(f.Int())
-				}
-			}
-		}
+	e.stack = captureStack()
+	if frames := e.stack.Frames(); len(frames) > 0 {
+		e.Filename = frameFilename(frames[0])
+		e.Line = frames[0].Line
 	}
 
-	_, fn, line, ok := runtime.Caller(3)
-	if ok {
-		if strings.Contains(fn, "golistic/xmysql") {
-			_, fn, line, _ = runtime.Caller(2)
+	return e
+}
+
+// Unwrap returns the error reported by the driver, if any.
+func (e Error) Unwrap() error {
+	return e.DriverError
+}
+
+// Is reports whether e matches target. Besides matching the driver error
+// (through Unwrap), an xmysql.Error matches when target is an xmysql.Error
+// with the same MySQL error number.
+func (e Error) Is(target error) bool {
+	var number int
+	switch t := target.(type) {
+	case Error:
+		number = t.Number
+	case *Error:
+		if t == nil {
+			return false
 		}
+		number = t.Number
+	default:
+		return false
 	}
 
-	e.Filename = reGoPkg.ReplaceAllString(fn, "")
-	e.Line = line
+	return number > 0 && e.Number == number
+}
 
-	return e
+// As sets target to e when target is of type **xmysql.Error. This allows
+// using errors.As with both xmysql.Error and *xmysql.Error.
+func (e Error) As(target any) bool {
+	if t, ok := target.(**Error); ok {
+		*t = &e
+		return true
+	}
+
+	return false
+}
+
+// StackTrace returns the frames of the call stack captured when e was created.
+// The frames within this package are not included.
+func (e Error) StackTrace() []runtime.Frame {
+	return e.stack.Frames()
+}
+
+// Format implements fmt.Formatter. The verbs %s and %v result in the same
+// output as Error, %q quotes it, and %+v adds the captured stack trace.
+func (e Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		_, _ = io.WriteString(s, e.Error())
+		if s.Flag('+') {
+			e.stack.format(s)
+		}
+	case 'q':
+		_, _ = fmt.Fprintf(s, "%q", e.Error())
+	default:
+		_, _ = io.WriteString(s, e.Error())
+	}
 }
 
 // Error returns the string representation of the e.
@@ -135,20 +189,19 @@ func (e Error) Error() string {
 			msg = fmt.Sprintf("'%s' not available", parts[0][1])
 		default:
 			parts := reGoMySQLDriverError.FindStringSubmatch(msg)
-			if len(parts) == 3 {
-				msg = cases.Lower(language.English, cases.Compact).String(parts[2])
+			if len(parts) == 4 {
+				msg = cases.Lower(language.English, cases.Compact).String(parts[3])
 			}
 		}
 	}
 
 	var v *net.OpError
 	switch {
-	case errors.As(e.DriverError, &v):
+	case e.Number == ErrClientConnRefused && errors.As(e.DriverError, &v):
 		const f = "unknown MySQL server host '%s' (%s) [2005:HY000]"
 
 		unwrapped := strings.TrimPrefix(v.Unwrap().Error(), "connect: ")
 		parts := reCnxRefused.FindStringSubmatch(msg)
-		e.Number = ErrClientConnRefused
 		if len(parts) == 3 {
 			msg = fmt.Sprintf(f, parts[2], unwrapped)
 		} else {
@@ -156,6 +209,10 @@ func (e Error) Error() string {
 		}
 	}
 
+	if e.ScriptLine > 0 {
+		msg += fmt.Sprintf(" (script line %d)", e.ScriptLine)
+	}
+
 	return msg
 }
 
@@ -182,3 +239,21 @@ func ErrorTxBegin(err error) Error {
 func ErrorTxCommit(err error) Error {
 	return NewErrorSprintf(err, "failed committing transaction")
 }
+
+// ErrorSavepoint returns a xmysql.Error, storing err, and setting a fixed
+// message 'failed creating savepoint'.
+func ErrorSavepoint(err error) Error {
+	return NewErrorSprintf(err, "failed creating savepoint")
+}
+
+// ErrorSavepointRollback returns a xmysql.Error, storing err, and setting a fixed
+// message 'failed rolling back to savepoint'.
+func ErrorSavepointRollback(err error) Error {
+	return NewErrorSprintf(err, "failed rolling back to savepoint")
+}
+
+// ErrorSavepointRelease returns a xmysql.Error, storing err, and setting a fixed
+// message 'failed releasing savepoint'.
+func ErrorSavepointRelease(err error) Error {
+	return NewErrorSprintf(err, "failed releasing savepoint")
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrorInfo holds the details of a MySQL error as reported by a driver.
+type ErrorInfo struct {
+	Number   int
+	SQLState string
+	Message  string
+}
+
+// ErrorExtractor returns the details of err. It returns false when err is
+// not handled by the extractor, for example, because it was reported by
+// another driver. The extractor is called for each error of the chain; it
+// does not need to unwrap err itself.
+type ErrorExtractor func(err error) (ErrorInfo, bool)
+
+type namedExtractor struct {
+	name string
+	fn   ErrorExtractor
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = []namedExtractor{
+		{name: "go-sql-driver/mysql", fn: extractGoMySQLDriver},
+		{name: "pxmysql", fn: extractPXMySQL},
+		{name: "net", fn: extractNet},
+	}
+)
+
+// UnregisterErrorExtractor removes the extractor registered with name. It
+// returns whether it was registered. Built-in extractors can be removed as
+// well.
+func UnregisterErrorExtractor(name string) bool {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	for i, ex := range extractors {
+		if ex.name == name {
+			extractors = append(extractors[:i], extractors[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// RegisterErrorExtractor registers fn so errors reported by other drivers can
+// be handled. Extractors registered later take precedence over earlier ones,
+// including the built-in extractors named "go-sql-driver/mysql", "pxmysql",
+// and "net". When an extractor with the same name exists, it is replaced.
+// Panics when fn is nil.
+func RegisterErrorExtractor(name string, fn ErrorExtractor) {
+	if fn == nil {
+		panic("xmysql: nil error extractor")
+	}
+
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	for i, ex := range extractors {
+		if ex.name == name {
+			extractors = append(extractors[:i], extractors[i+1:]...)
+			break
+		}
+	}
+
+	extractors = append(extractors, namedExtractor{name: name, fn: fn})
+}
+
+// ExtractError walks the chain of err, as done by errors.Is, and returns the
+// details of the first error for which an extractor is available. When err is,
+// or wraps, an xmysql.Error with a number, that number is used.
+// It returns false when no details could be found.
+func ExtractError(err error) (ErrorInfo, bool) {
+	extractorsMu.RLock()
+	registered := make([]namedExtractor, len(extractors))
+	copy(registered, extractors)
+	extractorsMu.RUnlock()
+
+	return extractError(err, registered)
+}
+
+func extractError(err error, extractors []namedExtractor) (ErrorInfo, bool) {
+	if err == nil {
+		return ErrorInfo{}, false
+	}
+
+	switch e := err.(type) {
+	case Error:
+		if e.Number > 0 {
+			return ErrorInfo{Number: e.Number, SQLState: e.SQLState, Message: e.Error()}, true
+		}
+	case *Error:
+		if e != nil && e.Number > 0 {
+			return ErrorInfo{Number: e.Number, SQLState: e.SQLState, Message: e.Error()}, true
+		}
+	default:
+		for i := len(extractors) - 1; i >= 0; i-- {
+			if info, ok := extractors[i].fn(err); ok {
+				return info, true
+			}
+		}
+	}
+
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return extractError(u.Unwrap(), extractors)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			if info, ok := extractError(e, extractors); ok {
+				return info, true
+			}
+		}
+	}
+
+	return ErrorInfo{}, false
+}
+
+func extractGoMySQLDriver(err error) (ErrorInfo, bool) {
+	e, ok := err.(*mysql.MySQLError)
+	if !ok || e == nil {
+		return ErrorInfo{}, false
+	}
+
+	info := ErrorInfo{
+		Number:  int(e.Number),
+		Message: e.Message,
+	}
+	if e.SQLState != [5]byte{} {
+		info.SQLState = string(e.SQLState[:])
+	}
+
+	return info, true
+}
+
+// pxmysqlErrorsPkg is the package of github.com/golistic/pxmysql reporting
+// errors. We do not import it so that applications using only the
+// conventional protocol do not depend on it.
+const pxmysqlErrorsPkg = "github.com/golistic/pxmysql/mysqlerrors"
+
+func extractPXMySQL(err error) (ErrorInfo, bool) {
+	rv := reflect.ValueOf(err)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return ErrorInfo{}, false
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct || rv.Type().PkgPath() != pxmysqlErrorsPkg {
+		return ErrorInfo{}, false
+	}
+
+	var info ErrorInfo
+	if f := rv.FieldByName("Code"); f.IsValid() && f.CanInt() {
+		info.Number = int(f.Int())
+	}
+	if f := rv.FieldByName("SQLState"); f.IsValid() && f.Kind() == reflect.String {
+		info.SQLState = f.String()
+	}
+
+	// the message of pxmysql errors is a format; the rendered error ends with
+	// the error number and SQLSTATE, which we remove
+	info.Message = strings.TrimSuffix(err.Error(), fmt.Sprintf(" [%d:%s]", info.Number, info.SQLState))
+
+	return info, info.Number > 0
+}
+
+// extractNet handles network errors. Only connections refused while dialing
+// are reported as ErrClientConnRefused; failing to connect otherwise, for
+// example when the host is unknown, is reported as ErrClientConnHost, and
+// errors of established connections, such as resets and timeouts, as
+// ErrClientServerLost.
+func extractNet(err error) (ErrorInfo, bool) {
+	v, ok := err.(*net.OpError)
+	if !ok || v == nil {
+		return ErrorInfo{}, false
+	}
+
+	msg := err.Error()
+	if v.Err != nil {
+		msg = strings.TrimPrefix(v.Err.Error(), "connect: ")
+	}
+
+	number := ErrClientServerLost
+	if v.Op == "dial" {
+		number = ErrClientConnHost
+		if errors.Is(v.Err, syscall.ECONNREFUSED) {
+			number = ErrClientConnRefused
+		}
+	}
+
+	return ErrorInfo{
+		Number:   number,
+		SQLState: "HY000",
+		Message:  msg,
+	}, true
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// RedactedValue replaces values of queries which are redacted.
+const RedactedValue = "[redacted]"
+
+// Redactor takes the query and its values stored in an Error and returns
+// what can be safely logged or reported. When the returned query is empty,
+// it is left out; same for values when nil.
+//
+// The message of the error, which can hold values reported by the server, is
+// not passed to the Redactor. Its string literals are always redacted, while
+// numbers, such as error codes and line numbers, are kept.
+type Redactor func(query string, values []any) (string, []any)
+
+var redactor atomic.Pointer[Redactor]
+
+// SetRedactor sets the redaction policy used when Error is logged using
+// log/slog or marshalled as JSON. When r is nil, the default RedactValues
+// is used.
+func SetRedactor(r Redactor) {
+	if r == nil {
+		redactor.Store(nil)
+		return
+	}
+	redactor.Store(&r)
+}
+
+func currentRedactor() Redactor {
+	if r := redactor.Load(); r != nil {
+		return *r
+	}
+	return RedactValues
+}
+
+// RedactNone returns query and values as-is.
+// Use this only in debugging/development situations.
+func RedactNone(query string, values []any) (string, []any) {
+	return query, values
+}
+
+// RedactValues replaces string and numeric literals within query, and each
+// value, with RedactedValue. Both single- and double-quoted strings are
+// redacted, including escaped quotes. Identifiers quoted with backticks are
+// left as-is. This is the default redaction policy.
+func RedactValues(query string, values []any) (string, []any) {
+	query = redactLiterals(query, true)
+
+	if values == nil {
+		return query, nil
+	}
+
+	redacted := make([]any, len(values))
+	for i := range values {
+		redacted[i] = RedactedValue
+	}
+
+	return query, redacted
+}
+
+// RedactAll leaves out both query and values.
+func RedactAll(string, []any) (string, []any) {
+	return "", nil
+}
+
+// redactLiterals replaces the string literals within s, quoted using single
+// or double quotes, with RedactedValue. When numbers is true, numeric literals
+// are replaced as well. Quotes are escaped either by doubling them, or using a
+// backslash. Identifiers quoted using backticks, and words containing digits
+// such as t1, are left as-is.
+func redactLiterals(s string, numbers bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := literalEnd(s, i)
+			if c == '`' {
+				b.WriteString(s[i:end])
+			} else {
+				b.WriteByte(c)
+				b.WriteString(RedactedValue)
+				b.WriteByte(c)
+			}
+			i = end
+		case isIdentifierByte(c):
+			start := i
+			for i < len(s) && isIdentifierByte(s[i]) {
+				i++
+			}
+			// a number followed by letters, for example 1e10 or 0x1F
+			if numbers && c >= '0' && c <= '9' {
+				for i < len(s) && (s[i] == '.' || (s[i] == '+' || s[i] == '-') && (s[i-1] == 'e' || s[i-1] == 'E') ||
+					isIdentifierByte(s[i])) {
+					i++
+				}
+				b.WriteString(RedactedValue)
+				continue
+			}
+			b.WriteString(s[start:i])
+		case numbers && c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			i++
+			for i < len(s) && (isIdentifierByte(s[i]) || s[i] == '.') {
+				i++
+			}
+			b.WriteString(RedactedValue)
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// literalEnd returns the index right after the quoted literal starting at
+// index start of s, or len(s) when it is not terminated.
+func literalEnd(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func isIdentifierByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+type errorReport struct {
+	Number     int    `json:"number,omitempty"`
+	Symbol     string `json:"symbol,omitempty"`
+	SQLState   string `json:"sqlstate,omitempty"`
+	Message    string `json:"message"`
+	File       string `json:"file,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	Attempts   int    `json:"attempts,omitempty"`
+	ScriptLine int    `json:"script_line,omitempty"`
+	Query      string `json:"query,omitempty"`
+	Values     []any  `json:"values,omitempty"`
+}
+
+func (e Error) report() errorReport {
+	r := currentRedactor()
+	query, values := r(e.Query, e.Values)
+
+	return errorReport{
+		Number:     e.Number,
+		Symbol:     e.Symbol(),
+		SQLState:   e.SQLState,
+		Message:    redactLiterals(e.Error(), false),
+		File:       e.Filename,
+		Line:       e.Line,
+		Attempts:   e.Attempts,
+		ScriptLine: e.ScriptLine,
+		Query:      query,
+		Values:     values,
+	}
+}
+
+// LogValue implements slog.LogValuer. The error is logged as a group
+// holding the error number, symbol, SQLSTATE, message, and the location
+// where the error occurred. The query and its values are only included
+// after being redacted (see SetRedactor).
+func (e Error) LogValue() slog.Value {
+	r := e.report()
+
+	attrs := make([]slog.Attr, 0, 10)
+	if r.Number > 0 {
+		attrs = append(attrs, slog.Int("number", r.Number))
+	}
+	if r.Symbol != "" {
+		attrs = append(attrs, slog.String("symbol", r.Symbol))
+	}
+	if r.SQLState != "" {
+		attrs = append(attrs, slog.String("sqlstate", r.SQLState))
+	}
+	attrs = append(attrs, slog.String("message", r.Message))
+	if r.File != "" {
+		attrs = append(attrs, slog.String("file", r.File), slog.Int("line", r.Line))
+	}
+	if r.Attempts > 0 {
+		attrs = append(attrs, slog.Int("attempts", r.Attempts))
+	}
+	if r.ScriptLine > 0 {
+		attrs = append(attrs, slog.Int("script_line", r.ScriptLine))
+	}
+	if r.Query != "" {
+		attrs = append(attrs, slog.String("query", r.Query))
+	}
+	if r.Values != nil {
+		attrs = append(attrs, slog.Any("values", r.Values))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// MarshalJSON implements json.Marshaler and can be used when reporting errors.
+// The same fields as with LogValue are included, and the query and its values
+// are redacted.
+func (e Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.report())
+}
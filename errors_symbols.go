@@ -0,0 +1,54 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+// errorSymbols maps MySQL server and client error numbers to their symbol
+// as used in the MySQL documentation. Only commonly encountered errors are
+// included.
+var errorSymbols = map[int]string{
+	ErrDBCreateExists:    "ER_DB_CREATE_EXISTS",
+	ErrDBDropExists:      "ER_DB_DROP_EXISTS",
+	1040:                 "ER_CON_COUNT_ERROR",
+	1044:                 "ER_DBACCESS_DENIED_ERROR",
+	1045:                 "ER_ACCESS_DENIED_ERROR",
+	1046:                 "ER_NO_DB_ERROR",
+	1048:                 "ER_BAD_NULL_ERROR",
+	1049:                 "ER_BAD_DB_ERROR",
+	1050:                 "ER_TABLE_EXISTS_ERROR",
+	1051:                 "ER_BAD_TABLE_ERROR",
+	1054:                 "ER_BAD_FIELD_ERROR",
+	ErrDubEntry:          "ER_DUP_ENTRY",
+	ErrParse:             "ER_PARSE_ERROR",
+	1142:                 "ER_TABLEACCESS_DENIED_ERROR",
+	1146:                 "ER_NO_SUCH_TABLE",
+	ErrLockWaitTimeout:   "ER_LOCK_WAIT_TIMEOUT",
+	ErrLockDeadlock:      "ER_LOCK_DEADLOCK",
+	1216:                 "ER_NO_REFERENCED_ROW",
+	1217:                 "ER_ROW_IS_REFERENCED",
+	1227:                 "ER_SPECIFIC_ACCESS_DENIED_ERROR",
+	1265:                 "WARN_DATA_TRUNCATED",
+	1290:                 "ER_OPTION_PREVENTS_STATEMENT",
+	1292:                 "ER_TRUNCATED_WRONG_VALUE",
+	1305:                 "ER_SP_DOES_NOT_EXIST",
+	1317:                 "ER_QUERY_INTERRUPTED",
+	1364:                 "ER_NO_DEFAULT_FOR_FIELD",
+	1366:                 "ER_TRUNCATED_WRONG_VALUE_FOR_FIELD",
+	ErrCannotUser:        "ER_CANNOT_USER",
+	1406:                 "ER_DATA_TOO_LONG",
+	1451:                 "ER_ROW_IS_REFERENCED_2",
+	1452:                 "ER_NO_REFERENCED_ROW_2",
+	3024:                 "ER_QUERY_TIMEOUT",
+	3572:                 "ER_LOCK_NOWAIT",
+	2002:                 "CR_CONNECTION_ERROR",
+	ErrClientConnHost:    "CR_CONN_HOST_ERROR",
+	ErrClientConnRefused: "CR_UNKNOWN_HOST",
+	2006:                 "CR_SERVER_GONE_ERROR",
+	ErrClientServerLost:  "CR_SERVER_LOST",
+}
+
+// Symbol returns the symbol of the MySQL error number of e, for example
+// "ER_DUP_ENTRY" for 1062. An empty string is returned when the number is
+// not known.
+func (e Error) Symbol() string {
+	return errorSymbols[e.Number]
+}
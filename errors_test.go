@@ -3,8 +3,17 @@
 package xmysql_test
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/go-sql-driver/mysql"
@@ -70,3 +79,304 @@ func TestNewError(t *testing.T) {
 	})
 
 }
+
+func TestError_callSite(t *testing.T) {
+	myErr := &mysql.MySQLError{Number: 1046, Message: "No database selected"}
+
+	t.Run("direct", func(t *testing.T) {
+		_, _, line, _ := runtime.Caller(0)
+		err := xmysql.NewError(myErr)
+		xt.Eq(t, "github.com/golistic/xmysql_test/errors_test.go", err.Filename)
+		xt.Eq(t, line+1, err.Line)
+	})
+
+	t.Run("through helper of package", func(t *testing.T) {
+		_, _, line, _ := runtime.Caller(0)
+		err := xmysql.ErrorTxBegin(myErr)
+		xt.Eq(t, "github.com/golistic/xmysql_test/errors_test.go", err.Filename)
+		xt.Eq(t, line+1, err.Line)
+	})
+
+	t.Run("stack trace", func(t *testing.T) {
+		err := xmysql.NewError(myErr)
+		frames := err.StackTrace()
+		xt.Assert(t, len(frames) > 0)
+		xt.Assert(t, strings.HasSuffix(frames[0].File, "errors_test.go"))
+
+		have := fmt.Sprintf("%+v", err)
+		xt.Assert(t, strings.HasPrefix(have, "no database selected\n"))
+		xt.Assert(t, strings.Contains(have, "errors_test.go:"))
+		xt.Eq(t, "no database selected", fmt.Sprintf("%v", err))
+	})
+}
+
+func TestError_unwrap(t *testing.T) {
+	myErr := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'PRIMARY'"}
+	err := fmt.Errorf("wrapped: %w", xmysql.NewError(myErr))
+
+	t.Run("errors.Is with driver error", func(t *testing.T) {
+		xt.Assert(t, errors.Is(err, myErr))
+	})
+
+	t.Run("errors.Is with xmysql.Error", func(t *testing.T) {
+		xt.Assert(t, errors.Is(err, xmysql.Error{Number: xmysql.ErrDubEntry}))
+		xt.Assert(t, !errors.Is(err, xmysql.Error{Number: xmysql.ErrDBDropExists}))
+	})
+
+	t.Run("errors.As", func(t *testing.T) {
+		var driverErr *mysql.MySQLError
+		xt.Assert(t, errors.As(err, &driverErr))
+		xt.Eq(t, uint16(1062), driverErr.Number)
+
+		var e xmysql.Error
+		xt.Assert(t, errors.As(err, &e))
+		xt.Eq(t, xmysql.ErrDubEntry, e.Number)
+
+		var pe *xmysql.Error
+		xt.Assert(t, errors.As(err, &pe))
+		xt.Eq(t, xmysql.ErrDubEntry, pe.Number)
+	})
+}
+
+func TestError_LogValue(t *testing.T) {
+	myErr := &mysql.MySQLError{
+		Number:   1062,
+		SQLState: [5]byte{'2', '3', '0', '0', '0'},
+		Message:  "Duplicate entry 'alice' for key 'PRIMARY'",
+	}
+
+	err := xmysql.NewErrorQuery(myErr, "INSERT INTO t1 VALUES (?, 'secret')", []any{"alice"})
+
+	t.Run("slog with default redaction", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+		logger.Error("insert failed", "err", err)
+
+		var have struct {
+			Err map[string]any `json:"err"`
+		}
+		xt.OK(t, json.Unmarshal(buf.Bytes(), &have))
+
+		xt.Eq(t, float64(1062), have.Err["number"])
+		xt.Eq(t, "ER_DUP_ENTRY", have.Err["symbol"])
+		xt.Eq(t, "23000", have.Err["sqlstate"])
+		xt.Eq(t, "'[redacted]' not available", have.Err["message"])
+		xt.Eq(t, "github.com/golistic/xmysql_test/errors_test.go", have.Err["file"])
+		xt.Eq(t, "INSERT INTO t1 VALUES (?, '[redacted]')", have.Err["query"])
+		xt.Eq(t, []any{xmysql.RedactedValue}, have.Err["values"])
+	})
+
+	t.Run("JSON redacting everything", func(t *testing.T) {
+		xmysql.SetRedactor(xmysql.RedactAll)
+		defer xmysql.SetRedactor(nil)
+
+		data, jerr := json.Marshal(err)
+		xt.OK(t, jerr)
+
+		var have map[string]any
+		xt.OK(t, json.Unmarshal(data, &have))
+		_, hasQuery := have["query"]
+		_, hasValues := have["values"]
+		xt.Assert(t, !hasQuery)
+		xt.Assert(t, !hasValues)
+		xt.Eq(t, "ER_DUP_ENTRY", have["symbol"])
+		xt.Eq(t, "'[redacted]' not available", have["message"])
+	})
+
+	t.Run("JSON without redaction", func(t *testing.T) {
+		xmysql.SetRedactor(xmysql.RedactNone)
+		defer xmysql.SetRedactor(nil)
+
+		data, jerr := json.Marshal(err)
+		xt.OK(t, jerr)
+
+		var have map[string]any
+		xt.OK(t, json.Unmarshal(data, &have))
+		xt.Eq(t, "INSERT INTO t1 VALUES (?, 'secret')", have["query"])
+		xt.Eq(t, []any{"alice"}, have["values"])
+		xt.Eq(t, "'[redacted]' not available", have["message"])
+	})
+
+	t.Run("numbers in message are kept", func(t *testing.T) {
+		numErr := xmysql.NewErrorQuery(&mysql.MySQLError{
+			Number:  1366,
+			Message: "Incorrect integer value: 'abc' for column 'qty' at row 12",
+		}, "INSERT INTO t1 VALUES (?)", []any{"abc"})
+
+		data, jerr := json.Marshal(numErr)
+		xt.OK(t, jerr)
+
+		var have map[string]any
+		xt.OK(t, json.Unmarshal(data, &have))
+		message := have["message"].(string)
+		xt.Assert(t, strings.Contains(message, "at row 12"), message)
+		xt.Assert(t, !strings.Contains(message, "abc"), message)
+	})
+}
+
+func TestRedactValues(t *testing.T) {
+	var cases = map[string]struct {
+		query string
+		exp   string
+	}{
+		"single quotes": {
+			query: "SELECT * FROM t1 WHERE name = 'alice' AND note = 'x'",
+			exp:   "SELECT * FROM t1 WHERE name = '[redacted]' AND note = '[redacted]'",
+		},
+		"double quotes": {
+			query: `UPDATE t1 SET name = "bob" WHERE id = ?`,
+			exp:   `UPDATE t1 SET name = "[redacted]" WHERE id = ?`,
+		},
+		"escaped quotes": {
+			query: `INSERT INTO t1 VALUES ('it''s secret', 'it\'s secret', "say \"hi\"")`,
+			exp:   `INSERT INTO t1 VALUES ('[redacted]', '[redacted]', "[redacted]")`,
+		},
+		"numbers": {
+			query: "SELECT c1 FROM t2 WHERE salary > 100000 AND rate = 1.5e-3 OR id IN (0x1F, .5) LIMIT 10",
+			exp: "SELECT c1 FROM t2 WHERE salary > [redacted] AND rate = [redacted] OR id IN ([redacted], " +
+				"[redacted]) LIMIT [redacted]",
+		},
+		"identifiers": {
+			query: "SELECT `it's 'quoted'` FROM `db1`.`t``1` WHERE `42` = '42'",
+			exp:   "SELECT `it's 'quoted'` FROM `db1`.`t``1` WHERE `42` = '[redacted]'",
+		},
+		"unterminated": {
+			query: "SELECT 'secret",
+			exp:   "SELECT '[redacted]'",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			have, values := xmysql.RedactValues(c.query, nil)
+			xt.Eq(t, c.exp, have)
+			xt.Assert(t, values == nil)
+		})
+	}
+}
+
+type customDriverError struct {
+	code  int
+	state string
+}
+
+func (e *customDriverError) Error() string {
+	return fmt.Sprintf("custom %d (%s)", e.code, e.state)
+}
+
+func TestExtractError(t *testing.T) {
+	t.Run("go-sql-driver/mysql wrapped", func(t *testing.T) {
+		myErr := &mysql.MySQLError{
+			Number:   1046,
+			SQLState: [5]byte{'3', 'D', '0', '0', '0'},
+			Message:  "No database selected",
+		}
+
+		info, ok := xmysql.ExtractError(fmt.Errorf("query failed: %w", myErr))
+		xt.Assert(t, ok)
+		xt.Eq(t, 1046, info.Number)
+		xt.Eq(t, "3D000", info.SQLState)
+		xt.Eq(t, "No database selected", info.Message)
+
+		e := xmysql.NewError(fmt.Errorf("query failed: %w", myErr))
+		xt.Eq(t, 1046, e.Number)
+		xt.Eq(t, "3D000", e.SQLState)
+	})
+
+	t.Run("message of go-sql-driver/mysql including SQLSTATE", func(t *testing.T) {
+		myErr := &mysql.MySQLError{
+			Number:   1046,
+			SQLState: [5]byte{'3', 'D', '0', '0', '0'},
+			Message:  "No database selected",
+		}
+
+		xt.Eq(t, "no database selected", xmysql.NewError(myErr).Error())
+	})
+
+	t.Run("golistic/pxmysql", func(t *testing.T) {
+		info, ok := xmysql.ExtractError(&mysqlerrors.Error{
+			Message:  "Unknown database '%s'",
+			Code:     1049,
+			SQLState: "42000",
+			Parameters: []any{
+				"foo",
+			},
+		})
+		xt.Assert(t, ok)
+		xt.Eq(t, 1049, info.Number)
+		xt.Eq(t, "42000", info.SQLState)
+	})
+
+	t.Run("errors joined", func(t *testing.T) {
+		err := errors.Join(fmt.Errorf("not a MySQL error"), &mysql.MySQLError{Number: 1213})
+
+		info, ok := xmysql.ExtractError(err)
+		xt.Assert(t, ok)
+		xt.Eq(t, xmysql.ErrLockDeadlock, info.Number)
+	})
+
+	t.Run("net errors", func(t *testing.T) {
+		t.Run("connection refused", func(t *testing.T) {
+			err := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+
+			info, ok := xmysql.ExtractError(err)
+			xt.Assert(t, ok)
+			xt.Eq(t, xmysql.ErrClientConnRefused, info.Number)
+			xt.Eq(t, "HY000", info.SQLState)
+			xt.Eq(t, "connection refused", info.Message)
+		})
+
+		t.Run("unknown host", func(t *testing.T) {
+			err := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "mysql"}}
+
+			info, ok := xmysql.ExtractError(err)
+			xt.Assert(t, ok)
+			xt.Eq(t, xmysql.ErrClientConnHost, info.Number)
+		})
+
+		t.Run("connection reset", func(t *testing.T) {
+			err := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+			info, ok := xmysql.ExtractError(err)
+			xt.Assert(t, ok)
+			xt.Eq(t, xmysql.ErrClientServerLost, info.Number)
+			xt.Assert(t, !xmysql.ErrorIs(xmysql.NewError(err), xmysql.ErrClientConnRefused))
+		})
+	})
+
+	t.Run("registered extractor", func(t *testing.T) {
+		err := fmt.Errorf("wrapped: %w", &customDriverError{code: 1146, state: "42S02"})
+
+		_, ok := xmysql.ExtractError(err)
+		xt.Assert(t, !ok)
+
+		t.Cleanup(func() { xmysql.UnregisterErrorExtractor("custom") })
+		xmysql.RegisterErrorExtractor("custom", func(err error) (xmysql.ErrorInfo, bool) {
+			var e *customDriverError
+			if !errors.As(err, &e) {
+				return xmysql.ErrorInfo{}, false
+			}
+			return xmysql.ErrorInfo{Number: e.code, SQLState: e.state, Message: "no such table"}, true
+		})
+
+		info, ok := xmysql.ExtractError(err)
+		xt.Assert(t, ok)
+		xt.Eq(t, 1146, info.Number)
+		xt.Eq(t, "42S02", info.SQLState)
+
+		xt.Assert(t, xmysql.ErrorIs(xmysql.NewError(err), 1146))
+
+		xt.Assert(t, xmysql.UnregisterErrorExtractor("custom"))
+		xt.Assert(t, !xmysql.UnregisterErrorExtractor("custom"))
+		_, ok = xmysql.ExtractError(err)
+		xt.Assert(t, !ok)
+	})
+
+	t.Run("nothing to extract", func(t *testing.T) {
+		_, ok := xmysql.ExtractError(fmt.Errorf("not a MySQL error"))
+		xt.Assert(t, !ok)
+
+		_, ok = xmysql.ExtractError(nil)
+		xt.Assert(t, !ok)
+	})
+}
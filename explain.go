@@ -0,0 +1,472 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var reAnalyzeAccess = regexp.MustCompile(
+	`(?:scan|lookup|search) on (\S+)(?: using \S+)?.*\(actual time=[\d.]+\.\.[\d.]+ rows=([\d.e+]+) loops=(\d+)\)`)
+
+// AccessType is how a table is accessed according to the optimizer, also
+// known as the join type.
+type AccessType string
+
+const (
+	AccessSystem         AccessType = "system"
+	AccessConst          AccessType = "const"
+	AccessEqRef          AccessType = "eq_ref"
+	AccessRef            AccessType = "ref"
+	AccessFulltext       AccessType = "fulltext"
+	AccessRefOrNull      AccessType = "ref_or_null"
+	AccessIndexMerge     AccessType = "index_merge"
+	AccessUniqueSubquery AccessType = "unique_subquery"
+	AccessIndexSubquery  AccessType = "index_subquery"
+	AccessRange          AccessType = "range"
+	// AccessIndex scans the whole index.
+	AccessIndex AccessType = "index"
+	// AccessAll scans the whole table.
+	AccessAll AccessType = "ALL"
+)
+
+// planChildKeys are the members of EXPLAIN FORMAT=JSON output which hold
+// nested operations, in the order they are added as children.
+var planChildKeys = []string{
+	"query_block", "union_result", "query_specifications",
+	"ordering_operation", "grouping_operation", "duplicates_removal", "windowing", "buffer_result",
+	"nested_loop", "table", "materialized_from_subquery",
+	"attached_subqueries", "optimized_away_subqueries",
+	"select_list_subqueries", "having_subqueries", "order_by_subqueries", "group_by_subqueries",
+}
+
+// PlanNode is an operation within a Plan, for example, accessing a table.
+type PlanNode struct {
+	// Kind is the member of EXPLAIN FORMAT=JSON output describing the node,
+	// for example "query_block", "ordering_operation", "nested_loop" or "table".
+	Kind     string
+	SelectID int
+	// Message is set when the optimizer has nothing to do, for example "No
+	// tables used" or "Impossible WHERE".
+	Message string
+
+	// Table is the name, or alias, of the table accessed by nodes of kind
+	// "table". Internal temporary tables have names like "<derived2>".
+	Table        string
+	AccessType   AccessType
+	PossibleKeys []string
+	Key          string
+	UsedKeyParts []string
+	// UsingIndex is whether only the index is read (covering index).
+	UsingIndex        bool
+	AttachedCondition string
+
+	// EstimatedRows is the number of rows the optimizer estimates are examined
+	// per scan of the table.
+	EstimatedRows uint64
+	// Filtered is the estimated percentage of the examined rows which remain
+	// after applying the conditions on the table.
+	Filtered float64
+	// ActualRows is the number of rows read from the table during all loops,
+	// as reported by EXPLAIN ANALYZE. It is nil when the plan was not
+	// analyzed or the table was never accessed.
+	ActualRows *uint64
+	// Cost is the query cost for query blocks, and the prefix cost for
+	// tables.
+	Cost float64
+
+	UsingTemporaryTable bool
+	UsingFilesort       bool
+
+	Children []*PlanNode
+}
+
+// Plan is the execution plan of a query.
+type Plan struct {
+	Query string
+	// Root is the top-level query block.
+	Root *PlanNode
+	// JSON is the output of EXPLAIN FORMAT=JSON.
+	JSON json.RawMessage
+	// Tree is the output of EXPLAIN ANALYZE, and is empty when the plan was
+	// not analyzed.
+	Tree string
+	// Analyzed is whether the actual number of rows was measured using
+	// EXPLAIN ANALYZE.
+	Analyzed bool
+}
+
+// Explain returns the execution plan of query using EXPLAIN FORMAT=JSON.
+// When the server supports EXPLAIN ANALYZE (MySQL 8.0.18 and later), and
+// query is a SELECT or TABLE statement, the query is also executed using
+// EXPLAIN ANALYZE to get the actual number of rows read from each table.
+// Other statements, for example UPDATE, are never executed, nor are
+// statements which lock rows (FOR UPDATE, FOR SHARE, LOCK IN SHARE MODE),
+// store the result (INTO), or use locking functions such as GET_LOCK.
+// Note that stored functions called by query are executed, including their
+// side effects.
+//
+// The plans of MariaDB, and EXPLAIN FORMAT=JSON output of version 2 (see
+// explain_json_format_version) are not supported.
+//
+// When error is returned, it is of type xmysql.Error.
+func Explain(ctx context.Context, db *sql.DB, query string, args ...any) (*Plan, error) {
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		return nil, NewError(err)
+	}
+
+	var data []byte
+	q := "EXPLAIN FORMAT=JSON " + query
+	if err := db.QueryRowContext(ctx, q, args...).Scan(&data); err != nil {
+		return nil, NewErrorQuery(err, q, args)
+	}
+
+	plan, err := parsePlan(data)
+	if err != nil {
+		return nil, err
+	}
+	plan.Query = query
+
+	v, err := ParseServerVersion(version)
+	if err != nil || serverFlavor(version, "") == FlavorMariaDB || !v.AtLeast(8, 0, 18) ||
+		!isReadStatement(query) {
+		return plan, nil
+	}
+
+	q = "EXPLAIN ANALYZE " + query
+	if err := db.QueryRowContext(ctx, q, args...).Scan(&plan.Tree); err != nil {
+		return nil, NewErrorQuery(err, q, args)
+	}
+	plan.analyze()
+
+	return plan, nil
+}
+
+func parsePlan(data []byte) (*Plan, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, NewError(fmt.Errorf("xmysql: decoding plan: %w", err))
+	}
+
+	raw, ok := doc["query_block"]
+	if !ok {
+		return nil, NewError(fmt.Errorf("xmysql: plan has no query block"))
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, NewError(err)
+	}
+	plan := &Plan{JSON: buf.Bytes()}
+
+	var err error
+	if plan.Root, err = parsePlanNode("query_block", raw); err != nil {
+		return nil, NewError(fmt.Errorf("xmysql: decoding plan: %w", err))
+	}
+
+	return plan, nil
+}
+
+func parsePlanNode(kind string, raw json.RawMessage) (*PlanNode, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+
+	var fields struct {
+		SelectID            int         `json:"select_id"`
+		Message             string      `json:"message"`
+		TableName           string      `json:"table_name"`
+		AccessType          AccessType  `json:"access_type"`
+		PossibleKeys        []string    `json:"possible_keys"`
+		Key                 string      `json:"key"`
+		UsedKeyParts        []string    `json:"used_key_parts"`
+		UsingIndex          bool        `json:"using_index"`
+		AttachedCondition   string      `json:"attached_condition"`
+		RowsExaminedPerScan json.Number `json:"rows_examined_per_scan"`
+		Filtered            json.Number `json:"filtered"`
+		UsingTemporaryTable bool        `json:"using_temporary_table"`
+		UsingFilesort       bool        `json:"using_filesort"`
+		CostInfo            struct {
+			QueryCost  json.Number `json:"query_cost"`
+			PrefixCost json.Number `json:"prefix_cost"`
+		} `json:"cost_info"`
+		Windows []struct {
+			UsingTemporaryTable bool `json:"using_temporary_table"`
+			UsingFilesort       bool `json:"using_filesort"`
+		} `json:"windows"`
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	n := &PlanNode{
+		Kind:                kind,
+		SelectID:            fields.SelectID,
+		Message:             fields.Message,
+		Table:               fields.TableName,
+		AccessType:          fields.AccessType,
+		PossibleKeys:        fields.PossibleKeys,
+		Key:                 fields.Key,
+		UsedKeyParts:        fields.UsedKeyParts,
+		UsingIndex:          fields.UsingIndex,
+		AttachedCondition:   fields.AttachedCondition,
+		UsingTemporaryTable: fields.UsingTemporaryTable,
+		UsingFilesort:       fields.UsingFilesort,
+	}
+
+	rows, _ := fields.RowsExaminedPerScan.Float64()
+	n.EstimatedRows = uint64(rows)
+	n.Filtered, _ = fields.Filtered.Float64()
+	n.Cost, _ = fields.CostInfo.QueryCost.Float64()
+	if n.Cost == 0 {
+		n.Cost, _ = fields.CostInfo.PrefixCost.Float64()
+	}
+	for _, w := range fields.Windows {
+		n.UsingTemporaryTable = n.UsingTemporaryTable || w.UsingTemporaryTable
+		n.UsingFilesort = n.UsingFilesort || w.UsingFilesort
+	}
+
+	for _, key := range planChildKeys {
+		raw, ok := obj[key]
+		if !ok {
+			continue
+		}
+
+		if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			child, err := parsePlanNode(key, raw)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, child)
+			continue
+		}
+
+		// elements of lists wrap the nodes, for example, nested loops hold
+		// objects with a "table" member
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, err
+		}
+
+		group := &PlanNode{Kind: key}
+		for _, elem := range elems {
+			wrapper, err := parsePlanNode("", elem)
+			if err != nil {
+				return nil, err
+			}
+			group.Children = append(group.Children, wrapper.Children...)
+		}
+		n.Children = append(n.Children, group)
+	}
+
+	return n, nil
+}
+
+// analyze sets the actual number of rows of the tables using the output of
+// EXPLAIN ANALYZE. Tables are matched by name, in order of appearance.
+func (p *Plan) analyze() {
+	tables := p.Tables()
+
+	for _, line := range strings.Split(p.Tree, "\n") {
+		m := reAnalyzeAccess.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		rows, _ := strconv.ParseFloat(m[2], 64)
+		loops, _ := strconv.ParseFloat(m[3], 64)
+		actual := uint64(math.Round(rows * loops))
+
+		for _, t := range tables {
+			if t.Table == m[1] && t.ActualRows == nil {
+				t.ActualRows = &actual
+				break
+			}
+		}
+	}
+
+	p.Analyzed = true
+}
+
+// Walk calls fn for each node of the plan, depth-first, starting with the
+// root.
+func (p *Plan) Walk(fn func(n *PlanNode)) {
+	var walk func(n *PlanNode)
+	walk = func(n *PlanNode) {
+		fn(n)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+
+	if p.Root != nil {
+		walk(p.Root)
+	}
+}
+
+// Tables returns the nodes accessing tables, in order of appearance.
+func (p *Plan) Tables() []*PlanNode {
+	var tables []*PlanNode
+	p.Walk(func(n *PlanNode) {
+		if n.Kind == "table" {
+			tables = append(tables, n)
+		}
+	})
+	return tables
+}
+
+// Table returns the first node accessing the table with given name or
+// alias, or nil when it is not accessed.
+func (p *Plan) Table(name string) *PlanNode {
+	for _, t := range p.Tables() {
+		if t.Table == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// UsesIndex returns whether any table is accessed using the index with
+// given name.
+func (p *Plan) UsesIndex(name string) bool {
+	for _, t := range p.Tables() {
+		if t.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FullTableScans returns the nodes of the tables which are read entirely.
+// Scans of internal temporary tables, for example holding the result of a
+// derived table or a UNION, are not included.
+func (p *Plan) FullTableScans() []*PlanNode {
+	var scans []*PlanNode
+	for _, t := range p.Tables() {
+		if t.AccessType != AccessAll || strings.HasPrefix(t.Table, "<") || t.materialized() {
+			continue
+		}
+		scans = append(scans, t)
+	}
+	return scans
+}
+
+// UsesTemporaryTable returns whether the plan uses an internal temporary
+// table, for example for GROUP BY or UNION.
+func (p *Plan) UsesTemporaryTable() bool {
+	var used bool
+	p.Walk(func(n *PlanNode) {
+		used = used || n.UsingTemporaryTable
+	})
+	return used
+}
+
+// UsesFilesort returns whether rows are sorted, instead of read in order
+// using an index.
+func (p *Plan) UsesFilesort() bool {
+	var used bool
+	p.Walk(func(n *PlanNode) {
+		used = used || n.UsingFilesort
+	})
+	return used
+}
+
+// String returns the plan as indented lines, one per node, which is useful
+// when reporting unexpected plans.
+func (p *Plan) String() string {
+	var b strings.Builder
+
+	var write func(n *PlanNode, depth int)
+	write = func(n *PlanNode, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(n.String())
+		b.WriteByte('\n')
+		for _, c := range n.Children {
+			write(c, depth+1)
+		}
+	}
+
+	if p.Root != nil {
+		write(p.Root, 0)
+	}
+
+	return b.String()
+}
+
+// String returns a one-line description of n.
+func (n *PlanNode) String() string {
+	s := n.Kind
+	if n.Table != "" {
+		s += fmt.Sprintf(" %s (%s", n.Table, n.AccessType)
+		if n.Key != "" {
+			s += " using " + n.Key
+		}
+		s += fmt.Sprintf(", rows=%d filtered=%.2f", n.EstimatedRows, n.Filtered)
+		if n.ActualRows != nil {
+			s += fmt.Sprintf(" actual=%d", *n.ActualRows)
+		}
+		s += ")"
+	}
+	if n.UsingTemporaryTable {
+		s += " using temporary"
+	}
+	if n.UsingFilesort {
+		s += " using filesort"
+	}
+	if n.Message != "" {
+		s += ": " + n.Message
+	}
+
+	return s
+}
+
+func (n *PlanNode) materialized() bool {
+	for _, c := range n.Children {
+		if c.Kind == "materialized_from_subquery" {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadStatement returns whether query is a SELECT or TABLE statement,
+// which can be executed by EXPLAIN ANALYZE without side effects. Statements
+// which lock rows, store the result using INTO, or use locking functions are
+// not. Words are matched regardless of whether they are part of a string
+// literal or identifier, erring on the side of not executing query.
+func isReadStatement(query string) bool {
+	words := strings.FieldsFunc(strings.ToUpper(query), func(r rune) bool {
+		return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	if len(words) == 0 || (words[0] != "SELECT" && words[0] != "TABLE") {
+		return false
+	}
+
+	for i, w := range words {
+		next := ""
+		if i+1 < len(words) {
+			next = words[i+1]
+		}
+
+		switch {
+		case w == "INTO",
+			w == "FOR" && (next == "UPDATE" || next == "SHARE"),
+			w == "LOCK" && next == "IN",
+			w == "GET_LOCK", w == "RELEASE_LOCK", w == "RELEASE_ALL_LOCKS":
+			return false
+		}
+	}
+
+	return true
+}
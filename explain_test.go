@@ -0,0 +1,214 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+// testPlanJSON is the output of EXPLAIN FORMAT=JSON of MySQL 8.0 for:
+//
+//	SELECT u.email, COUNT(*) FROM users u JOIN orders o ON o.user_id = u.id
+//	WHERE u.name LIKE 'a%' GROUP BY u.email ORDER BY 2 DESC
+const testPlanJSON = `{
+  "query_block": {
+    "select_id": 1,
+    "cost_info": {"query_cost": "3.85"},
+    "ordering_operation": {
+      "using_filesort": true,
+      "grouping_operation": {
+        "using_temporary_table": true,
+        "using_filesort": false,
+        "nested_loop": [
+          {
+            "table": {
+              "table_name": "u",
+              "access_type": "ALL",
+              "possible_keys": ["PRIMARY"],
+              "rows_examined_per_scan": 5,
+              "rows_produced_per_join": 1,
+              "filtered": "20.00",
+              "cost_info": {"read_cost": "0.65", "eval_cost": "0.10", "prefix_cost": "0.75"},
+              "attached_condition": "(` + "`shop`.`u`.`name` like 'a%'" + `)"
+            }
+          },
+          {
+            "table": {
+              "table_name": "o",
+              "access_type": "ref",
+              "possible_keys": ["idx_user"],
+              "key": "idx_user",
+              "used_key_parts": ["user_id"],
+              "key_length": "4",
+              "ref": ["shop.u.id"],
+              "rows_examined_per_scan": 3,
+              "rows_produced_per_join": 3,
+              "filtered": "100.00",
+              "using_index": true,
+              "cost_info": {"read_cost": "0.75", "eval_cost": "0.30", "prefix_cost": "1.80"}
+            }
+          }
+        ]
+      }
+    }
+  }
+}`
+
+const testPlanTree = `-> Sort: COUNT(*) DESC
+    -> Table scan on <temporary>  (actual time=0.12..0.12 rows=1 loops=1)
+        -> Aggregate using temporary table  (actual time=0.11..0.11 rows=1 loops=1)
+            -> Nested loop inner join  (cost=1.80 rows=3) (actual time=0.05..0.08 rows=3 loops=1)
+                -> Filter: (u.name like 'a%')  (cost=0.75 rows=1) (actual time=0.03..0.04 rows=1 loops=1)
+                    -> Table scan on u  (cost=0.75 rows=5) (actual time=0.02..0.03 rows=5 loops=1)
+                -> Covering index lookup on o using idx_user (user_id=u.id)  (cost=1.05 rows=3) (actual time=0.01..0.02 rows=3 loops=1)
+`
+
+func TestParsePlan(t *testing.T) {
+	plan, err := parsePlan([]byte(testPlanJSON))
+	xt.OK(t, err)
+
+	xt.Eq(t, "query_block", plan.Root.Kind)
+	xt.Eq(t, 1, plan.Root.SelectID)
+	xt.Eq(t, 3.85, plan.Root.Cost)
+
+	tables := plan.Tables()
+	xt.Eq(t, 2, len(tables))
+
+	u := plan.Table("u")
+	xt.Eq(t, AccessAll, u.AccessType)
+	xt.Eq(t, uint64(5), u.EstimatedRows)
+	xt.Eq(t, 20.0, u.Filtered)
+	xt.Eq(t, "", u.Key)
+	xt.Eq(t, 0.75, u.Cost)
+
+	o := plan.Table("o")
+	xt.Eq(t, AccessRef, o.AccessType)
+	xt.Eq(t, "idx_user", o.Key)
+	xt.Eq(t, []string{"user_id"}, o.UsedKeyParts)
+	xt.Assert(t, o.UsingIndex)
+
+	xt.Assert(t, plan.UsesIndex("idx_user"))
+	xt.Assert(t, !plan.UsesIndex("PRIMARY"))
+	xt.Assert(t, plan.UsesFilesort())
+	xt.Assert(t, plan.UsesTemporaryTable())
+	xt.Eq(t, []*PlanNode{u}, plan.FullTableScans())
+	xt.Assert(t, plan.Table("x") == nil)
+
+	xt.Eq(t, `query_block
+  ordering_operation using filesort
+    grouping_operation using temporary
+      nested_loop
+        table u (ALL, rows=5 filtered=20.00)
+        table o (ref using idx_user, rows=3 filtered=100.00)
+`, plan.String())
+
+	t.Run("analyze", func(t *testing.T) {
+		plan.Tree = testPlanTree
+		plan.analyze()
+
+		xt.Assert(t, plan.Analyzed)
+		xt.Eq(t, uint64(5), *u.ActualRows)
+		xt.Eq(t, uint64(3), *o.ActualRows)
+	})
+
+	t.Run("no tables", func(t *testing.T) {
+		plan, err := parsePlan([]byte(`{"query_block": {"select_id": 1, "message": "No tables used"}}`))
+		xt.OK(t, err)
+		xt.Eq(t, 0, len(plan.Tables()))
+		xt.Eq(t, "query_block: No tables used\n", plan.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parsePlan([]byte(`{"steps": []}`))
+		xt.KO(t, err)
+	})
+}
+
+func TestIsReadStatement(t *testing.T) {
+	xt.Assert(t, isReadStatement("SELECT 1"))
+	xt.Assert(t, isReadStatement("  (select 1) UNION (SELECT 2)"))
+	xt.Assert(t, isReadStatement("SELECT\n\tid\nFROM users"))
+	xt.Assert(t, isReadStatement("TABLE users"))
+	xt.Assert(t, isReadStatement("SELECT id FROM users ORDER BY id FOR_X"))
+	xt.Assert(t, !isReadStatement("UPDATE users SET name = 'x'"))
+	xt.Assert(t, !isReadStatement("DELETE FROM users"))
+	xt.Assert(t, !isReadStatement("SELECT id FROM users WHERE id = 1 FOR UPDATE"))
+	xt.Assert(t, !isReadStatement("select id from users for share skip locked"))
+	xt.Assert(t, !isReadStatement("SELECT id FROM users LOCK IN SHARE MODE"))
+	xt.Assert(t, !isReadStatement("SELECT id INTO @id FROM users"))
+	xt.Assert(t, !isReadStatement("SELECT id FROM users INTO OUTFILE '/tmp/users'"))
+	xt.Assert(t, !isReadStatement("SELECT GET_LOCK('job', 10)"))
+	xt.Assert(t, !isReadStatement(""))
+}
+
+func TestExplain(t *testing.T) {
+	ctx := context.Background()
+
+	schemaName := "xmysql_test_explain"
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+	xt.OK(t, CreateSchema(testDB, schemaName))
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	for _, q := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, email VARCHAR(100), name VARCHAR(100), UNIQUE KEY idx_email (email))",
+		"INSERT INTO users VALUES (1, 'alice@example.com', 'Alice'), (2, 'bob@example.com', 'Bob')",
+		"ANALYZE TABLE users",
+	} {
+		_, err := db.Exec(q)
+		xt.OK(t, err)
+	}
+
+	t.Run("uses index", func(t *testing.T) {
+		plan, err := Explain(ctx, db, "SELECT id FROM users WHERE email = ?", "bob@example.com")
+		xt.OK(t, err)
+
+		xt.Assert(t, plan.UsesIndex("idx_email"))
+		xt.Eq(t, 0, len(plan.FullTableScans()))
+		if plan.Analyzed {
+			xt.Eq(t, uint64(1), *plan.Table("users").ActualRows)
+		}
+	})
+
+	t.Run("full table scan", func(t *testing.T) {
+		plan, err := Explain(ctx, db, "SELECT id FROM users WHERE name = ? ORDER BY name", "Bob")
+		xt.OK(t, err)
+
+		scans := plan.FullTableScans()
+		xt.Eq(t, 1, len(scans))
+		xt.Eq(t, "users", scans[0].Table)
+		xt.Assert(t, plan.UsesFilesort())
+	})
+
+	t.Run("not executed", func(t *testing.T) {
+		plan, err := Explain(ctx, db, "DELETE FROM users WHERE id = 1")
+		xt.OK(t, err)
+		xt.Assert(t, !plan.Analyzed)
+
+		var n int
+		xt.OK(t, db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n))
+		xt.Eq(t, 2, n)
+	})
+
+	t.Run("locking read not executed", func(t *testing.T) {
+		plan, err := Explain(ctx, db, "SELECT id\nFROM users WHERE id = ? FOR UPDATE", 1)
+		xt.OK(t, err)
+		xt.Assert(t, !plan.Analyzed)
+		xt.Eq(t, "users", plan.Tables()[0].Table)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := Explain(ctx, db, "SELECT * FROM no_such_table")
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, 1146))
+	})
+}
@@ -0,0 +1,443 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormat is the format in which Export and ExportTable write rows.
+type ExportFormat string
+
+const (
+	// ExportCSV writes rows as CSV as described in RFC 4180. NULL is written
+	// as an empty field unless ExportOptions.NullText is set.
+	ExportCSV ExportFormat = "CSV"
+	// ExportTSV writes rows separated by tabs, escaping special characters
+	// using a backslash and writing NULL as \N. This is the format of
+	// SELECT ... INTO OUTFILE, and can be loaded using LoadData.
+	ExportTSV ExportFormat = "TSV"
+	// ExportJSONLines writes each row as a JSON object on a single line, with
+	// the column names as keys.
+	ExportJSONLines ExportFormat = "JSONL"
+)
+
+const defaultExportChunkSize = 1000
+
+// ExportOptions configures Export and ExportTable.
+type ExportOptions struct {
+	// Format is the format of the output; defaults to ExportCSV.
+	Format ExportFormat
+	// Header writes the column names as the first line with ExportCSV and ExportTSV.
+	Header bool
+	// NullText is written for NULL with ExportCSV; defaults to an empty field.
+	NullText string
+	// BinaryHex writes binary data as hexadecimal string instead of using
+	// base64 encoding.
+	BinaryHex bool
+
+	// Schema is the schema of the table exported by ExportTable; defaults to
+	// the current schema.
+	Schema string
+	// Columns are the columns exported by ExportTable; defaults to all columns.
+	Columns []string
+	// Where is the condition used by ExportTable to filter rows.
+	Where string
+	// ChunkSize is the number of rows ExportTable reads per query; defaults to 1000.
+	ChunkSize int
+	// Progress, when not nil, is called by ExportTable after each chunk with
+	// the number of rows written so far.
+	Progress func(rows int64)
+}
+
+// Export executes query using args, and writes the resulting rows to w using
+// the format specified in opts. It returns the number of rows written.
+// The opts can be nil in which case defaults are used.
+//
+// Values are written depending on their MySQL type: DECIMAL values are kept
+// as-is, BIT values are written as unsigned integers, JSON documents are
+// embedded as JSON with ExportJSONLines, temporal values keep their fractional
+// seconds, and binary data is base64 encoded (see ExportOptions.BinaryHex).
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func Export(ctx context.Context, db *sql.DB, w io.Writer, opts *ExportOptions, query string, args ...any) (int64, error) {
+	o := exportOptions(opts)
+
+	ew, err := newExportWriter(w, &o)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := ew.query(ctx, db, query, args, 0); err != nil {
+		return ew.count, err
+	}
+
+	return ew.count, ew.flush()
+}
+
+// ExportTable writes the rows of table to w using the format specified in
+// opts. The rows are read in chunks ordered by the primary key so that no
+// long-running query or snapshot is needed. Tables without primary key are
+// read using a single query. It returns the number of rows written.
+// The opts can be nil in which case defaults are used.
+//
+// See Export for how values are written.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func ExportTable(ctx context.Context, db *sql.DB, table string, w io.Writer, opts *ExportOptions) (int64, error) {
+	o := exportOptions(opts)
+
+	pk, err := PrimaryKey(db, table, o.Schema)
+	if err != nil {
+		return 0, err
+	}
+
+	name := QuoteIdentifier(table)
+	if o.Schema != "" {
+		name = QuoteIdentifier(o.Schema) + "." + name
+	}
+
+	selected := "*"
+	if len(o.Columns) > 0 {
+		quoted := make([]string, len(o.Columns))
+		for i, c := range o.Columns {
+			quoted[i] = QuoteIdentifier(c)
+		}
+		selected = strings.Join(quoted, ", ")
+	}
+
+	ew, err := newExportWriter(w, &o)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(pk) == 0 {
+		q := "SELECT " + selected + " FROM " + name
+		if o.Where != "" {
+			q += " WHERE " + o.Where
+		}
+		if _, err := ew.query(ctx, db, q, nil, 0); err != nil {
+			return ew.count, err
+		}
+		if o.Progress != nil {
+			o.Progress(ew.count)
+		}
+		return ew.count, ew.flush()
+	}
+
+	// the primary key columns are selected last, and not written, so that
+	// the next chunk can start after the last row
+	quotedPK := make([]string, len(pk))
+	placeholders := make([]string, len(pk))
+	for i, c := range pk {
+		quotedPK[i] = QuoteIdentifier(c)
+		placeholders[i] = "?"
+	}
+	keyList := strings.Join(quotedPK, ", ")
+	after := "(" + keyList + ") > (" + strings.Join(placeholders, ", ") + ")"
+
+	var last []any
+	for {
+		var conditions []string
+		if o.Where != "" {
+			conditions = append(conditions, "("+o.Where+")")
+		}
+		if last != nil {
+			conditions = append(conditions, after)
+		}
+
+		q := "SELECT " + selected + ", " + keyList + " FROM " + name
+		if len(conditions) > 0 {
+			q += " WHERE " + strings.Join(conditions, " AND ")
+		}
+		q += " ORDER BY " + keyList + " LIMIT " + strconv.Itoa(o.ChunkSize)
+
+		n := ew.count
+		last, err = ew.query(ctx, db, q, last, len(pk))
+		if err != nil {
+			return ew.count, err
+		}
+
+		if o.Progress != nil {
+			o.Progress(ew.count)
+		}
+
+		if ew.count-n < int64(o.ChunkSize) {
+			break
+		}
+	}
+
+	return ew.count, ew.flush()
+}
+
+func exportOptions(opts *ExportOptions) ExportOptions {
+	o := ExportOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Format == "" {
+		o.Format = ExportCSV
+	}
+	if o.ChunkSize < 1 {
+		o.ChunkSize = defaultExportChunkSize
+	}
+	return o
+}
+
+// exportWriter writes rows, possibly retrieved using multiple queries.
+type exportWriter struct {
+	opts  *ExportOptions
+	w     *bufio.Writer
+	csv   *csv.Writer
+	count int64
+
+	headerDone bool
+}
+
+func newExportWriter(w io.Writer, opts *ExportOptions) (*exportWriter, error) {
+	ew := &exportWriter{
+		opts: opts,
+		w:    bufio.NewWriter(w),
+	}
+
+	switch opts.Format {
+	case ExportCSV:
+		ew.csv = csv.NewWriter(ew.w)
+	case ExportTSV, ExportJSONLines:
+	default:
+		return nil, fmt.Errorf("xmysql: unsupported export format %q", opts.Format)
+	}
+
+	return ew, nil
+}
+
+// query executes q and writes the resulting rows leaving out the last
+// trailing columns. It returns the values of the trailing columns of the
+// last row, or nil when there were no rows.
+func (ew *exportWriter) query(ctx context.Context, db *sql.DB, q string, args []any, trailing int) ([]any, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, NewErrorQuery(err, q, args)
+	}
+	defer func() { _ = rows.Close() }()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	n := len(columnTypes) - trailing
+	names := make([]string, n)
+	types := make([]string, n)
+	for i, ct := range columnTypes[:n] {
+		names[i] = ct.Name()
+		types[i] = strings.TrimPrefix(ct.DatabaseTypeName(), "UNSIGNED ")
+	}
+
+	if err := ew.header(names); err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(columnTypes))
+	pointers := make([]any, len(columnTypes))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var last []any
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, NewError(err)
+		}
+
+		if err := ew.row(names, types, values[:n]); err != nil {
+			return nil, err
+		}
+		ew.count++
+
+		if trailing > 0 {
+			last = make([]any, trailing)
+			for i, v := range values[n:] {
+				if b, ok := v.([]byte); ok {
+					// scanned bytes are only valid until the next scan
+					v = append([]byte{}, b...)
+				}
+				last[i] = v
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return last, nil
+}
+
+func (ew *exportWriter) header(names []string) error {
+	if ew.headerDone || !ew.opts.Header {
+		return nil
+	}
+	ew.headerDone = true
+
+	switch ew.opts.Format {
+	case ExportCSV:
+		return ew.csv.Write(names)
+	case ExportTSV:
+		for i, name := range names {
+			if i > 0 {
+				_ = ew.w.WriteByte('\t')
+			}
+			writeLoadDataEscaped(ew.w, name)
+		}
+		return ew.w.WriteByte('\n')
+	}
+
+	return nil
+}
+
+func (ew *exportWriter) row(names, types []string, values []any) error {
+	switch ew.opts.Format {
+	case ExportCSV:
+		record := make([]string, len(values))
+		for i, v := range values {
+			text, isNull := exportText(types[i], v, ew.opts.BinaryHex)
+			if isNull {
+				text = ew.opts.NullText
+			}
+			record[i] = text
+		}
+		return ew.csv.Write(record)
+
+	case ExportTSV:
+		for i, v := range values {
+			if i > 0 {
+				_ = ew.w.WriteByte('\t')
+			}
+			text, isNull := exportText(types[i], v, ew.opts.BinaryHex)
+			if isNull {
+				_, _ = ew.w.WriteString(`\N`)
+			} else {
+				writeLoadDataEscaped(ew.w, text)
+			}
+		}
+		return ew.w.WriteByte('\n')
+
+	default:
+		_ = ew.w.WriteByte('{')
+		for i, v := range values {
+			if i > 0 {
+				_ = ew.w.WriteByte(',')
+			}
+			key, _ := json.Marshal(names[i])
+			_, _ = ew.w.Write(key)
+			_ = ew.w.WriteByte(':')
+
+			data, err := json.Marshal(exportJSONValue(types[i], v, ew.opts.BinaryHex))
+			if err != nil {
+				return fmt.Errorf("xmysql: exporting column %s: %w", names[i], err)
+			}
+			_, _ = ew.w.Write(data)
+		}
+		_, err := ew.w.WriteString("}\n")
+		return err
+	}
+}
+
+func (ew *exportWriter) flush() error {
+	if ew.csv != nil {
+		ew.csv.Flush()
+		if err := ew.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return ew.w.Flush()
+}
+
+// exportText returns v, of the MySQL type typeName, as text. It returns true
+// when v is NULL.
+func exportText(typeName string, v any, binaryHex bool) (string, bool) {
+	switch t := v.(type) {
+	case nil:
+		return "", true
+	case []byte:
+		switch {
+		case typeName == "BIT":
+			return strconv.FormatUint(bitValue(t), 10), false
+		case isExportBinaryType(typeName):
+			if binaryHex {
+				return hex.EncodeToString(t), false
+			}
+			return base64.StdEncoding.EncodeToString(t), false
+		}
+		return string(t), false
+	case int64:
+		return strconv.FormatInt(t, 10), false
+	case uint64:
+		return strconv.FormatUint(t, 10), false
+	case float32:
+		return strconv.FormatFloat(float64(t), 'g', -1, 32), false
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64), false
+	case time.Time:
+		if typeName == "DATE" {
+			return t.Format("2006-01-02"), false
+		}
+		return t.Format("2006-01-02 15:04:05.999999"), false
+	default:
+		return fmt.Sprint(t), false
+	}
+}
+
+// exportJSONValue returns v, of the MySQL type typeName, as value which is
+// marshalled as JSON. Numbers keep their precision, and JSON documents
+// are embedded.
+func exportJSONValue(typeName string, v any, binaryHex bool) any {
+	text, isNull := exportText(typeName, v, binaryHex)
+	if isNull {
+		return nil
+	}
+
+	switch typeName {
+	case "JSON":
+		if json.Valid([]byte(text)) {
+			return json.RawMessage(text)
+		}
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR", "BIT", "DECIMAL", "FLOAT", "DOUBLE":
+		if _, err := strconv.ParseFloat(text, 64); err == nil {
+			return json.Number(text)
+		}
+	}
+
+	return text
+}
+
+// bitValue returns the value of a BIT column, which is sent big-endian.
+func bitValue(b []byte) uint64 {
+	var buf [8]byte
+	if len(b) > len(buf) {
+		b = b[len(b)-len(buf):]
+	}
+	copy(buf[len(buf)-len(b):], b)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+func isExportBinaryType(typeName string) bool {
+	switch typeName {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestExportText(t *testing.T) {
+	var cases = map[string]struct {
+		typeName string
+		value    any
+		hex      bool
+		exp      string
+	}{
+		"decimal":          {typeName: "DECIMAL", value: []byte("12345678901234567890.10"), exp: "12345678901234567890.10"},
+		"bit":              {typeName: "BIT", value: []byte{1, 2}, exp: "258"},
+		"json":             {typeName: "JSON", value: []byte(`{"a": 1}`), exp: `{"a": 1}`},
+		"datetime as text": {typeName: "DATETIME", value: []byte("2023-02-01 10:04:05.120"), exp: "2023-02-01 10:04:05.120"},
+		"datetime":         {typeName: "DATETIME", value: time.Date(2023, 2, 1, 10, 4, 5, 120000000, time.UTC), exp: "2023-02-01 10:04:05.12"},
+		"date":             {typeName: "DATE", value: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), exp: "2023-02-01"},
+		"binary":           {typeName: "BLOB", value: []byte{0, 1, 2}, exp: "AAEC"},
+		"binary as hex":    {typeName: "VARBINARY", value: []byte{0, 1, 2}, hex: true, exp: "000102"},
+		"text":             {typeName: "TEXT", value: []byte("a\tb"), exp: "a\tb"},
+		"int64":            {typeName: "BIGINT", value: int64(-42), exp: "-42"},
+		"float32":          {typeName: "FLOAT", value: float32(1.5), exp: "1.5"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			have, isNull := exportText(c.typeName, c.value, c.hex)
+			xt.Assert(t, !isNull)
+			xt.Eq(t, c.exp, have)
+		})
+	}
+
+	t.Run("NULL", func(t *testing.T) {
+		_, isNull := exportText("INT", nil, false)
+		xt.Assert(t, isNull)
+	})
+}
+
+func TestExportJSONValue(t *testing.T) {
+	data, err := json.Marshal([]any{
+		exportJSONValue("DECIMAL", []byte("12345678901234567890.10"), false),
+		exportJSONValue("JSON", []byte(`{"a": [1, 2]}`), false),
+		exportJSONValue("BIT", []byte{5}, false),
+		exportJSONValue("VARCHAR", []byte("10"), false),
+		exportJSONValue("INT", nil, false),
+	})
+	xt.OK(t, err)
+	xt.Eq(t, `[12345678901234567890.10,{"a":[1,2]},5,"10",null]`, string(data))
+}
+
+func TestExportTable(t *testing.T) {
+	schemaName := "xmysql_test_export"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	_, err = db.Exec("CREATE TABLE items (region CHAR(2), id INT, price DECIMAL(10,2), flags BIT(8), " +
+		"doc JSON, created DATETIME(3), data VARBINARY(10), note TEXT, PRIMARY KEY (region, id))")
+	xt.OK(t, err)
+
+	for _, region := range []string{"eu", "us"} {
+		for i := 1; i <= 5; i++ {
+			_, err = db.Exec("INSERT INTO items VALUES (?, ?, 9.90, b'101', '{\"n\": 1}', "+
+				"'2023-02-01 10:04:05.120', 0x0001, 'tab\there')", region, i)
+			xt.OK(t, err)
+		}
+	}
+	_, err = db.Exec("INSERT INTO items (region, id) VALUES ('zz', 1)")
+	xt.OK(t, err)
+
+	ctx := context.Background()
+
+	t.Run("chunked", func(t *testing.T) {
+		var progress []int64
+		var buf bytes.Buffer
+		n, err := ExportTable(ctx, db, "items", &buf, &ExportOptions{
+			Format:    ExportTSV,
+			Header:    true,
+			Columns:   []string{"id", "price", "note"},
+			ChunkSize: 4,
+			Progress:  func(rows int64) { progress = append(progress, rows) },
+		})
+		xt.OK(t, err)
+		xt.Eq(t, int64(11), n)
+		xt.Eq(t, []int64{4, 8, 11}, progress)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		xt.Eq(t, 12, len(lines))
+		xt.Eq(t, "id\tprice\tnote", lines[0])
+		xt.Eq(t, "1\t9.90\ttab\\there", lines[1])
+		xt.Eq(t, "1\t\\N\t\\N", lines[11])
+	})
+
+	t.Run("where", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := ExportTable(ctx, db, "items", &buf, &ExportOptions{Where: "region = 'us'", ChunkSize: 2})
+		xt.OK(t, err)
+		xt.Eq(t, int64(5), n)
+	})
+
+	t.Run("JSON lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := Export(ctx, db, &buf, &ExportOptions{Format: ExportJSONLines},
+			"SELECT * FROM items WHERE region = ? AND id = ?", "eu", 1)
+		xt.OK(t, err)
+		xt.Eq(t, int64(1), n)
+		xt.Eq(t, `{"region":"eu","id":1,"price":9.90,"flags":5,"doc":{"n":1},`+
+			`"created":"2023-02-01 10:04:05.120","data":"AAE=","note":"tab\there"}`+"\n", buf.String())
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := Export(ctx, db, &buf, &ExportOptions{NullText: "NULL", Header: true},
+			"SELECT id, note FROM items WHERE region = 'zz'")
+		xt.OK(t, err)
+		xt.Eq(t, "id,note\n1,NULL\n", buf.String())
+	})
+}
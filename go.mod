@@ -10,6 +10,7 @@ require (
 	github.com/golistic/pxmysql v0.9.7
 	github.com/golistic/xgo v1.0.0
 	golang.org/x/text v0.12.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
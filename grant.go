@@ -0,0 +1,474 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// PrivilegeLevel is the level at which a privilege applies.
+type PrivilegeLevel string
+
+const (
+	PrivilegeLevelGlobal  PrivilegeLevel = "GLOBAL"
+	PrivilegeLevelSchema  PrivilegeLevel = "SCHEMA"
+	PrivilegeLevelTable   PrivilegeLevel = "TABLE"
+	PrivilegeLevelColumn  PrivilegeLevel = "COLUMN"
+	PrivilegeLevelRoutine PrivilegeLevel = "ROUTINE"
+)
+
+// GrantObjectType is the type of object a privilege is granted on.
+type GrantObjectType string
+
+const (
+	GrantObjectTable     GrantObjectType = "TABLE"
+	GrantObjectProcedure GrantObjectType = "PROCEDURE"
+	GrantObjectFunction  GrantObjectType = "FUNCTION"
+)
+
+// PrivilegeAll is the name used for all privileges of a level.
+const PrivilegeAll = "ALL PRIVILEGES"
+
+// Privilege is a privilege granted (or partially revoked) to an account.
+type Privilege struct {
+	// Name is the upper case name of the privilege, for example "SELECT",
+	// or PrivilegeAll.
+	Name string
+	// Columns is set for column-level privileges.
+	Columns []string
+	// Schema is the schema of the object; empty or "*" for global privileges.
+	// Schema names can contain the wildcards % and _.
+	Schema string
+	// Object is the table or routine name; empty or "*" for schema-level privileges.
+	Object     string
+	ObjectType GrantObjectType
+	// GrantOption is whether the account can grant the privilege to others.
+	GrantOption bool
+	// Revoked is set when the privilege was partially revoked.
+	Revoked bool
+}
+
+// Level returns the level at which p applies.
+func (p Privilege) Level() PrivilegeLevel {
+	switch {
+	case p.Schema == "" || p.Schema == "*":
+		return PrivilegeLevelGlobal
+	case p.Object == "" || p.Object == "*":
+		return PrivilegeLevelSchema
+	case p.ObjectType == GrantObjectProcedure || p.ObjectType == GrantObjectFunction:
+		return PrivilegeLevelRoutine
+	case len(p.Columns) > 0:
+		return PrivilegeLevelColumn
+	default:
+		return PrivilegeLevelTable
+	}
+}
+
+// target returns the privilege level as used in GRANT and REVOKE statements,
+// for example `shop`.`orders`.
+func (p Privilege) target() string {
+	schema, object := "*", "*"
+	if p.Schema != "" && p.Schema != "*" {
+		schema = QuoteIdentifier(p.Schema)
+	}
+	if p.Object != "" && p.Object != "*" {
+		object = QuoteIdentifier(p.Object)
+	}
+
+	t := schema + "." + object
+	if p.ObjectType != "" {
+		t = string(p.ObjectType) + " " + t
+	}
+	return t
+}
+
+// privilege returns the privilege as used in GRANT and REVOKE statements,
+// including the columns when available.
+func (p Privilege) privilege() string {
+	if len(p.Columns) == 0 {
+		return p.Name
+	}
+
+	columns := make([]string, len(p.Columns))
+	for i, c := range p.Columns {
+		columns[i] = QuoteIdentifier(c)
+	}
+
+	return p.Name + " (" + strings.Join(columns, ", ") + ")"
+}
+
+// RoleGrant is a role granted to an account.
+type RoleGrant struct {
+	Role        string
+	Host        string
+	AdminOption bool
+}
+
+// AccountGrants holds the privileges and roles granted to an account.
+type AccountGrants struct {
+	Privileges []Privilege
+	Roles      []RoleGrant
+}
+
+// GrantPrivileges grants the privileges to the account user@host using the already
+// open connection db. Each privilege is granted using a separate statement.
+// When host is empty, "%" is used.
+//
+// When error is returned, it is of type xmysql.Error.
+func GrantPrivileges(db *sql.DB, user, host string, privileges ...Privilege) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	account := accountName(user, host, nbe)
+	for _, p := range privileges {
+		q := "GRANT " + p.privilege() + " ON " + p.target() + " TO " + account
+		if p.GrantOption {
+			q += " WITH GRANT OPTION"
+		}
+
+		if _, err := db.Exec(q); err != nil {
+			return NewError(err)
+		}
+	}
+
+	return nil
+}
+
+// RevokePrivileges revokes the privileges from the account user@host using the already
+// open connection db. When the GrantOption of a privilege is set, the grant option
+// is revoked as well. When host is empty, "%" is used.
+//
+// When error is returned, it is of type xmysql.Error.
+func RevokePrivileges(db *sql.DB, user, host string, privileges ...Privilege) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	account := accountName(user, host, nbe)
+	for _, p := range privileges {
+		privs := p.privilege()
+		if p.GrantOption {
+			privs += ", GRANT OPTION"
+		}
+
+		q := "REVOKE " + privs + " ON " + p.target() + " FROM " + account
+		if _, err := db.Exec(q); err != nil {
+			return NewError(err)
+		}
+	}
+
+	return nil
+}
+
+// Grants retrieves the privileges and roles granted to the account user@host
+// using SHOW GRANTS. When host is empty, "%" is used.
+//
+// When error is returned, it is of type xmysql.Error.
+func Grants(db *sql.DB, user, host string) (*AccountGrants, error) {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SHOW GRANTS FOR " + accountName(user, host, nbe))
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var statements []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, NewError(err)
+		}
+		statements = append(statements, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return ParseGrants(statements)
+}
+
+// ParseGrants parses the statements as returned by SHOW GRANTS. Statements
+// granting proxy privileges are ignored.
+func ParseGrants(statements []string) (*AccountGrants, error) {
+	grants := &AccountGrants{}
+
+	for _, s := range statements {
+		if err := parseGrant(s, grants); err != nil {
+			return nil, err
+		}
+	}
+
+	return grants, nil
+}
+
+func parseGrant(statement string, grants *AccountGrants) error {
+	tokens, err := tokenizeGrant(statement)
+	if err != nil {
+		return err
+	}
+
+	p := &grantParser{tokens: tokens, statement: statement}
+
+	var revoke bool
+	switch {
+	case p.acceptWord("GRANT"):
+	case p.acceptWord("REVOKE"):
+		revoke = true
+	default:
+		return p.errorf("expected GRANT or REVOKE")
+	}
+
+	if p.isRoleGrant() {
+		var roles []RoleGrant
+		for {
+			name, host, err := p.account()
+			if err != nil {
+				return err
+			}
+			roles = append(roles, RoleGrant{Role: name, Host: host})
+			if !p.accept(',') {
+				break
+			}
+		}
+
+		if !p.acceptWord("TO") {
+			return p.errorf("expected TO")
+		}
+		if _, _, err := p.account(); err != nil {
+			return err
+		}
+
+		admin := p.acceptWord("WITH") && p.acceptWord("ADMIN") && p.acceptWord("OPTION")
+		for i := range roles {
+			roles[i].AdminOption = admin
+		}
+		grants.Roles = append(grants.Roles, roles...)
+		return nil
+	}
+
+	var privileges []Privilege
+	for {
+		var words []string
+		for p.peek().kind == 'w' && !p.peekWord("ON") {
+			words = append(words, strings.ToUpper(p.next().text))
+		}
+		if len(words) == 0 {
+			return p.errorf("expected privilege")
+		}
+
+		priv := Privilege{Name: strings.Join(words, " "), Revoked: revoke}
+		if priv.Name == "ALL" {
+			priv.Name = PrivilegeAll
+		}
+
+		if p.accept('(') {
+			for {
+				t := p.next()
+				if t.kind != 'w' && t.kind != 'q' {
+					return p.errorf("expected column name")
+				}
+				priv.Columns = append(priv.Columns, t.text)
+				if !p.accept(',') {
+					break
+				}
+			}
+			if !p.accept(')') {
+				return p.errorf("expected )")
+			}
+		}
+
+		privileges = append(privileges, priv)
+		if !p.accept(',') {
+			break
+		}
+	}
+
+	if !p.acceptWord("ON") {
+		return p.errorf("expected ON")
+	}
+
+	var objectType GrantObjectType
+	for _, ot := range []GrantObjectType{GrantObjectTable, GrantObjectProcedure, GrantObjectFunction} {
+		if p.peekWord(string(ot)) && p.peekAt(1).kind != '.' {
+			p.next()
+			objectType = ot
+			break
+		}
+	}
+
+	schema := p.next()
+	if p.peek().kind == '@' {
+		// proxy privileges are granted on accounts; not supported
+		return nil
+	}
+	if !p.accept('.') {
+		return p.errorf("expected .")
+	}
+	object := p.next()
+
+	for _, t := range []grantToken{schema, object} {
+		if t.kind != 'w' && t.kind != 'q' && t.kind != '*' {
+			return p.errorf("expected object name")
+		}
+	}
+
+	if !p.acceptWord("TO") && !p.acceptWord("FROM") {
+		return p.errorf("expected TO or FROM")
+	}
+	if _, _, err := p.account(); err != nil {
+		return err
+	}
+
+	grantOption := p.acceptWord("WITH") && p.acceptWord("GRANT") && p.acceptWord("OPTION")
+
+	for _, priv := range privileges {
+		priv.Schema = schema.text
+		priv.Object = object.text
+		priv.ObjectType = objectType
+		priv.GrantOption = grantOption
+		grants.Privileges = append(grants.Privileges, priv)
+	}
+
+	return nil
+}
+
+type grantToken struct {
+	kind byte // 'w' for words, 'q' for quoted, 0 at end, otherwise punctuation
+	text string
+}
+
+func tokenizeGrant(s string) ([]grantToken, error) {
+	var tokens []grantToken
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '`' || c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						b.WriteByte(c)
+						j++
+						continue
+					}
+					break
+				}
+				if s[j] == '\\' && c != '`' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("xmysql: unclosed quote at position %d in grant statement", i)
+			}
+			tokens = append(tokens, grantToken{kind: 'q', text: b.String()})
+			i = j + 1
+		case strings.IndexByte(",().@*", c) >= 0:
+			tokens = append(tokens, grantToken{kind: c, text: string(c)})
+			i++
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\r\n,().@*`'\"", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, grantToken{kind: 'w', text: s[i:j]})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+type grantParser struct {
+	tokens    []grantToken
+	pos       int
+	statement string
+}
+
+func (p *grantParser) peekAt(n int) grantToken {
+	if p.pos+n < len(p.tokens) {
+		return p.tokens[p.pos+n]
+	}
+	return grantToken{}
+}
+
+func (p *grantParser) peek() grantToken {
+	return p.peekAt(0)
+}
+
+func (p *grantParser) next() grantToken {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *grantParser) peekWord(w string) bool {
+	t := p.peek()
+	return t.kind == 'w' && strings.EqualFold(t.text, w)
+}
+
+func (p *grantParser) acceptWord(w string) bool {
+	if p.peekWord(w) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *grantParser) accept(kind byte) bool {
+	if p.peek().kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// isRoleGrant returns whether the statement grants roles, which is the case
+// when there is no ON clause.
+func (p *grantParser) isRoleGrant() bool {
+	for _, t := range p.tokens[p.pos:] {
+		if t.kind == 'w' && strings.EqualFold(t.text, "ON") {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *grantParser) account() (string, string, error) {
+	name := p.next()
+	if name.kind != 'w' && name.kind != 'q' {
+		return "", "", p.errorf("expected account name")
+	}
+
+	if !p.accept('@') {
+		return name.text, "%", nil
+	}
+
+	host := p.next()
+	if host.kind != 'w' && host.kind != 'q' {
+		return "", "", p.errorf("expected account host")
+	}
+
+	return name.text, host.text, nil
+}
+
+func (p *grantParser) errorf(format string, a ...any) error {
+	return fmt.Errorf("xmysql: %s in grant statement %q", fmt.Sprintf(format, a...), p.statement)
+}
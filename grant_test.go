@@ -0,0 +1,185 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"testing"
+
+	"github.com/golistic/xgo/xt"
+)
+
+func TestParseGrants(t *testing.T) {
+	t.Run("privileges", func(t *testing.T) {
+		grants, err := ParseGrants([]string{
+			"GRANT USAGE ON *.* TO `app`@`%`",
+			"GRANT SELECT, INSERT ON `shop`.* TO `app`@`%` WITH GRANT OPTION",
+			"GRANT SELECT (`id`, `email`), UPDATE (`email`) ON `shop`.`users` TO `app`@`%`",
+			"GRANT EXECUTE ON PROCEDURE `shop`.`checkout` TO `app`@`%`",
+			"GRANT BACKUP_ADMIN,BINLOG_ADMIN ON *.* TO `app`@`%`",
+			"GRANT ALL PRIVILEGES ON `app\\_%`.* TO 'app'@'%'",
+			"GRANT PROXY ON ''@'' TO 'root'@'localhost' WITH GRANT OPTION",
+		})
+		xt.OK(t, err)
+		xt.Eq(t, 0, len(grants.Roles))
+		xt.Eq(t, 9, len(grants.Privileges))
+
+		p := grants.Privileges
+		xt.Eq(t, "USAGE", p[0].Name)
+		xt.Eq(t, PrivilegeLevelGlobal, p[0].Level())
+
+		xt.Eq(t, "INSERT", p[2].Name)
+		xt.Eq(t, "shop", p[2].Schema)
+		xt.Eq(t, PrivilegeLevelSchema, p[2].Level())
+		xt.Assert(t, p[2].GrantOption)
+
+		xt.Eq(t, "SELECT", p[3].Name)
+		xt.Eq(t, []string{"id", "email"}, p[3].Columns)
+		xt.Eq(t, "users", p[3].Object)
+		xt.Eq(t, PrivilegeLevelColumn, p[3].Level())
+		xt.Eq(t, []string{"email"}, p[4].Columns)
+
+		xt.Eq(t, "EXECUTE", p[5].Name)
+		xt.Eq(t, GrantObjectProcedure, p[5].ObjectType)
+		xt.Eq(t, PrivilegeLevelRoutine, p[5].Level())
+
+		xt.Eq(t, "BINLOG_ADMIN", p[7].Name)
+
+		xt.Eq(t, PrivilegeAll, p[8].Name)
+		xt.Eq(t, `app\_%`, p[8].Schema)
+	})
+
+	t.Run("roles and partial revokes", func(t *testing.T) {
+		grants, err := ParseGrants([]string{
+			"GRANT SELECT ON *.* TO `app`@`%`",
+			"REVOKE SELECT ON `mysql`.* FROM `app`@`%`",
+			"GRANT `reader`@`%`,`writer`@`%` TO `app`@`%` WITH ADMIN OPTION",
+		})
+		xt.OK(t, err)
+		xt.Eq(t, 2, len(grants.Privileges))
+		xt.Assert(t, grants.Privileges[1].Revoked)
+
+		xt.Eq(t, []RoleGrant{
+			{Role: "reader", Host: "%", AdminOption: true},
+			{Role: "writer", Host: "%", AdminOption: true},
+		}, grants.Roles)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseGrants([]string{"GRANT SELECT ON `shop TO `app`@`%`"})
+		xt.KO(t, err)
+
+		_, err = ParseGrants([]string{"SELECT 1"})
+		xt.KO(t, err)
+	})
+}
+
+func TestPrivilegeSet_Allows(t *testing.T) {
+	ps := PrivilegeSet{
+		{Name: "SELECT"},
+		{Name: "SELECT", Schema: "mysql", Revoked: true},
+		{Name: PrivilegeAll, Schema: `tenant\_%`},
+		{Name: "INSERT", Schema: "shop", Object: "orders"},
+		{Name: "UPDATE", Schema: "shop", Object: "users", Columns: []string{"email"}},
+	}
+
+	xt.Assert(t, ps.Allows("select", "shop", "users"))
+	xt.Assert(t, !ps.Allows("SELECT", "mysql", "user"))
+	xt.Assert(t, ps.Allows("DROP", "tenant_42", ""))
+	xt.Assert(t, !ps.Allows("DROP", "tenantX42", ""))
+	xt.Assert(t, !ps.Allows("DROP", "shop", ""))
+	xt.Assert(t, ps.Allows("INSERT", "shop", "orders"))
+	xt.Assert(t, !ps.Allows("INSERT", "shop", "users"))
+	xt.Assert(t, !ps.Allows("UPDATE", "shop", "users"))
+}
+
+func TestGrantPrivileges(t *testing.T) {
+	user := "xmysql_test_grants"
+	role := "xmysql_test_role"
+	schemaName := "xmysql_test_grants"
+
+	_ = DropAccount(testDB, user, "")
+	_ = DropRole(testDB, role)
+	_ = DropSchema(testDB, schemaName)
+	defer func() {
+		_ = DropAccount(testDB, user, "")
+		_ = DropRole(testDB, role)
+		_ = DropSchema(testDB, schemaName)
+	}()
+
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	xt.OK(t, CreateAccount(testDB, user, "", nil))
+	xt.OK(t, CreateRole(testDB, role))
+
+	xt.OK(t, GrantPrivileges(testDB, user, "",
+		Privilege{Name: "SELECT", Schema: schemaName},
+		Privilege{Name: "PROCESS"},
+	))
+	xt.OK(t, GrantPrivileges(testDB, role, "", Privilege{Name: "INSERT", Schema: schemaName}))
+	xt.OK(t, GrantRoles(testDB, user, "", role))
+	xt.OK(t, SetDefaultRoles(testDB, user, "", role))
+
+	t.Run("grants", func(t *testing.T) {
+		grants, err := Grants(testDB, user, "")
+		xt.OK(t, err)
+		xt.Eq(t, []RoleGrant{{Role: role, Host: "%"}}, grants.Roles)
+	})
+
+	t.Run("effective privileges", func(t *testing.T) {
+		ps, err := EffectivePrivileges(testDB, user, "")
+		xt.OK(t, err)
+
+		xt.Assert(t, ps.Allows("SELECT", schemaName, ""))
+		xt.Assert(t, ps.Allows("INSERT", schemaName, ""))
+		xt.Assert(t, ps.Allows("PROCESS", "", ""))
+		xt.Assert(t, !ps.Allows("DROP", schemaName, ""))
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		xt.OK(t, RevokeRoles(testDB, user, "", role))
+		xt.OK(t, RevokePrivileges(testDB, user, "", Privilege{Name: "SELECT", Schema: schemaName}))
+
+		ps, err := EffectivePrivileges(testDB, user, "")
+		xt.OK(t, err)
+		xt.Assert(t, !ps.Allows("SELECT", schemaName, ""))
+		xt.Assert(t, !ps.Allows("INSERT", schemaName, ""))
+	})
+}
+
+func TestGrantPrivileges_noBackslashEscapes(t *testing.T) {
+	db := testDBNoBackslashEscapes(t)
+	user := `xmysql_test\grants`
+	role := `xmysql_test\role`
+
+	_ = DropAccount(db, user, "")
+	_ = DropRole(db, role)
+	defer func() {
+		_ = DropAccount(db, user, "")
+		_ = DropRole(db, role)
+	}()
+
+	xt.OK(t, CreateAccount(db, user, "", nil))
+	xt.OK(t, CreateRole(db, role))
+	xt.OK(t, GrantPrivileges(db, user, "", Privilege{Name: "PROCESS"}))
+	xt.OK(t, GrantRoles(db, user, "", role))
+	xt.OK(t, SetDefaultRoles(db, user, "", role))
+
+	grants, err := Grants(db, user, "")
+	xt.OK(t, err)
+	xt.Eq(t, []RoleGrant{{Role: role, Host: "%"}}, grants.Roles)
+
+	ps, err := EffectivePrivileges(db, user, "")
+	xt.OK(t, err)
+	xt.Assert(t, ps.Allows("PROCESS", "", ""))
+
+	xt.OK(t, RevokeRoles(db, user, "", role))
+	xt.OK(t, RevokePrivileges(db, user, "", Privilege{Name: "PROCESS"}))
+
+	grants, err = Grants(db, user, "")
+	xt.OK(t, err)
+	xt.Eq(t, 0, len(grants.Roles))
+}
+
+func TestRoleList(t *testing.T) {
+	xt.Eq(t, `'a\\b'@'%', 'c'@'%'`, roleList([]string{`a\b`, "c"}, false))
+	xt.Eq(t, `'a\b'@'%', 'c'@'%'`, roleList([]string{`a\b`, "c"}, true))
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	reGTIDUUID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	reGTIDTag  = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,31}$`)
+)
+
+// GTIDInterval is a range of transaction numbers, inclusive.
+type GTIDInterval struct {
+	Start uint64
+	End   uint64
+}
+
+// gtidSource identifies the transactions of a source server, optionally
+// with a tag (MySQL 8.3 and later).
+type gtidSource struct {
+	uuid string
+	tag  string
+}
+
+// GTIDSet is a set of global transaction identifiers as used by MySQL, for
+// example, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,9e9a...:1-100". Tagged
+// GTIDs, for example "3e11fa47-71ca-11e1-9e33-c80aa9429562:batch:1-3", are
+// supported. The zero value is an empty set.
+//
+// Operations do not modify the set but return a new one.
+type GTIDSet struct {
+	intervals map[gtidSource][]GTIDInterval
+}
+
+// ParseGTIDSet parses s which holds a GTID set as reported by MySQL, for
+// example using the gtid_executed variable. Whitespace, including the
+// newlines added by MySQL, is ignored. UUIDs and tags are case-insensitive.
+func ParseGTIDSet(s string) (GTIDSet, error) {
+	set := GTIDSet{intervals: map[gtidSource][]GTIDInterval{}}
+
+	s = strings.Join(strings.Fields(s), "")
+	if s == "" {
+		return set, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, ":")
+		uuid := strings.ToLower(fields[0])
+		if !reGTIDUUID.MatchString(uuid) {
+			return GTIDSet{}, fmt.Errorf("xmysql: invalid UUID %q in GTID set", fields[0])
+		}
+		if len(fields) < 2 {
+			return GTIDSet{}, fmt.Errorf("xmysql: missing interval in GTID set for %s", uuid)
+		}
+
+		src := gtidSource{uuid: uuid}
+		tagged := false
+		for _, f := range fields[1:] {
+			if f == "" {
+				return GTIDSet{}, fmt.Errorf("xmysql: empty interval in GTID set for %s", uuid)
+			}
+
+			if c := f[0]; c < '0' || c > '9' {
+				tag := strings.ToLower(f)
+				if !reGTIDTag.MatchString(tag) {
+					return GTIDSet{}, fmt.Errorf("xmysql: invalid tag %q in GTID set", f)
+				}
+				if tagged {
+					return GTIDSet{}, fmt.Errorf("xmysql: missing interval in GTID set for tag %s", src.tag)
+				}
+				src.tag = tag
+				tagged = true
+				continue
+			}
+
+			iv, err := parseGTIDInterval(f)
+			if err != nil {
+				return GTIDSet{}, err
+			}
+			set.intervals[src] = append(set.intervals[src], iv)
+			tagged = false
+		}
+
+		if tagged {
+			return GTIDSet{}, fmt.Errorf("xmysql: missing interval in GTID set for tag %s", src.tag)
+		}
+	}
+
+	for src, ivs := range set.intervals {
+		set.intervals[src] = normalizeGTIDIntervals(ivs)
+	}
+
+	return set, nil
+}
+
+// MustParseGTIDSet calls ParseGTIDSet but instead of returning errors, it panics.
+func MustParseGTIDSet(s string) GTIDSet {
+	set, err := ParseGTIDSet(s)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+func parseGTIDInterval(s string) (GTIDInterval, error) {
+	start, end, isRange := strings.Cut(s, "-")
+
+	a, err := strconv.ParseUint(start, 10, 64)
+	if err != nil || a == 0 {
+		return GTIDInterval{}, fmt.Errorf("xmysql: invalid interval %q in GTID set", s)
+	}
+
+	b := a
+	if isRange {
+		if b, err = strconv.ParseUint(end, 10, 64); err != nil || b < a {
+			return GTIDInterval{}, fmt.Errorf("xmysql: invalid interval %q in GTID set", s)
+		}
+	}
+
+	return GTIDInterval{Start: a, End: b}, nil
+}
+
+// normalizeGTIDIntervals sorts the intervals and merges those overlapping or
+// adjacent.
+func normalizeGTIDIntervals(ivs []GTIDInterval) []GTIDInterval {
+	if len(ivs) == 0 {
+		return nil
+	}
+
+	sorted := append([]GTIDInterval{}, ivs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	result := []GTIDInterval{sorted[0]}
+	for _, iv := range sorted[1:] {
+		last := &result[len(result)-1]
+		if iv.Start <= last.End+1 {
+			if iv.End > last.End {
+				last.End = iv.End
+			}
+			continue
+		}
+		result = append(result, iv)
+	}
+
+	return result
+}
+
+// String returns the set formatted like MySQL does, without newlines. UUIDs
+// are sorted, and, per UUID, the untagged intervals come before those of tags
+// which are sorted by name.
+func (g GTIDSet) String() string {
+	sources := g.sources()
+
+	var parts []string
+	var cur strings.Builder
+	for i, src := range sources {
+		if i == 0 || sources[i-1].uuid != src.uuid {
+			if cur.Len() > 0 {
+				parts = append(parts, cur.String())
+				cur.Reset()
+			}
+			cur.WriteString(src.uuid)
+		}
+
+		if src.tag != "" {
+			cur.WriteString(":" + src.tag)
+		}
+		for _, iv := range g.intervals[src] {
+			cur.WriteString(":" + strconv.FormatUint(iv.Start, 10))
+			if iv.End != iv.Start {
+				cur.WriteString("-" + strconv.FormatUint(iv.End, 10))
+			}
+		}
+	}
+	if cur.Len() > 0 {
+		parts = append(parts, cur.String())
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (g GTIDSet) sources() []gtidSource {
+	sources := make([]gtidSource, 0, len(g.intervals))
+	for src, ivs := range g.intervals {
+		if len(ivs) > 0 {
+			sources = append(sources, src)
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].uuid != sources[j].uuid {
+			return sources[i].uuid < sources[j].uuid
+		}
+		return sources[i].tag < sources[j].tag
+	})
+	return sources
+}
+
+// IsEmpty returns whether the set holds no transactions.
+func (g GTIDSet) IsEmpty() bool {
+	return len(g.sources()) == 0
+}
+
+// Intervals returns the intervals of transactions of the source server with
+// given UUID and tag. The tag is empty for untagged GTIDs.
+func (g GTIDSet) Intervals(uuid, tag string) []GTIDInterval {
+	ivs := g.intervals[gtidSource{uuid: strings.ToLower(uuid), tag: strings.ToLower(tag)}]
+	return append([]GTIDInterval{}, ivs...)
+}
+
+// UUIDs returns the sorted UUIDs of the source servers of which g holds
+// transactions.
+func (g GTIDSet) UUIDs() []string {
+	var uuids []string
+	for _, src := range g.sources() {
+		if len(uuids) == 0 || uuids[len(uuids)-1] != src.uuid {
+			uuids = append(uuids, src.uuid)
+		}
+	}
+	return uuids
+}
+
+// Tags returns the sorted tags used by the transactions of the source server
+// with given UUID. The empty tag is included, first, when g holds untagged
+// transactions of the server.
+func (g GTIDSet) Tags(uuid string) []string {
+	uuid = strings.ToLower(uuid)
+
+	var tags []string
+	for _, src := range g.sources() {
+		if src.uuid == uuid {
+			tags = append(tags, src.tag)
+		}
+	}
+	return tags
+}
+
+// Add returns the set holding the transactions of g and transaction number n
+// of the source server with given UUID and tag.
+func (g GTIDSet) Add(uuid, tag string, n uint64) GTIDSet {
+	src := gtidSource{uuid: strings.ToLower(uuid), tag: strings.ToLower(tag)}
+	return g.Union(GTIDSet{intervals: map[gtidSource][]GTIDInterval{
+		src: {{Start: n, End: n}},
+	}})
+}
+
+// Union returns the set holding the transactions of both g and other.
+func (g GTIDSet) Union(other GTIDSet) GTIDSet {
+	result := GTIDSet{intervals: map[gtidSource][]GTIDInterval{}}
+	for _, set := range []GTIDSet{g, other} {
+		for src, ivs := range set.intervals {
+			result.intervals[src] = append(result.intervals[src], ivs...)
+		}
+	}
+	for src, ivs := range result.intervals {
+		result.intervals[src] = normalizeGTIDIntervals(ivs)
+	}
+	return result
+}
+
+// Subtract returns the set holding the transactions of g which are not
+// in other.
+func (g GTIDSet) Subtract(other GTIDSet) GTIDSet {
+	result := GTIDSet{intervals: map[gtidSource][]GTIDInterval{}}
+
+	for src, ivs := range g.intervals {
+		remaining := append([]GTIDInterval{}, ivs...)
+
+		for _, sub := range other.intervals[src] {
+			var next []GTIDInterval
+			for _, iv := range remaining {
+				if sub.End < iv.Start || sub.Start > iv.End {
+					next = append(next, iv)
+					continue
+				}
+				if sub.Start > iv.Start {
+					next = append(next, GTIDInterval{Start: iv.Start, End: sub.Start - 1})
+				}
+				if sub.End < iv.End {
+					next = append(next, GTIDInterval{Start: sub.End + 1, End: iv.End})
+				}
+			}
+			remaining = next
+		}
+
+		if len(remaining) > 0 {
+			result.intervals[src] = remaining
+		}
+	}
+
+	return result
+}
+
+// Contains returns whether g holds all transactions of other.
+func (g GTIDSet) Contains(other GTIDSet) bool {
+	return other.Subtract(g).IsEmpty()
+}
+
+// ContainsGTID returns whether g holds transaction number n of the source
+// server with given UUID and tag. The tag is empty for untagged GTIDs.
+func (g GTIDSet) ContainsGTID(uuid, tag string, n uint64) bool {
+	for _, iv := range g.intervals[gtidSource{uuid: strings.ToLower(uuid), tag: strings.ToLower(tag)}] {
+		if n >= iv.Start && n <= iv.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal returns whether g and other hold the same transactions.
+func (g GTIDSet) Equal(other GTIDSet) bool {
+	return g.Contains(other) && other.Contains(g)
+}
+
+// GTIDExecuted returns the GTIDs of the transactions executed by the server
+// using the gtid_executed global variable.
+func GTIDExecuted(db *sql.DB) (GTIDSet, error) {
+	return gtidSetVariable(db, "gtid_executed")
+}
+
+// GTIDPurged returns the GTIDs of the transactions which were purged from
+// the binary log using the gtid_purged global variable.
+func GTIDPurged(db *sql.DB) (GTIDSet, error) {
+	return gtidSetVariable(db, "gtid_purged")
+}
+
+// gtidSetVariable returns the GTID set stored in the global system variable
+// name. The variable is selected directly, since performance_schema truncates
+// values to 1024 characters.
+func gtidSetVariable(db *sql.DB, name string) (GTIDSet, error) {
+	var v string
+	q := "SELECT @@GLOBAL." + name
+	if err := db.QueryRow(q).Scan(&v); err != nil {
+		return GTIDSet{}, NewErrorQuery(err, q, nil)
+	}
+	return ParseGTIDSet(v)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golistic/xgo/xt"
+)
+
+const (
+	testUUID1 = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	testUUID2 = "9e9a2b3c-71ca-11e1-9e33-c80aa9429562"
+)
+
+func TestParseGTIDSet(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		var cases = map[string]struct {
+			have string
+			exp  string
+		}{
+			"empty":          {have: "", exp: ""},
+			"single":         {have: testUUID1 + ":5", exp: testUUID1 + ":5"},
+			"intervals":      {have: testUUID1 + ":1-5:7:9-10", exp: testUUID1 + ":1-5:7:9-10"},
+			"merged":         {have: testUUID1 + ":6-8:1-5:3:10", exp: testUUID1 + ":1-8:10"},
+			"sorted":         {have: testUUID2 + ":1-100,\n" + testUUID1 + ":1-5", exp: testUUID1 + ":1-5," + testUUID2 + ":1-100"},
+			"upper case":     {have: "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-3", exp: testUUID1 + ":1-3"},
+			"tagged":         {have: testUUID1 + ":1-3:11:47-49:Domain_1:1-5", exp: testUUID1 + ":1-3:11:47-49:domain_1:1-5"},
+			"tags sorted":    {have: testUUID1 + ":b:1:a:2-3," + testUUID1 + ":4", exp: testUUID1 + ":4:a:2-3:b:1"},
+			"repeated UUIDs": {have: testUUID1 + ":1-2," + testUUID1 + ":3-4", exp: testUUID1 + ":1-4"},
+		}
+
+		for name, c := range cases {
+			t.Run(name, func(t *testing.T) {
+				set, err := ParseGTIDSet(c.have)
+				xt.OK(t, err)
+				xt.Eq(t, c.exp, set.String())
+			})
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{
+			"not-a-uuid:1",
+			testUUID1,
+			testUUID1 + ":0",
+			testUUID1 + ":5-3",
+			testUUID1 + ":1-x",
+			testUUID1 + "::1",
+			testUUID1 + ":tag",
+			testUUID1 + ":tag1:tag2:1",
+			testUUID1 + ":1:Invalid-Tag:2",
+		} {
+			t.Run(s, func(t *testing.T) {
+				_, err := ParseGTIDSet(s)
+				xt.KO(t, err)
+			})
+		}
+	})
+}
+
+func TestGTIDSet_Arithmetic(t *testing.T) {
+	a := MustParseGTIDSet(testUUID1 + ":1-10:20:t:1-5," + testUUID2 + ":1-3")
+	b := MustParseGTIDSet(testUUID1 + ":5-7:t:5-6")
+
+	t.Run("union", func(t *testing.T) {
+		xt.Eq(t, testUUID1+":1-10:20:t:1-6,"+testUUID2+":1-3", a.Union(b).String())
+		xt.Eq(t, a.String(), a.Union(GTIDSet{}).String())
+	})
+
+	t.Run("subtract", func(t *testing.T) {
+		xt.Eq(t, testUUID1+":1-4:8-10:20:t:1-4,"+testUUID2+":1-3", a.Subtract(b).String())
+		xt.Eq(t, "", b.Subtract(a.Union(b)).String())
+		xt.Assert(t, a.Subtract(a).IsEmpty())
+	})
+
+	t.Run("contains", func(t *testing.T) {
+		xt.Assert(t, !a.Contains(b))
+		xt.Assert(t, a.Union(b).Contains(b))
+		xt.Assert(t, a.Contains(GTIDSet{}))
+		xt.Assert(t, !GTIDSet{}.Contains(a))
+
+		xt.Assert(t, a.ContainsGTID(testUUID1, "", 20))
+		xt.Assert(t, !a.ContainsGTID(testUUID1, "", 11))
+		xt.Assert(t, a.ContainsGTID(testUUID1, "T", 3))
+		xt.Assert(t, !a.ContainsGTID(testUUID2, "t", 3))
+	})
+
+	t.Run("equal", func(t *testing.T) {
+		xt.Assert(t, a.Equal(MustParseGTIDSet(testUUID2+":1-2:3,"+testUUID1+":t:1-5,"+testUUID1+":6-10:1-5:20")))
+		xt.Assert(t, !a.Equal(b))
+		xt.Assert(t, GTIDSet{}.Equal(MustParseGTIDSet("")))
+	})
+
+	t.Run("intervals", func(t *testing.T) {
+		xt.Eq(t, []GTIDInterval{{Start: 1, End: 10}, {Start: 20, End: 20}}, a.Intervals(testUUID1, ""))
+	})
+
+	t.Run("sources", func(t *testing.T) {
+		xt.Eq(t, []string{testUUID1, testUUID2}, a.UUIDs())
+		xt.Eq(t, []string{"", "t"}, a.Tags(testUUID1))
+		xt.Eq(t, []string{""}, a.Tags(testUUID2))
+		xt.Eq(t, 0, len(GTIDSet{}.UUIDs()))
+	})
+
+	t.Run("add", func(t *testing.T) {
+		xt.Eq(t, testUUID1+":1-11:20:t:1-5,"+testUUID2+":1-3", a.Add(testUUID1, "", 11).String())
+		xt.Eq(t, testUUID2+":7", GTIDSet{}.Add(strings.ToUpper(testUUID2), "", 7).String())
+		xt.Eq(t, a.String(), a.Add(testUUID1, "T", 2).String())
+	})
+}
+
+func TestGTIDExecuted(t *testing.T) {
+	executed, err := GTIDExecuted(testDB)
+	xt.OK(t, err)
+
+	purged, err := GTIDPurged(testDB)
+	xt.OK(t, err)
+
+	xt.Assert(t, executed.Contains(purged))
+}
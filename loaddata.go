@@ -0,0 +1,328 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// LoadDataFormat is the format of the data loaded using LOAD DATA.
+type LoadDataFormat string
+
+const (
+	// LoadDataTSV is the default format of LOAD DATA: fields are separated by
+	// tabs, special characters are escaped using a backslash, and NULL is
+	// written as \N.
+	LoadDataTSV LoadDataFormat = "TSV"
+	// LoadDataCSV is the CSV format as described in RFC 4180 with lines ending
+	// with a newline: fields can be enclosed within double quotes, in which
+	// double quotes are doubled. NULL is written as the unquoted word NULL.
+	LoadDataCSV LoadDataFormat = "CSV"
+)
+
+const defaultLoadDataCharacterSet = "binary"
+
+var loadDataCounter atomic.Uint64
+
+// LoadDataOptions configures LoadData and LoadDataRows.
+type LoadDataOptions struct {
+	// Schema is the schema of the table; defaults to the current schema.
+	Schema string
+	// Format is the format of the data; defaults to LoadDataTSV.
+	Format LoadDataFormat
+	// Mode defines how rows conflicting with existing rows are handled; only
+	// BulkModeInsert (default), BulkModeIgnore, and BulkModeReplace are supported.
+	// Note that, because data is loaded using LOCAL, the server handles
+	// conflicts with BulkModeInsert like BulkModeIgnore.
+	Mode BulkMode
+	// CharacterSet is the character set of the data; defaults to binary which
+	// means that data is loaded without conversion.
+	CharacterSet string
+	// IgnoreLines is the number of lines skipped at the start, for example,
+	// 1 when the data has a header.
+	IgnoreLines int
+	// Columns are the names of the columns, or user variables starting
+	// with @, to which the fields are assigned, in order. When empty, the fields
+	// are assigned to all columns of the table.
+	Columns []string
+	// Set holds assignments evaluated for each row, for example,
+	// "created = STR_TO_DATE(@created, '%d/%m/%Y')".
+	Set []string
+	// Location is the time zone to which time.Time values yielded to
+	// LoadDataRows are converted before being encoded. It should match the loc
+	// parameter of the data source name; defaults to UTC.
+	Location *time.Location
+}
+
+// LoadData loads the data read from r into table using LOAD DATA LOCAL INFILE.
+// The data must be formatted as specified by opts.Format.
+// It returns the number of rows affected.
+// The opts can be nil in which case defaults are used.
+//
+// The server must allow loading local data, which is configured using the
+// local_infile global variable.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func LoadData(ctx context.Context, db *sql.DB, table string, r io.Reader, opts *LoadDataOptions) (int64, error) {
+	// the driver closes readers which implement io.Closer
+	return loadData(ctx, db, table, opts, func() io.Reader { return struct{ io.Reader }{r} })
+}
+
+// LoadDataRows loads the rows yielded by rows into table using LOAD DATA LOCAL
+// INFILE. Each row holds a value for each field (see LoadDataOptions.Columns).
+// Values are converted like database/sql does for query arguments, and are
+// encoded as specified by opts.Format taking care of escaping. The signature
+// of rows is that of iter.Seq[[]any].
+// It returns the number of rows affected.
+// The opts can be nil in which case defaults are used.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func LoadDataRows(ctx context.Context, db *sql.DB, table string,
+	rows func(yield func([]any) bool), opts *LoadDataOptions) (int64, error) {
+
+	format := LoadDataTSV
+	loc := time.UTC
+	if opts != nil {
+		if opts.Format != "" {
+			format = opts.Format
+		}
+		if opts.Location != nil {
+			loc = opts.Location
+		}
+	}
+
+	var encodeErr error
+	var pr *io.PipeReader
+	var done chan struct{}
+
+	n, err := loadData(ctx, db, table, opts, func() io.Reader {
+		var pw *io.PipeWriter
+		pr, pw = io.Pipe()
+		done = make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			w := bufio.NewWriter(pw)
+			rows(func(row []any) bool {
+				encodeErr = encodeLoadDataRow(w, format, loc, row)
+				return encodeErr == nil
+			})
+			if encodeErr == nil {
+				encodeErr = w.Flush()
+			}
+			_ = pw.CloseWithError(encodeErr)
+		}()
+
+		return pr
+	})
+
+	if done != nil {
+		// unblocks encoding when the server stopped reading
+		_ = pr.Close()
+		<-done
+	}
+
+	if encodeErr != nil && encodeErr != io.ErrClosedPipe {
+		return n, fmt.Errorf("xmysql: encoding rows: %w", encodeErr)
+	}
+
+	return n, err
+}
+
+func loadData(ctx context.Context, db *sql.DB, table string, opts *LoadDataOptions,
+	handler func() io.Reader) (int64, error) {
+
+	o := LoadDataOptions{}
+	if opts != nil {
+		o = *opts
+	}
+
+	name := fmt.Sprintf("xmysql_load_%d", loadDataCounter.Add(1))
+	mysql.RegisterReaderHandler(name, handler)
+	defer mysql.DeregisterReaderHandler(name)
+
+	q, err := loadDataStatement("Reader::"+name, table, &o)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.ExecContext(ctx, q)
+	if err != nil {
+		return 0, NewErrorQuery(err, q, nil)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, NewError(err)
+	}
+
+	return n, nil
+}
+
+func loadDataStatement(file, table string, o *LoadDataOptions) (string, error) {
+	var q strings.Builder
+
+	q.WriteString("LOAD DATA LOCAL INFILE " + QuoteString(file))
+
+	switch o.Mode {
+	case "", BulkModeInsert:
+	case BulkModeIgnore:
+		q.WriteString(" IGNORE")
+	case BulkModeReplace:
+		q.WriteString(" REPLACE")
+	default:
+		return "", fmt.Errorf("xmysql: unsupported mode %q for loading data", o.Mode)
+	}
+
+	q.WriteString(" INTO TABLE ")
+	if o.Schema != "" {
+		q.WriteString(QuoteIdentifier(o.Schema) + ".")
+	}
+	q.WriteString(QuoteIdentifier(table))
+
+	charset := o.CharacterSet
+	if charset == "" {
+		charset = defaultLoadDataCharacterSet
+	}
+	q.WriteString(" CHARACTER SET " + charset)
+
+	switch o.Format {
+	case "", LoadDataTSV:
+		q.WriteString(` FIELDS TERMINATED BY '\t' ENCLOSED BY '' ESCAPED BY '\\'`)
+	case LoadDataCSV:
+		q.WriteString(` FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY ''`)
+	default:
+		return "", fmt.Errorf("xmysql: unsupported format %q for loading data", o.Format)
+	}
+	q.WriteString(` LINES TERMINATED BY '\n'`)
+
+	if o.IgnoreLines > 0 {
+		q.WriteString(fmt.Sprintf(" IGNORE %d LINES", o.IgnoreLines))
+	}
+
+	if len(o.Columns) > 0 {
+		columns := make([]string, len(o.Columns))
+		for i, c := range o.Columns {
+			if strings.HasPrefix(c, "@") {
+				columns[i] = c
+			} else {
+				columns[i] = QuoteIdentifier(c)
+			}
+		}
+		q.WriteString(" (" + strings.Join(columns, ", ") + ")")
+	}
+
+	if len(o.Set) > 0 {
+		q.WriteString(" SET " + strings.Join(o.Set, ", "))
+	}
+
+	return q.String(), nil
+}
+
+// encodeLoadDataRow writes row to w using the given format. The time.Time
+// values are converted to loc.
+func encodeLoadDataRow(w *bufio.Writer, format LoadDataFormat, loc *time.Location, row []any) error {
+	sep := byte('\t')
+	if format == LoadDataCSV {
+		sep = ','
+	}
+
+	for i, v := range row {
+		if i > 0 {
+			_ = w.WriteByte(sep)
+		}
+
+		text, isNull, err := loadDataText(v, loc)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case isNull && format == LoadDataCSV:
+			_, _ = w.WriteString("NULL")
+		case isNull:
+			_, _ = w.WriteString(`\N`)
+		case format == LoadDataCSV:
+			_ = w.WriteByte('"')
+			_, _ = w.WriteString(strings.ReplaceAll(text, `"`, `""`))
+			_ = w.WriteByte('"')
+		default:
+			writeLoadDataEscaped(w, text)
+		}
+	}
+
+	return w.WriteByte('\n')
+}
+
+// writeLoadDataEscaped writes s escaping the characters which have special
+// meaning when loading data using the default ESCAPED BY '\\'.
+func writeLoadDataEscaped(w *bufio.Writer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			_, _ = w.WriteString(`\\`)
+		case '\t':
+			_, _ = w.WriteString(`\t`)
+		case '\n':
+			_, _ = w.WriteString(`\n`)
+		case '\r':
+			_, _ = w.WriteString(`\r`)
+		case 0:
+			_, _ = w.WriteString(`\0`)
+		case 0x1a:
+			_, _ = w.WriteString(`\Z`)
+		default:
+			_ = w.WriteByte(c)
+		}
+	}
+}
+
+// loadDataText returns v as text as it is loaded by the server. The time.Time
+// values are converted to loc.
+func loadDataText(v any, loc *time.Location) (string, bool, error) {
+	if u, ok := v.(uint64); ok {
+		return strconv.FormatUint(u, 10), false, nil
+	}
+
+	dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return "", false, err
+	}
+
+	switch t := dv.(type) {
+	case nil:
+		return "", true, nil
+	case string:
+		return t, false, nil
+	case []byte:
+		if t == nil {
+			return "", true, nil
+		}
+		return string(t), false, nil
+	case int64:
+		return strconv.FormatInt(t, 10), false, nil
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64), false, nil
+	case bool:
+		if t {
+			return "1", false, nil
+		}
+		return "0", false, nil
+	case time.Time:
+		return t.In(loc).Format("2006-01-02 15:04:05.999999"), false, nil
+	default:
+		return fmt.Sprint(t), false, nil
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestEncodeLoadDataRow(t *testing.T) {
+	row := []any{1, nil, "tab\there", "new\nline", `back\slash`, `"quoted"`, []byte{0, 1},
+		time.Date(2023, 2, 1, 10, 4, 5, 500000000, time.UTC), true}
+
+	t.Run("TSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		xt.OK(t, encodeLoadDataRow(w, LoadDataTSV, time.UTC, row))
+		xt.OK(t, w.Flush())
+
+		xt.Eq(t, "1\t\\N\ttab\\there\tnew\\nline\tback\\\\slash\t\"quoted\"\t\\0\x01\t"+
+			"2023-02-01 10:04:05.5\t1\n", buf.String())
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		xt.OK(t, encodeLoadDataRow(w, LoadDataCSV, time.UTC, row))
+		xt.OK(t, w.Flush())
+
+		xt.Eq(t, "\"1\",NULL,\"tab\there\",\"new\nline\",\"back\\slash\",\"\"\"quoted\"\"\",\"\x00\x01\","+
+			"\"2023-02-01 10:04:05.5\",\"1\"\n", buf.String())
+	})
+
+	t.Run("location", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		xt.OK(t, encodeLoadDataRow(w, LoadDataTSV, time.FixedZone("JST", 9*3600),
+			[]any{time.Date(2023, 2, 1, 10, 4, 5, 0, time.FixedZone("CET", 3600))}))
+		xt.OK(t, w.Flush())
+
+		xt.Eq(t, "2023-02-01 18:04:05\n", buf.String())
+	})
+
+	t.Run("unsupported value", func(t *testing.T) {
+		w := bufio.NewWriter(&bytes.Buffer{})
+		xt.KO(t, encodeLoadDataRow(w, LoadDataTSV, time.UTC, []any{struct{}{}}))
+	})
+}
+
+func TestLoadDataStatement(t *testing.T) {
+	q, err := loadDataStatement("Reader::r", "t1", &LoadDataOptions{
+		Schema:      "s1",
+		Format:      LoadDataCSV,
+		Mode:        BulkModeReplace,
+		IgnoreLines: 1,
+		Columns:     []string{"id", "@created"},
+		Set:         []string{"created = STR_TO_DATE(@created, '%d/%m/%Y')"},
+	})
+	xt.OK(t, err)
+	xt.Eq(t, "LOAD DATA LOCAL INFILE 'Reader::r' REPLACE INTO TABLE `s1`.`t1` CHARACTER SET binary "+
+		`FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n' `+
+		"IGNORE 1 LINES (`id`, @created) SET created = STR_TO_DATE(@created, '%d/%m/%Y')", q)
+
+	_, err = loadDataStatement("Reader::r", "t1", &LoadDataOptions{Mode: BulkModeUpdate})
+	xt.KO(t, err)
+}
+
+func TestLoadData(t *testing.T) {
+	var localInfile string
+	xt.OK(t, testDB.QueryRow("SELECT @@GLOBAL.local_infile").Scan(&localInfile))
+	_, err := testDB.Exec("SET GLOBAL local_infile = 1")
+	xt.OK(t, err)
+	defer func() { _, _ = testDB.Exec("SET GLOBAL local_infile = " + localInfile) }()
+
+	schemaName := "xmysql_test_loaddata"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	_, err = db.Exec("CREATE TABLE items (id INT PRIMARY KEY, name VARCHAR(100), data BLOB, created DATE)")
+	xt.OK(t, err)
+
+	ctx := context.Background()
+
+	t.Run("rows", func(t *testing.T) {
+		for _, format := range []LoadDataFormat{LoadDataTSV, LoadDataCSV} {
+			t.Run(string(format), func(t *testing.T) {
+				_, err := db.Exec("TRUNCATE TABLE items")
+				xt.OK(t, err)
+
+				rows := [][]any{
+					{1, "tab\tand\nnewline", []byte{0, '\\', 'N'}},
+					{2, nil, nil},
+					{3, `"quoted", \N`, []byte("NULL")},
+				}
+
+				n, err := LoadDataRows(ctx, db, "items", func(yield func([]any) bool) {
+					for _, r := range rows {
+						if !yield(r) {
+							return
+						}
+					}
+				}, &LoadDataOptions{Format: format, Columns: []string{"id", "name", "data"}})
+				xt.OK(t, err)
+				xt.Eq(t, int64(3), n)
+
+				for _, r := range rows {
+					var name sql.NullString
+					var data []byte
+					xt.OK(t, db.QueryRow("SELECT name, data FROM items WHERE id = ?", r[0]).Scan(&name, &data))
+					if r[1] == nil {
+						xt.Assert(t, !name.Valid)
+						xt.Assert(t, data == nil)
+					} else {
+						xt.Eq(t, r[1], name.String)
+						xt.Eq(t, r[2], data)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("reader with mapping", func(t *testing.T) {
+		_, err := db.Exec("TRUNCATE TABLE items")
+		xt.OK(t, err)
+
+		data := "id,name,created\n10,\"Alice\",01/02/2023\n11,Bob,NULL\n"
+
+		n, err := LoadData(ctx, db, "items", strings.NewReader(data), &LoadDataOptions{
+			Format:      LoadDataCSV,
+			IgnoreLines: 1,
+			Columns:     []string{"id", "name", "@created"},
+			Set:         []string{"created = STR_TO_DATE(@created, '%d/%m/%Y')"},
+		})
+		xt.OK(t, err)
+		xt.Eq(t, int64(2), n)
+
+		var created sql.NullString
+		xt.OK(t, db.QueryRow("SELECT created FROM items WHERE id = 10").Scan(&created))
+		xt.Eq(t, "2023-02-01", created.String)
+		xt.OK(t, db.QueryRow("SELECT created FROM items WHERE id = 11").Scan(&created))
+		xt.Assert(t, !created.Valid)
+	})
+
+	t.Run("encoding error", func(t *testing.T) {
+		_, err := LoadDataRows(ctx, db, "items", func(yield func([]any) bool) {
+			yield([]any{20, struct{}{}, nil})
+		}, nil)
+		xt.KO(t, err)
+	})
+}
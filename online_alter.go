@@ -0,0 +1,478 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultOnlineAlterThrottleInterval = time.Second
+
+// ErrOnlineAlterAborted is returned by OnlineAlter.Run when it was aborted.
+var ErrOnlineAlterAborted = errors.New("xmysql: online alter aborted")
+
+// OnlineAlterState is the state of an OnlineAlter.
+type OnlineAlterState string
+
+const (
+	OnlineAlterPending   OnlineAlterState = "pending"
+	OnlineAlterPrepare   OnlineAlterState = "prepare"
+	OnlineAlterCopying   OnlineAlterState = "copying"
+	OnlineAlterPaused    OnlineAlterState = "paused"
+	OnlineAlterThrottled OnlineAlterState = "throttled"
+	OnlineAlterSwapping  OnlineAlterState = "swapping"
+	OnlineAlterDone      OnlineAlterState = "done"
+	OnlineAlterAborted   OnlineAlterState = "aborted"
+	OnlineAlterFailed    OnlineAlterState = "failed"
+)
+
+// OnlineAlterOptions configures an OnlineAlter.
+type OnlineAlterOptions struct {
+	// Schema is the schema of the table; defaults to the current schema.
+	Schema string
+	// ChunkSize is the number of rows copied per statement; defaults to 1000.
+	ChunkSize int
+	// Pause is the time waited after each chunk.
+	Pause time.Duration
+	// MaxThreadsRunning throttles copying while the Threads_running global
+	// status variable exceeds it; 0 disables this check.
+	MaxThreadsRunning int
+	// MaxReplicaLag throttles copying while the lag reported by ReplicaLag
+	// exceeds it; 0 disables this check.
+	MaxReplicaLag time.Duration
+	// ReplicaLag returns the current lag of the replicas, for example, the
+	// highest lag of all replicas.
+	ReplicaLag func(ctx context.Context) (time.Duration, error)
+	// ThrottleInterval is the time waited before checking again when copying is
+	// throttled; defaults to 1 second.
+	ThrottleInterval time.Duration
+	// KeepOldTable keeps the original table, renamed, after swapping.
+	KeepOldTable bool
+	// Progress, when not nil, is called after each chunk.
+	Progress func(CopyProgress)
+}
+
+// OnlineAlter alters a table without blocking writes for the duration of the
+// change, in the style of pt-online-schema-change. A shadow table is created
+// and altered, triggers on the original table keep the shadow table in sync
+// while rows are copied in chunks, and, finally, both tables are swapped
+// atomically using RENAME TABLE.
+//
+// The table must have a primary key, and must not be referenced by foreign keys.
+// Columns which are renamed by the alteration lose their data.
+type OnlineAlter struct {
+	db    *sql.DB
+	table string
+	alter string
+	opts  OnlineAlterOptions
+
+	mu      sync.Mutex
+	state   OnlineAlterState
+	resumed chan struct{} // closed when resumed; nil when not paused
+	cancel  context.CancelFunc
+	aborted bool
+}
+
+// NewOnlineAlter returns an OnlineAlter which applies alter, for example
+// "ADD COLUMN note TEXT, ADD INDEX (created)", to table. Nothing is done
+// until Run is called.
+// The opts can be nil in which case defaults are used.
+func NewOnlineAlter(db *sql.DB, table, alter string, opts *OnlineAlterOptions) *OnlineAlter {
+	o := OnlineAlterOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.ThrottleInterval <= 0 {
+		o.ThrottleInterval = defaultOnlineAlterThrottleInterval
+	}
+
+	return &OnlineAlter{
+		db:    db,
+		table: table,
+		alter: alter,
+		opts:  o,
+		state: OnlineAlterPending,
+	}
+}
+
+// State returns the current state.
+func (a *OnlineAlter) State() OnlineAlterState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
+}
+
+func (a *OnlineAlter) setState(s OnlineAlterState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.state = s
+}
+
+// Pause pauses copying rows after the current chunk. Triggers keep the shadow
+// table in sync while paused.
+func (a *OnlineAlter) Pause() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.resumed == nil {
+		a.resumed = make(chan struct{})
+	}
+}
+
+// Resume resumes copying rows after Pause.
+func (a *OnlineAlter) Resume() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.resumed != nil {
+		close(a.resumed)
+		a.resumed = nil
+	}
+}
+
+// Abort stops the alteration, removing the triggers and the shadow table. The
+// original table is left untouched. Run returns ErrOnlineAlterAborted.
+// Aborting has no effect once the tables are being swapped.
+func (a *OnlineAlter) Abort() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.aborted = true
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+// Run executes the alteration and returns when done, failed, or aborted.
+// When anything fails before swapping the tables, the triggers and the
+// shadow table are removed.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func (a *OnlineAlter) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a.mu.Lock()
+	if a.state != OnlineAlterPending {
+		a.mu.Unlock()
+		return fmt.Errorf("xmysql: online alter already run")
+	}
+	a.cancel = cancel
+	aborted := a.aborted
+	a.mu.Unlock()
+
+	if aborted {
+		a.setState(OnlineAlterAborted)
+		return ErrOnlineAlterAborted
+	}
+
+	a.setState(OnlineAlterPrepare)
+
+	r := &onlineAlterRun{OnlineAlter: a}
+	if err := r.run(ctx); err != nil {
+		r.cleanup()
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.aborted {
+			a.state = OnlineAlterAborted
+			return ErrOnlineAlterAborted
+		}
+		a.state = OnlineAlterFailed
+		return err
+	}
+
+	a.setState(OnlineAlterDone)
+	return nil
+}
+
+// onlineAlterRun holds what was created during Run so that it can be cleaned up.
+type onlineAlterRun struct {
+	*OnlineAlter
+
+	shadow   string
+	old      string
+	triggers []string
+	created  bool
+}
+
+func (r *onlineAlterRun) name(table string) string {
+	return qualifiedTableName(r.opts.Schema, table)
+}
+
+func (r *onlineAlterRun) run(ctx context.Context) error {
+	if err := r.check(); err != nil {
+		return err
+	}
+
+	r.shadow = onlineAlterName("_", r.table, "_new")
+	r.old = onlineAlterName("_", r.table, "_old")
+
+	for _, t := range []string{r.shadow, r.old} {
+		exists, err := TableExists(r.db, t, r.opts.Schema)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("xmysql: table %s already exists", t)
+		}
+	}
+
+	err := CloneTable(ctx, r.db, r.table, r.shadow, &CloneOptions{
+		SourceSchema:     r.opts.Schema,
+		TargetSchema:     r.opts.Schema,
+		FromDefinition:   true,
+		RenameConstraint: func(name string) string { return onlineAlterName("_", name, "") },
+	})
+	if err != nil {
+		return err
+	}
+	r.created = true
+
+	q := "ALTER TABLE " + r.name(r.shadow) + " " + r.alter
+	if _, err := r.db.ExecContext(ctx, q); err != nil {
+		return NewErrorQuery(err, q, nil)
+	}
+
+	if err := r.createTriggers(ctx); err != nil {
+		return err
+	}
+
+	r.setState(OnlineAlterCopying)
+
+	_, err = CopyTableData(ctx, r.db, r.table, r.shadow, &CopyOptions{
+		SourceSchema: r.opts.Schema,
+		TargetSchema: r.opts.Schema,
+		Mode:         BulkModeIgnore,
+		ChunkSize:    r.opts.ChunkSize,
+		Pause:        r.opts.Pause,
+		Throttle:     r.throttle,
+		Progress:     r.opts.Progress,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.aborted {
+		r.mu.Unlock()
+		return ErrOnlineAlterAborted
+	}
+	r.state = OnlineAlterSwapping
+	r.mu.Unlock()
+
+	// the triggers move along with the original table and are dropped with it
+	q = "RENAME TABLE " + r.name(r.table) + " TO " + r.name(r.old) + ", " +
+		r.name(r.shadow) + " TO " + r.name(r.table)
+	if _, err := r.db.ExecContext(context.Background(), q); err != nil {
+		return NewErrorQuery(err, q, nil)
+	}
+	r.created = false
+
+	if err := r.dropTriggers(); err != nil {
+		return err
+	}
+
+	if !r.opts.KeepOldTable {
+		q := "DROP TABLE " + r.name(r.old)
+		if _, err := r.db.ExecContext(context.Background(), q); err != nil {
+			return NewErrorQuery(err, q, nil)
+		}
+	}
+
+	return nil
+}
+
+// check verifies whether the table can be altered online.
+func (r *onlineAlterRun) check() error {
+	pk, err := PrimaryKey(r.db, r.table, r.opts.Schema)
+	if err != nil {
+		return err
+	}
+	if len(pk) == 0 {
+		return fmt.Errorf("xmysql: table %s has no primary key", r.table)
+	}
+
+	var schema []string
+	if r.opts.Schema != "" {
+		schema = []string{r.opts.Schema}
+	}
+	keys, err := ForeignKeys(r.db, schema...)
+	if err != nil {
+		return err
+	}
+	for _, fk := range keys {
+		if fk.ReferencedTable == r.table && fk.Table != r.table {
+			return fmt.Errorf("xmysql: table %s is referenced by foreign key %s of table %s",
+				r.table, fk.Name, fk.Table)
+		}
+	}
+
+	return nil
+}
+
+func (r *onlineAlterRun) createTriggers(ctx context.Context) error {
+	pk, err := PrimaryKey(r.db, r.table, r.opts.Schema)
+	if err != nil {
+		return err
+	}
+
+	columns, err := copyColumns(r.db, r.table, r.shadow, &CopyOptions{
+		SourceSchema: r.opts.Schema,
+		TargetSchema: r.opts.Schema,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the primary key is used to find rows in the shadow table
+	copied := map[string]bool{}
+	for _, c := range columns {
+		copied[c] = true
+	}
+
+	var newValues []string
+	for _, c := range columns {
+		newValues = append(newValues, "NEW."+c)
+	}
+
+	var keyList, oldKey, newKey []string
+	for _, c := range pk {
+		q := QuoteIdentifier(c)
+		if !copied[q] {
+			return fmt.Errorf("xmysql: primary key column %s must exist in altered table", c)
+		}
+		keyList = append(keyList, q)
+		oldKey = append(oldKey, "OLD."+q)
+		newKey = append(newKey, "NEW."+q)
+	}
+
+	shadow := r.name(r.shadow)
+	replace := "REPLACE INTO " + shadow + " (" + strings.Join(columns, ", ") + ") " +
+		"VALUES (" + strings.Join(newValues, ", ") + ")"
+	deleteOld := "DELETE IGNORE FROM " + shadow + " WHERE (" + strings.Join(keyList, ", ") + ") = " +
+		"(" + strings.Join(oldKey, ", ") + ")"
+
+	triggers := []struct {
+		suffix string
+		event  string
+		body   string
+	}{
+		{suffix: "_ins", event: "INSERT", body: replace},
+		{suffix: "_upd", event: "UPDATE", body: "BEGIN " + deleteOld + " AND NOT ((" +
+			strings.Join(oldKey, ", ") + ") <=> (" + strings.Join(newKey, ", ") + ")); " + replace + "; END"},
+		{suffix: "_del", event: "DELETE", body: deleteOld},
+	}
+
+	for _, t := range triggers {
+		name := onlineAlterName("_xmysql_osc_", r.table, t.suffix)
+		q := "CREATE TRIGGER " + r.name(name) + " AFTER " + t.event + " ON " + r.name(r.table) +
+			" FOR EACH ROW " + t.body
+		if _, err := r.db.ExecContext(ctx, q); err != nil {
+			return NewErrorQuery(err, q, nil)
+		}
+		r.triggers = append(r.triggers, name)
+	}
+
+	return nil
+}
+
+func (r *onlineAlterRun) dropTriggers() error {
+	for _, name := range r.triggers {
+		q := "DROP TRIGGER IF EXISTS " + r.name(name)
+		if _, err := r.db.ExecContext(context.Background(), q); err != nil {
+			return NewErrorQuery(err, q, nil)
+		}
+	}
+	r.triggers = nil
+	return nil
+}
+
+// cleanup removes the triggers and the shadow table, ignoring errors.
+func (r *onlineAlterRun) cleanup() {
+	_ = r.dropTriggers()
+	if r.created {
+		_, _ = r.db.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+r.name(r.shadow))
+	}
+}
+
+// throttle is called before each chunk is copied. It blocks while paused, or
+// while the server is too busy.
+func (r *onlineAlterRun) throttle(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		resumed := r.resumed
+		if resumed != nil {
+			r.state = OnlineAlterPaused
+		}
+		r.mu.Unlock()
+
+		if resumed != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-resumed:
+				continue
+			}
+		}
+
+		busy, err := r.busy(ctx)
+		if err != nil {
+			return err
+		}
+		if !busy {
+			r.setState(OnlineAlterCopying)
+			return nil
+		}
+
+		r.setState(OnlineAlterThrottled)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.opts.ThrottleInterval):
+		}
+	}
+}
+
+// busy returns whether Threads_running or the replica lag exceed their maximum.
+func (r *onlineAlterRun) busy(ctx context.Context) (bool, error) {
+	if r.opts.MaxThreadsRunning > 0 {
+		v, err := GlobalStatus(r.db, "Threads_running")
+		if err != nil {
+			return false, NewError(err)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return false, fmt.Errorf("xmysql: invalid Threads_running %q", v)
+		}
+		if n > r.opts.MaxThreadsRunning {
+			return true, nil
+		}
+	}
+
+	if r.opts.MaxReplicaLag > 0 && r.opts.ReplicaLag != nil {
+		lag, err := r.opts.ReplicaLag(ctx)
+		if err != nil {
+			return false, err
+		}
+		if lag > r.opts.MaxReplicaLag {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// onlineAlterName returns prefix + name + suffix, shortening name so that
+// the result is a valid identifier of at most 64 characters.
+func onlineAlterName(prefix, name, suffix string) string {
+	const maxLen = 64
+	if n := maxLen - len(prefix) - len(suffix); len(name) > n {
+		name = name[:n]
+	}
+	return prefix + name + suffix
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestOnlineAlterName(t *testing.T) {
+	xt.Eq(t, "_orders_new", onlineAlterName("_", "orders", "_new"))
+
+	have := onlineAlterName("_xmysql_osc_", strings.Repeat("t", 64), "_ins")
+	xt.Eq(t, 64, len(have))
+	xt.Assert(t, strings.HasSuffix(have, "_ins"))
+}
+
+func TestOnlineAlter(t *testing.T) {
+	schemaName := "xmysql_test_online_alter"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	exec := func(t *testing.T, q string, args ...any) {
+		t.Helper()
+		_, err := db.Exec(q, args...)
+		xt.OK(t, err)
+	}
+
+	exec(t, "CREATE TABLE customers (id INT PRIMARY KEY)")
+	exec(t, "INSERT INTO customers VALUES (1)")
+	exec(t, "CREATE TABLE orders (id INT AUTO_INCREMENT PRIMARY KEY, customer_id INT, total INT, "+
+		"CONSTRAINT fk_customer FOREIGN KEY (customer_id) REFERENCES customers (id))")
+	for i := 1; i <= 30; i++ {
+		exec(t, "INSERT INTO orders (customer_id, total) VALUES (1, ?)", i)
+	}
+
+	ctx := context.Background()
+
+	t.Run("alter while writing", func(t *testing.T) {
+		var chunks int
+		a := NewOnlineAlter(db, "orders", "ADD COLUMN note VARCHAR(20) DEFAULT 'none'", &OnlineAlterOptions{
+			ChunkSize: 10,
+			Progress: func(CopyProgress) {
+				chunks++
+				if chunks == 1 {
+					exec(t, "INSERT INTO orders (customer_id, total) VALUES (1, 1000)")
+					exec(t, "UPDATE orders SET total = 2000 WHERE id = 25")
+					exec(t, "UPDATE orders SET id = 100 WHERE id = 26")
+					exec(t, "DELETE FROM orders WHERE id IN (2, 27)")
+				}
+			},
+		})
+		xt.OK(t, a.Run(ctx))
+		xt.Eq(t, OnlineAlterDone, a.State())
+
+		var count, sum int
+		xt.OK(t, db.QueryRow("SELECT COUNT(*), SUM(total) FROM orders WHERE note = 'none'").Scan(&count, &sum))
+		xt.Eq(t, 29, count)
+		xt.Eq(t, 465-2-27-25+1000+2000, sum)
+
+		var total int
+		xt.OK(t, db.QueryRow("SELECT total FROM orders WHERE id = 100").Scan(&total))
+		xt.Eq(t, 26, total)
+
+		for _, table := range []string{"_orders_new", "_orders_old"} {
+			exists, err := TableExists(db, table)
+			xt.OK(t, err)
+			xt.Assert(t, !exists)
+		}
+
+		keys, err := ForeignKeys(db)
+		xt.OK(t, err)
+		xt.Eq(t, 1, len(keys))
+		xt.Eq(t, "_fk_customer", keys[0].Name)
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		var a *OnlineAlter
+		var chunks int
+		paused := make(chan OnlineAlterState, 1)
+		a = NewOnlineAlter(db, "orders", "ADD INDEX idx_total (total)", &OnlineAlterOptions{
+			ChunkSize: 10,
+			Progress: func(CopyProgress) {
+				chunks++
+				if chunks == 1 {
+					a.Pause()
+					go func() {
+						time.Sleep(100 * time.Millisecond)
+						paused <- a.State()
+						a.Resume()
+					}()
+				}
+			},
+		})
+		xt.OK(t, a.Run(ctx))
+		xt.Eq(t, 3, chunks)
+		xt.Eq(t, OnlineAlterPaused, <-paused)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		var a *OnlineAlter
+		a = NewOnlineAlter(db, "orders", "DROP COLUMN note", &OnlineAlterOptions{
+			ChunkSize: 10,
+			Progress:  func(CopyProgress) { a.Abort() },
+		})
+		err := a.Run(ctx)
+		xt.Assert(t, errors.Is(err, ErrOnlineAlterAborted))
+		xt.Eq(t, OnlineAlterAborted, a.State())
+
+		exists, err := TableExists(db, "_orders_new")
+		xt.OK(t, err)
+		xt.Assert(t, !exists)
+
+		var triggers int
+		xt.OK(t, db.QueryRow("SELECT COUNT(*) FROM information_schema.TRIGGERS "+
+			"WHERE TRIGGER_SCHEMA = ?", schemaName).Scan(&triggers))
+		xt.Eq(t, 0, triggers)
+	})
+
+	t.Run("referenced table", func(t *testing.T) {
+		a := NewOnlineAlter(db, "customers", "ADD COLUMN name TEXT", nil)
+		xt.KO(t, a.Run(ctx))
+		xt.Eq(t, OnlineAlterFailed, a.State())
+	})
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var reServerVersion = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(.*)$`)
+
+// ServerFlavor is the distribution of MySQL a server runs.
+type ServerFlavor string
+
+const (
+	FlavorMySQL   ServerFlavor = "MySQL"
+	FlavorPercona ServerFlavor = "Percona"
+	FlavorMariaDB ServerFlavor = "MariaDB"
+)
+
+// ServerVersion is the version of a server.
+type ServerVersion struct {
+	Major int
+	Minor int
+	Patch int
+	// Suffix is what follows the patch number, for example "-26" for Percona
+	// Server or "-MariaDB-log" for MariaDB.
+	Suffix string
+}
+
+// ParseServerVersion parses the version s as reported by the version variable,
+// for example "8.0.34" or "10.11.4-MariaDB-log".
+func ParseServerVersion(s string) (ServerVersion, error) {
+	m := reServerVersion.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return ServerVersion{}, fmt.Errorf("xmysql: invalid server version %q", s)
+	}
+
+	v := ServerVersion{Suffix: m[4]}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+
+	return v, nil
+}
+
+// String returns the version as major.minor.patch, without suffix.
+func (v ServerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast returns whether v is the given version or later.
+func (v ServerVersion) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// ServerInfo holds information about a server and its capabilities.
+type ServerInfo struct {
+	Version ServerVersion
+	Flavor  ServerFlavor
+	// VersionString and VersionComment hold the version and version_comment
+	// variables as reported.
+	VersionString  string
+	VersionComment string
+
+	ServerID   uint32
+	ServerUUID string
+
+	ReadOnly      bool
+	SuperReadOnly bool
+
+	// TimeZone is the global time_zone variable; when it is "SYSTEM",
+	// SystemTimeZone holds the time zone of the host.
+	TimeZone       string
+	SystemTimeZone string
+
+	CharacterSet string
+	Collation    string
+
+	// Plugins holds the names of the active plugins, sorted.
+	Plugins []string
+	// XProtocol is whether the X Plugin is active; XPort is the port it
+	// listens on, or 0 when not known.
+	XProtocol bool
+	XPort     int
+
+	Uptime time.Duration
+	// Latency is the time it took to ping the server.
+	Latency time.Duration
+}
+
+// HasPlugin returns whether the plugin with given name is active.
+func (s *ServerInfo) HasPlugin(name string) bool {
+	for _, p := range s.Plugins {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeVariables are the global variables read by Probe. Those not
+// available, for example super_read_only with MariaDB, are left empty.
+var probeVariables = []string{
+	"version", "version_comment", "server_id", "server_uuid", "read_only", "super_read_only",
+	"time_zone", "system_time_zone", "character_set_server", "collation_server", "mysqlx_port",
+}
+
+// Probe checks whether the server can be reached using db, and returns what
+// it runs and how it is configured. Other functions can use it to, for
+// example, use statements supported by the version of the server.
+//
+// When error is returned, it is of type xmysql.Error.
+func Probe(ctx context.Context, db *sql.DB) (*ServerInfo, error) {
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		return nil, NewError(err)
+	}
+	info := &ServerInfo{Latency: time.Since(start)}
+
+	vars, err := probeGlobalVariables(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	info.VersionString = vars["version"]
+	info.VersionComment = vars["version_comment"]
+	if info.Version, err = ParseServerVersion(info.VersionString); err != nil {
+		return nil, NewError(err)
+	}
+	info.Flavor = serverFlavor(info.VersionString, info.VersionComment)
+
+	serverID, _ := strconv.ParseUint(vars["server_id"], 10, 32)
+	info.ServerID = uint32(serverID)
+	info.ServerUUID = vars["server_uuid"]
+	info.ReadOnly = probeBool(vars["read_only"])
+	info.SuperReadOnly = probeBool(vars["super_read_only"])
+	info.TimeZone = vars["time_zone"]
+	info.SystemTimeZone = vars["system_time_zone"]
+	info.CharacterSet = vars["character_set_server"]
+	info.Collation = vars["collation_server"]
+	info.XPort, _ = strconv.Atoi(vars["mysqlx_port"])
+
+	q := "SELECT PLUGIN_NAME FROM information_schema.PLUGINS WHERE PLUGIN_STATUS = 'ACTIVE' ORDER BY PLUGIN_NAME"
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, NewErrorQuery(err, q, nil)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, NewError(err)
+		}
+		info.Plugins = append(info.Plugins, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+	info.XProtocol = info.HasPlugin("mysqlx")
+	if !info.XProtocol {
+		info.XPort = 0
+	}
+
+	var name string
+	var uptime int64
+	q = "SHOW GLOBAL STATUS LIKE 'Uptime'"
+	if err := db.QueryRowContext(ctx, q).Scan(&name, &uptime); err != nil {
+		return nil, NewErrorQuery(err, q, nil)
+	}
+	info.Uptime = time.Duration(uptime) * time.Second
+
+	return info, nil
+}
+
+// probeGlobalVariables uses SHOW GLOBAL VARIABLES, which, unlike
+// performance_schema.global_variables, is also available with MariaDB and
+// when the Performance Schema is disabled.
+func probeGlobalVariables(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	names := make([]string, len(probeVariables))
+	for i, name := range probeVariables {
+		names[i] = QuoteString(name)
+	}
+	q := "SHOW GLOBAL VARIABLES WHERE Variable_name IN (" + strings.Join(names, ", ") + ")"
+
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, NewErrorQuery(err, q, nil)
+	}
+	defer func() { _ = rows.Close() }()
+
+	vars := map[string]string{}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, NewError(err)
+		}
+		vars[strings.ToLower(name)] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return vars, nil
+}
+
+func serverFlavor(version, comment string) ServerFlavor {
+	switch {
+	case strings.Contains(strings.ToLower(version), "mariadb"):
+		return FlavorMariaDB
+	case strings.Contains(strings.ToLower(comment), "percona"):
+		return FlavorPercona
+	default:
+		return FlavorMySQL
+	}
+}
+
+func probeBool(s string) bool {
+	return strings.EqualFold(s, "ON") || s == "1"
+}
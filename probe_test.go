@@ -0,0 +1,83 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golistic/xgo/xt"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	var cases = map[string]struct {
+		version string
+		comment string
+		exp     ServerVersion
+		flavor  ServerFlavor
+	}{
+		"MySQL": {
+			version: "8.0.34", comment: "MySQL Community Server - GPL",
+			exp: ServerVersion{Major: 8, Minor: 0, Patch: 34}, flavor: FlavorMySQL,
+		},
+		"MySQL with suffix": {
+			version: "5.7.42-log", comment: "MySQL Community Server (GPL)",
+			exp: ServerVersion{Major: 5, Minor: 7, Patch: 42, Suffix: "-log"}, flavor: FlavorMySQL,
+		},
+		"Percona": {
+			version: "8.0.33-25", comment: "Percona Server (GPL), Release 25, Revision 60c9e2c5",
+			exp: ServerVersion{Major: 8, Minor: 0, Patch: 33, Suffix: "-25"}, flavor: FlavorPercona,
+		},
+		"MariaDB": {
+			version: "10.11.4-MariaDB-1:10.11.4+maria~ubu2204", comment: "mariadb.org binary distribution",
+			exp:    ServerVersion{Major: 10, Minor: 11, Patch: 4, Suffix: "-MariaDB-1:10.11.4+maria~ubu2204"},
+			flavor: FlavorMariaDB,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			v, err := ParseServerVersion(c.version)
+			xt.OK(t, err)
+			xt.Eq(t, c.exp, v)
+			xt.Eq(t, c.flavor, serverFlavor(c.version, c.comment))
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseServerVersion("8.0")
+		xt.KO(t, err)
+	})
+
+	t.Run("at least", func(t *testing.T) {
+		v := ServerVersion{Major: 8, Minor: 0, Patch: 22}
+		xt.Assert(t, v.AtLeast(8, 0, 22))
+		xt.Assert(t, v.AtLeast(5, 7, 40))
+		xt.Assert(t, !v.AtLeast(8, 0, 23))
+		xt.Assert(t, !v.AtLeast(8, 2, 0))
+		xt.Eq(t, "8.0.22", v.String())
+	})
+}
+
+func TestProbe(t *testing.T) {
+	info, err := Probe(context.Background(), testDB)
+	xt.OK(t, err)
+
+	var version string
+	xt.OK(t, testDB.QueryRow("SELECT @@version").Scan(&version))
+
+	xt.Eq(t, version, info.VersionString)
+	xt.Assert(t, info.Version.Major >= 5)
+	xt.Assert(t, info.ServerID > 0)
+	xt.Assert(t, info.CharacterSet != "")
+	xt.Assert(t, info.TimeZone != "")
+	xt.Assert(t, info.HasPlugin("InnoDB"))
+	xt.Assert(t, info.Latency > 0)
+	xt.Assert(t, !info.SuperReadOnly || info.ReadOnly)
+	if info.Flavor != FlavorMariaDB {
+		xt.Eq(t, 36, len(info.ServerUUID))
+	}
+	if !info.XProtocol {
+		xt.Eq(t, 0, info.XPort)
+	}
+}
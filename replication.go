@@ -0,0 +1,223 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplicaStatus holds the status of a replication channel as reported by
+// SHOW REPLICA STATUS, or SHOW SLAVE STATUS for older MySQL versions.
+type ReplicaStatus struct {
+	Channel    string
+	SourceHost string
+	SourcePort int
+	SourceUser string
+	SourceUUID string
+
+	// IORunning is "Yes", "No", or "Connecting".
+	IORunning string
+	IOState   string
+	// SQLRunning is "Yes" or "No".
+	SQLRunning string
+	SQLState   string
+
+	// Lag is the number of seconds the replica is behind the source as
+	// reported by the server. It is nil when unknown, for example, when
+	// the replication threads are not running.
+	Lag      *time.Duration
+	SQLDelay time.Duration
+
+	SourceLogFile      string
+	ReadSourceLogPos   uint64
+	RelaySourceLogFile string
+	ExecSourceLogPos   uint64
+	RelayLogFile       string
+	RelayLogPos        uint64
+
+	LastIOErrno       int
+	LastIOError       string
+	LastIOErrorTime   string
+	LastSQLErrno      int
+	LastSQLError      string
+	LastSQLErrorTime  string
+	RetrievedGTIDSet  string
+	ExecutedGTIDSet   string
+	AutoPosition      bool
+	ReplicateDoDB     string
+	ReplicateIgnoreDB string
+}
+
+// Running returns whether both the IO and the SQL threads are running.
+func (s *ReplicaStatus) Running() bool {
+	return s.IORunning == "Yes" && s.SQLRunning == "Yes"
+}
+
+// BinaryLogStatus holds the status of the binary log of a source as reported
+// by SHOW BINARY LOG STATUS, or SHOW MASTER STATUS for older MySQL versions.
+type BinaryLogStatus struct {
+	File            string
+	Position        uint64
+	DoDB            string
+	IgnoreDB        string
+	ExecutedGTIDSet string
+}
+
+// ShowReplicaStatus returns the status of each replication channel of the
+// server, which is empty when the server is not a replica. SHOW REPLICA STATUS
+// is used, falling back to SHOW SLAVE STATUS for MySQL versions before 8.0.22.
+// Column names of both statements are supported.
+//
+// When error is returned, it is of type xmysql.Error.
+func ShowReplicaStatus(ctx context.Context, db *sql.DB) ([]*ReplicaStatus, error) {
+	rows, err := showWithFallback(ctx, db, "SHOW REPLICA STATUS", "SHOW SLAVE STATUS")
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*ReplicaStatus, len(rows))
+	for i, r := range rows {
+		statuses[i] = replicaStatusFromRow(r)
+	}
+
+	return statuses, nil
+}
+
+// ShowBinaryLogStatus returns the status of the binary log. It returns nil when
+// binary logging is disabled. SHOW BINARY LOG STATUS is used, falling back to
+// SHOW MASTER STATUS for MySQL versions before 8.2.
+//
+// When error is returned, it is of type xmysql.Error.
+func ShowBinaryLogStatus(ctx context.Context, db *sql.DB) (*BinaryLogStatus, error) {
+	rows, err := showWithFallback(ctx, db, "SHOW BINARY LOG STATUS", "SHOW MASTER STATUS")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	r := rows[0]
+	return &BinaryLogStatus{
+		File:            r.str("File"),
+		Position:        r.uint("Position"),
+		DoDB:            r.str("Binlog_Do_DB"),
+		IgnoreDB:        r.str("Binlog_Ignore_DB"),
+		ExecutedGTIDSet: r.gtidSet("Executed_Gtid_Set"),
+	}, nil
+}
+
+func replicaStatusFromRow(r statusRow) *ReplicaStatus {
+	s := &ReplicaStatus{
+		Channel:            r.str("Channel_Name"),
+		SourceHost:         r.str("Source_Host"),
+		SourcePort:         int(r.uint("Source_Port")),
+		SourceUser:         r.str("Source_User"),
+		SourceUUID:         r.str("Source_UUID"),
+		IORunning:          r.str("Replica_IO_Running"),
+		IOState:            r.str("Replica_IO_State"),
+		SQLRunning:         r.str("Replica_SQL_Running"),
+		SQLState:           r.str("Replica_SQL_Running_State"),
+		SQLDelay:           time.Duration(r.uint("SQL_Delay")) * time.Second,
+		SourceLogFile:      r.str("Source_Log_File"),
+		ReadSourceLogPos:   r.uint("Read_Source_Log_Pos"),
+		RelaySourceLogFile: r.str("Relay_Source_Log_File"),
+		ExecSourceLogPos:   r.uint("Exec_Source_Log_Pos"),
+		RelayLogFile:       r.str("Relay_Log_File"),
+		RelayLogPos:        r.uint("Relay_Log_Pos"),
+		LastIOErrno:        int(r.uint("Last_IO_Errno")),
+		LastIOError:        r.str("Last_IO_Error"),
+		LastIOErrorTime:    r.str("Last_IO_Error_Timestamp"),
+		LastSQLErrno:       int(r.uint("Last_SQL_Errno")),
+		LastSQLError:       r.str("Last_SQL_Error"),
+		LastSQLErrorTime:   r.str("Last_SQL_Error_Timestamp"),
+		RetrievedGTIDSet:   r.gtidSet("Retrieved_Gtid_Set"),
+		ExecutedGTIDSet:    r.gtidSet("Executed_Gtid_Set"),
+		AutoPosition:       r.str("Auto_Position") == "1",
+		ReplicateDoDB:      r.str("Replicate_Do_DB"),
+		ReplicateIgnoreDB:  r.str("Replicate_Ignore_DB"),
+	}
+
+	if v, ok := r["Seconds_Behind_Source"]; ok && v.Valid {
+		if n, err := strconv.ParseInt(v.String, 10, 64); err == nil {
+			lag := time.Duration(n) * time.Second
+			s.Lag = &lag
+		}
+	}
+
+	return s
+}
+
+// statusRow holds the columns of a row returned by one of the SHOW statements
+// using normalized column names.
+type statusRow map[string]sql.NullString
+
+func (r statusRow) str(name string) string {
+	return r[name].String
+}
+
+func (r statusRow) uint(name string) uint64 {
+	n, _ := strconv.ParseUint(r[name].String, 10, 64)
+	return n
+}
+
+// gtidSet returns the GTID set stored in column name without the newlines
+// the server adds after each comma.
+func (r statusRow) gtidSet(name string) string {
+	return strings.ReplaceAll(r[name].String, "\n", "")
+}
+
+// replicationColumnNames replaces terminology used by MySQL versions before
+// 8.0.22 in column names.
+var replicationColumnNames = strings.NewReplacer(
+	"Master", "Source",
+	"Slave", "Replica",
+)
+
+// showWithFallback executes statement, or fallback when statement is not
+// supported by the server, and returns the rows with normalized column names.
+func showWithFallback(ctx context.Context, db *sql.DB, statement, fallback string) ([]statusRow, error) {
+	rows, err := db.QueryContext(ctx, statement)
+	if err != nil && ErrorIs(NewError(err), ErrParse) {
+		rows, err = db.QueryContext(ctx, fallback)
+	}
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	var result []statusRow
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, NewError(err)
+		}
+
+		r := statusRow{}
+		for i, c := range columns {
+			r[replicationColumnNames.Replace(c)] = values[i]
+		}
+		result = append(result, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xt"
+)
+
+func testStatusRow(columns map[string]string) statusRow {
+	r := statusRow{}
+	for name, v := range columns {
+		r[replicationColumnNames.Replace(name)] = sql.NullString{String: v, Valid: v != "NULL"}
+	}
+	return r
+}
+
+func TestReplicaStatusFromRow(t *testing.T) {
+	t.Run("MySQL 5.7 naming", func(t *testing.T) {
+		s := replicaStatusFromRow(testStatusRow(map[string]string{
+			"Slave_IO_State":        "Waiting for master to send event",
+			"Master_Host":           "source.example.com",
+			"Master_Port":           "3306",
+			"Master_Log_File":       "binlog.000042",
+			"Read_Master_Log_Pos":   "1234",
+			"Slave_IO_Running":      "Yes",
+			"Slave_SQL_Running":     "Yes",
+			"Seconds_Behind_Master": "7",
+			"Last_SQL_Errno":        "0",
+			"Master_UUID":           "3e11fa47-71ca-11e1-9e33-c80aa9429562",
+			"Executed_Gtid_Set":     "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n9e9a2b3c-71ca-11e1-9e33-c80aa9429562:1-3",
+			"Auto_Position":         "1",
+			"Channel_Name":          "",
+		}))
+
+		xt.Eq(t, "source.example.com", s.SourceHost)
+		xt.Eq(t, 3306, s.SourcePort)
+		xt.Eq(t, "binlog.000042", s.SourceLogFile)
+		xt.Eq(t, uint64(1234), s.ReadSourceLogPos)
+		xt.Eq(t, "Waiting for master to send event", s.IOState)
+		xt.Assert(t, s.Running())
+		xt.Eq(t, 7*time.Second, *s.Lag)
+		xt.Eq(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562", s.SourceUUID)
+		xt.Eq(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,9e9a2b3c-71ca-11e1-9e33-c80aa9429562:1-3",
+			s.ExecutedGTIDSet)
+		xt.Assert(t, s.AutoPosition)
+	})
+
+	t.Run("MySQL 8.0 naming", func(t *testing.T) {
+		s := replicaStatusFromRow(testStatusRow(map[string]string{
+			"Source_Host":           "source",
+			"Replica_IO_Running":    "Connecting",
+			"Replica_SQL_Running":   "No",
+			"Seconds_Behind_Source": "NULL",
+			"Last_IO_Errno":         "2003",
+			"Last_IO_Error":         "error connecting to source",
+			"Channel_Name":          "ch1",
+		}))
+
+		xt.Eq(t, "source", s.SourceHost)
+		xt.Eq(t, "ch1", s.Channel)
+		xt.Assert(t, !s.Running())
+		xt.Assert(t, s.Lag == nil)
+		xt.Eq(t, 2003, s.LastIOErrno)
+		xt.Eq(t, "error connecting to source", s.LastIOError)
+	})
+}
+
+func TestShowReplicaStatus(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not a replica", func(t *testing.T) {
+		statuses, err := ShowReplicaStatus(ctx, testDB)
+		xt.OK(t, err)
+		xt.Eq(t, 0, len(statuses))
+	})
+
+	t.Run("binary log", func(t *testing.T) {
+		var logBin int
+		xt.OK(t, testDB.QueryRow("SELECT @@GLOBAL.log_bin").Scan(&logBin))
+
+		status, err := ShowBinaryLogStatus(ctx, testDB)
+		xt.OK(t, err)
+		if logBin == 0 {
+			xt.Assert(t, status == nil)
+			return
+		}
+		xt.Assert(t, status.File != "")
+		xt.Assert(t, status.Position > 0)
+	})
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// CreateRole creates the role with given name using the already open connection db.
+// The host part of the role is "%".
+//
+// When error is returned, it is of type xmysql.Error.
+func CreateRole(db *sql.DB, name string) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("CREATE ROLE " + accountName(name, "", nbe)); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// DropRole drops the role with given name using the already open connection db.
+//
+// When error is returned, it is of type xmysql.Error.
+func DropRole(db *sql.DB, name string) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DROP ROLE " + accountName(name, "", nbe)); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// GrantRoles grants the roles to the account user@host. When host is empty, "%"
+// is used. No-op when no roles are provided.
+//
+// When error is returned, it is of type xmysql.Error.
+func GrantRoles(db *sql.DB, user, host string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	q := "GRANT " + roleList(roles, nbe) + " TO " + accountName(user, host, nbe)
+	if _, err := db.Exec(q); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// RevokeRoles revokes the roles from the account user@host. When host is empty, "%"
+// is used. No-op when no roles are provided.
+//
+// When error is returned, it is of type xmysql.Error.
+func RevokeRoles(db *sql.DB, user, host string, roles ...string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	q := "REVOKE " + roleList(roles, nbe) + " FROM " + accountName(user, host, nbe)
+	if _, err := db.Exec(q); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// SetDefaultRoles sets the roles which are activated when the account user@host
+// connects. When no roles are provided, no roles are activated by default.
+//
+// When error is returned, it is of type xmysql.Error.
+func SetDefaultRoles(db *sql.DB, user, host string, roles ...string) error {
+	nbe, err := noBackslashEscapes(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	list := "NONE"
+	if len(roles) > 0 {
+		list = roleList(roles, nbe)
+	}
+
+	if _, err := db.Exec("SET DEFAULT ROLE " + list + " TO " + accountName(user, host, nbe)); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// SetRoles activates the roles for the session of conn. When no roles are
+// provided, the default roles of the account are activated.
+//
+// When error is returned, it is of type xmysql.Error.
+func SetRoles(ctx context.Context, conn *sql.Conn, roles ...string) error {
+	list := "DEFAULT"
+	if len(roles) > 0 {
+		nbe, err := noBackslashEscapes(ctx, conn)
+		if err != nil {
+			return err
+		}
+		list = roleList(roles, nbe)
+	}
+
+	if _, err := conn.ExecContext(ctx, "SET ROLE "+list); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// roleList returns the quoted names of roles separated by commas. Names are
+// quoted for sessions using NO_BACKSLASH_ESCAPES when noBackslashEscapes is true.
+func roleList(roles []string, noBackslashEscapes bool) string {
+	names := make([]string, len(roles))
+	for i, r := range roles {
+		names[i] = accountName(r, "", noBackslashEscapes)
+	}
+	return strings.Join(names, ", ")
+}
+
+// PrivilegeSet is a collection of privileges, for example, as returned by
+// EffectivePrivileges.
+type PrivilegeSet []Privilege
+
+// EffectivePrivileges returns the privileges of the account user@host combining
+// the privileges granted directly with those of all roles granted to the account,
+// including roles granted to these roles. When host is empty, "%" is used.
+//
+// Note that all granted roles are taken into account, whether they are active
+// or not.
+//
+// When error is returned, it is of type xmysql.Error.
+func EffectivePrivileges(db *sql.DB, user, host string) (PrivilegeSet, error) {
+	var result PrivilegeSet
+	seen := map[string]bool{}
+
+	var collect func(user, host string) error
+	collect = func(user, host string) error {
+		name := AccountName(user, host)
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+
+		grants, err := Grants(db, user, host)
+		if err != nil {
+			return err
+		}
+
+		result = append(result, grants.Privileges...)
+
+		for _, r := range grants.Roles {
+			if err := collect(r.Role, r.Host); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := collect(user, host); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Allows returns whether the privilege with given name is granted on object
+// within schema. When object is empty, the privilege is checked at schema level;
+// when schema is also empty, at global level. Column-level privileges are not
+// taken into account, and partial revokes are.
+func (ps PrivilegeSet) Allows(name, schema, object string) bool {
+	name = strings.ToUpper(name)
+
+	matches := func(p Privilege) bool {
+		return len(p.Columns) == 0 && (p.Name == name || p.Name == PrivilegeAll)
+	}
+
+	var allowed bool
+	for _, p := range ps {
+		if p.Revoked || !matches(p) {
+			continue
+		}
+
+		switch p.Level() {
+		case PrivilegeLevelGlobal:
+			allowed = true
+		case PrivilegeLevelSchema:
+			allowed = schema != "" && matchSchemaPattern(p.Schema, schema)
+		case PrivilegeLevelTable, PrivilegeLevelRoutine:
+			allowed = object != "" && p.Schema == schema && p.Object == object
+		}
+
+		if allowed {
+			break
+		}
+	}
+
+	if !allowed {
+		return false
+	}
+
+	for _, p := range ps {
+		if p.Revoked && matches(p) && schema != "" && matchSchemaPattern(p.Schema, schema) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchSchemaPattern returns whether name matches the schema pattern as used in
+// schema-level grants. The wildcards % and _ can be escaped using a backslash.
+func matchSchemaPattern(pattern, name string) bool {
+	if pattern == "" {
+		return name == ""
+	}
+
+	switch c := pattern[0]; c {
+	case '%':
+		for i := 0; i <= len(name); i++ {
+			if matchSchemaPattern(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return name != "" && matchSchemaPattern(pattern[1:], name[1:])
+	case '\\':
+		if len(pattern) > 1 {
+			pattern = pattern[1:]
+		}
+		fallthrough
+	default:
+		return name != "" && name[0] == pattern[0] && matchSchemaPattern(pattern[1:], name[1:])
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRouterMaxReplicaLag   = 10 * time.Second
+	defaultRouterCheckInterval   = 5 * time.Second
+	defaultRouterGTIDWaitTimeout = time.Second
+)
+
+// Route tells a Router where to send queries.
+type Route int
+
+const (
+	// RoutePrimary sends queries to the primary. This is the default.
+	RoutePrimary Route = iota
+	// RouteReplica sends queries to a replica which is in rotation, or to
+	// the primary when there is none.
+	RouteReplica
+)
+
+type routeContextKey struct{}
+
+type gtidContextKey struct{}
+
+// WithRoute returns a copy of ctx which makes a Router send queries using
+// route.
+func WithRoute(ctx context.Context, route Route) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+// WithGTIDSet returns a copy of ctx which makes a Router send queries only to
+// replicas which executed the transactions in set, for example, obtained
+// using Router.PrimaryGTIDSet after writing. This allows reading your own
+// writes from replicas.
+func WithGTIDSet(ctx context.Context, set GTIDSet) context.Context {
+	return context.WithValue(ctx, gtidContextKey{}, set)
+}
+
+// RouterOptions configures a Router.
+type RouterOptions struct {
+	// MaxReplicaLag is the lag, as reported by SHOW REPLICA STATUS, above which
+	// a replica is taken out of rotation. Defaults to 10 seconds.
+	MaxReplicaLag time.Duration
+	// CheckInterval is the interval at which the replication status of the
+	// replicas is checked. Defaults to 5 seconds.
+	CheckInterval time.Duration
+	// GTIDWaitTimeout is how long to wait for a replica to execute the
+	// transactions set using WithGTIDSet before falling back to the primary.
+	// Defaults to 1 second.
+	GTIDWaitTimeout time.Duration
+}
+
+// RouterReplica holds the state of a replica of a Router.
+type RouterReplica struct {
+	DB *sql.DB
+	// InRotation is whether queries are sent to the replica.
+	InRotation bool
+	// Lag is the largest lag of the replication channels of the replica, and
+	// is nil when unknown.
+	Lag *time.Duration
+	// Err is the reason the replica is out of rotation, if any.
+	Err error
+}
+
+// Router sends queries to a primary, or to one of its replicas. Writes, and
+// queries without hints, are sent to the primary. Queries executed using a
+// context made with WithRoute(ctx, RouteReplica), and read-only transactions,
+// are sent to the replicas in turn.
+//
+// The replication status of the replicas is checked regularly; replicas of
+// which the replication threads are not running, or which lag more than
+// RouterOptions.MaxReplicaLag, are taken out of rotation until they catch up.
+//
+// The Router does not own the *sql.DB values; closing them is left to the
+// caller.
+type Router struct {
+	primary  *sql.DB
+	replicas []*routerReplica
+	opts     RouterOptions
+	next     atomic.Uint64
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type routerReplica struct {
+	db *sql.DB
+
+	mu         sync.RWMutex
+	inRotation bool
+	lag        *time.Duration
+	err        error
+}
+
+// NewRouter returns a Router using primary and replicas. The replication
+// status of the replicas is checked before returning, and then every
+// RouterOptions.CheckInterval until Close is called.
+// The opts can be nil in which case defaults are used.
+func NewRouter(ctx context.Context, primary *sql.DB, replicas []*sql.DB, opts *RouterOptions) *Router {
+	o := RouterOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxReplicaLag <= 0 {
+		o.MaxReplicaLag = defaultRouterMaxReplicaLag
+	}
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = defaultRouterCheckInterval
+	}
+	if o.GTIDWaitTimeout <= 0 {
+		o.GTIDWaitTimeout = defaultRouterGTIDWaitTimeout
+	}
+
+	r := &Router{
+		primary: primary,
+		opts:    o,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, db := range replicas {
+		r.replicas = append(r.replicas, &routerReplica{db: db})
+	}
+
+	r.Check(ctx)
+	go r.monitor()
+
+	return r
+}
+
+// Close stops checking the replicas. It does not close the *sql.DB values.
+func (r *Router) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+}
+
+func (r *Router) monitor() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.opts.CheckInterval)
+			r.Check(ctx)
+			cancel()
+		}
+	}
+}
+
+// Check checks the replication status of all replicas now, and puts them
+// in or out of rotation.
+func (r *Router) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, replica := range r.replicas {
+		wg.Add(1)
+		go func(replica *routerReplica) {
+			defer wg.Done()
+			lag, err := replicaLag(ctx, replica.db, r.opts.MaxReplicaLag)
+			replica.set(err == nil, lag, err)
+		}(replica)
+	}
+	wg.Wait()
+}
+
+// replicaLag returns the largest lag of the replication channels of db. It
+// returns an error when db is not a replica, a channel is not running, or
+// the lag exceeds maxLag.
+func replicaLag(ctx context.Context, db *sql.DB, maxLag time.Duration) (*time.Duration, error) {
+	statuses, err := ShowReplicaStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 {
+		return nil, errors.New("xmysql: server is not a replica")
+	}
+
+	var lag *time.Duration
+	for _, s := range statuses {
+		if !s.Running() {
+			return nil, fmt.Errorf("xmysql: replication channel %q is not running", s.Channel)
+		}
+		if s.Lag == nil {
+			return nil, fmt.Errorf("xmysql: lag of replication channel %q is unknown", s.Channel)
+		}
+		if lag == nil || *s.Lag > *lag {
+			lag = s.Lag
+		}
+	}
+
+	if *lag > maxLag {
+		return lag, fmt.Errorf("xmysql: replica lags %s behind (maximum %s)", *lag, maxLag)
+	}
+
+	return lag, nil
+}
+
+func (rr *routerReplica) set(inRotation bool, lag *time.Duration, err error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.inRotation, rr.lag, rr.err = inRotation, lag, err
+}
+
+func (rr *routerReplica) available() bool {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	return rr.inRotation
+}
+
+// Replicas returns the state of the replicas.
+func (r *Router) Replicas() []RouterReplica {
+	result := make([]RouterReplica, len(r.replicas))
+	for i, replica := range r.replicas {
+		replica.mu.RLock()
+		result[i] = RouterReplica{
+			DB:         replica.db,
+			InRotation: replica.inRotation,
+			Lag:        replica.lag,
+			Err:        replica.err,
+		}
+		replica.mu.RUnlock()
+	}
+	return result
+}
+
+// Primary returns the primary.
+func (r *Router) Primary() *sql.DB {
+	return r.primary
+}
+
+// PrimaryGTIDSet returns the GTIDs of the transactions executed by the primary.
+// Use it with WithGTIDSet to read your own writes from replicas.
+//
+// When error is returned, it is of type xmysql.Error.
+func (r *Router) PrimaryGTIDSet() (GTIDSet, error) {
+	return GTIDExecuted(r.primary)
+}
+
+// DB returns the *sql.DB to which queries using ctx are sent. For RouteReplica,
+// the replicas in rotation are used in turn. When ctx carries a GTID set (see
+// WithGTIDSet), the replica must have executed it within
+// RouterOptions.GTIDWaitTimeout. The primary is returned when no replica is
+// available.
+func (r *Router) DB(ctx context.Context) *sql.DB {
+	if route, _ := ctx.Value(routeContextKey{}).(Route); route == RouteReplica {
+		return r.replica(ctx)
+	}
+	return r.primary
+}
+
+func (r *Router) replica(ctx context.Context) *sql.DB {
+	n := len(r.replicas)
+	start := int(r.next.Add(1) % uint64(max(n, 1)))
+
+	for i := 0; i < n; i++ {
+		replica := r.replicas[(start+i)%n]
+		if !replica.available() {
+			continue
+		}
+
+		if set, ok := ctx.Value(gtidContextKey{}).(GTIDSet); ok && !set.IsEmpty() {
+			if !r.waitGTIDSet(ctx, replica.db, set) {
+				// waiting once is enough; other replicas are likely as far behind
+				break
+			}
+		}
+
+		return replica.db
+	}
+
+	return r.primary
+}
+
+// waitGTIDSet returns whether db executed the transactions in set within
+// RouterOptions.GTIDWaitTimeout.
+func (r *Router) waitGTIDSet(ctx context.Context, db *sql.DB, set GTIDSet) bool {
+	var timedOut int
+	q := "SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?)"
+	if err := db.QueryRowContext(ctx, q, set.String(), r.opts.GTIDWaitTimeout.Seconds()).Scan(&timedOut); err != nil {
+		return false
+	}
+	return timedOut == 0
+}
+
+// ExecContext executes a query which does not return rows using the primary.
+//
+// When error is returned, it is of type xmysql.Error.
+func (r *Router) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	res, err := r.primary.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, NewErrorQuery(err, query, args)
+	}
+	return res, nil
+}
+
+// QueryContext executes a query which returns rows using the *sql.DB returned
+// by DB.
+//
+// When error is returned, it is of type xmysql.Error.
+func (r *Router) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := r.DB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, NewErrorQuery(err, query, args)
+	}
+	return rows, nil
+}
+
+// QueryRowContext executes a query which returns at most one row using the
+// *sql.DB returned by DB.
+func (r *Router) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return r.DB(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx starts a transaction. Read-only transactions are started using a
+// replica, as if ctx was made using WithRoute(ctx, RouteReplica); others using
+// the primary.
+//
+// When error is returned, it is of type xmysql.Error.
+func (r *Router) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	db := r.primary
+	if opts != nil && opts.ReadOnly {
+		db = r.DB(WithRoute(ctx, RouteReplica))
+	}
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	return tx, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xt"
+)
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+
+	replica, err := sql.Open("mysql", testDSN)
+	xt.OK(t, err)
+	defer func() { _ = replica.Close() }()
+
+	router := NewRouter(ctx, testDB, []*sql.DB{replica}, &RouterOptions{
+		GTIDWaitTimeout: 100 * time.Millisecond,
+	})
+	defer router.Close()
+
+	replicaCtx := WithRoute(ctx, RouteReplica)
+
+	t.Run("not a replica", func(t *testing.T) {
+		states := router.Replicas()
+		xt.Eq(t, 1, len(states))
+		xt.Assert(t, !states[0].InRotation)
+		xt.KO(t, states[0].Err)
+
+		xt.Assert(t, router.DB(replicaCtx) == testDB)
+	})
+
+	// pretend the server is a replica in rotation
+	router.replicas[0].set(true, nil, nil)
+
+	t.Run("routes", func(t *testing.T) {
+		xt.Assert(t, router.DB(ctx) == testDB)
+		xt.Assert(t, router.DB(WithRoute(ctx, RoutePrimary)) == testDB)
+		xt.Assert(t, router.DB(replicaCtx) == replica)
+
+		var n int
+		xt.OK(t, router.QueryRowContext(replicaCtx, "SELECT 1").Scan(&n))
+		xt.Eq(t, 1, n)
+
+		tx, err := router.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		xt.OK(t, err)
+		xt.OK(t, tx.Rollback())
+	})
+
+	t.Run("read your writes", func(t *testing.T) {
+		executed, err := router.PrimaryGTIDSet()
+		xt.OK(t, err)
+		xt.Assert(t, router.DB(WithGTIDSet(replicaCtx, executed)) == replica)
+
+		// transactions which were never executed
+		missing := MustParseGTIDSet("0e6a8a82-0f6c-11ee-9f2b-0242ac110002:1-5")
+		xt.Assert(t, router.DB(WithGTIDSet(replicaCtx, missing)) == testDB)
+	})
+
+	t.Run("exec uses primary", func(t *testing.T) {
+		_, err := router.ExecContext(replicaCtx, "DO 1")
+		xt.OK(t, err)
+
+		_, err = router.ExecContext(ctx, "DO SLEEP(")
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, ErrParse))
+	})
+
+	t.Run("check takes replica out of rotation", func(t *testing.T) {
+		router.Check(ctx)
+		xt.Assert(t, !router.Replicas()[0].InRotation)
+		xt.Assert(t, router.DB(replicaCtx) == testDB)
+	})
+}
+
+func TestRouter_noReplicas(t *testing.T) {
+	router := NewRouter(context.Background(), testDB, nil, nil)
+	router.Close()
+	router.Close()
+
+	xt.Assert(t, router.DB(WithRoute(context.Background(), RouteReplica)) == testDB)
+}
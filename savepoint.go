@@ -0,0 +1,64 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+)
+
+var savepointCounter atomic.Uint64
+
+// Savepoint is a named point within a transaction to which it is possible
+// to roll back without rolling back the complete transaction.
+type Savepoint struct {
+	tx   *sql.Tx
+	name string
+}
+
+// NewSavepoint creates a savepoint within transaction tx. The name of the
+// savepoint is generated and unique within the process.
+//
+// When error is returned, it is of type xmysql.Error.
+func NewSavepoint(ctx context.Context, tx *sql.Tx) (*Savepoint, error) {
+	sp := &Savepoint{
+		tx:   tx,
+		name: fmt.Sprintf("xmysql_sp_%d", savepointCounter.Add(1)),
+	}
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT `"+sp.name+"`"); err != nil {
+		return nil, ErrorSavepoint(err)
+	}
+
+	return sp, nil
+}
+
+// Name returns the name of the savepoint.
+func (sp *Savepoint) Name() string {
+	return sp.name
+}
+
+// Rollback rolls back all changes made after the savepoint was created. The
+// savepoint itself is kept and can be rolled back to again.
+//
+// When error is returned, it is of type xmysql.Error.
+func (sp *Savepoint) Rollback(ctx context.Context) error {
+	if _, err := sp.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT `"+sp.name+"`"); err != nil {
+		return ErrorSavepointRollback(err)
+	}
+
+	return nil
+}
+
+// Release removes the savepoint without committing or rolling back any changes.
+//
+// When error is returned, it is of type xmysql.Error.
+func (sp *Savepoint) Release(ctx context.Context) error {
+	if _, err := sp.tx.ExecContext(ctx, "RELEASE SAVEPOINT `"+sp.name+"`"); err != nil {
+		return ErrorSavepointRelease(err)
+	}
+
+	return nil
+}
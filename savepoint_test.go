@@ -0,0 +1,168 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestSavepoint(t *testing.T) {
+	schemaName := "xmysql_test_savepoint"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	_, err = db.Exec("CREATE TABLE t1 (id INT PRIMARY KEY)")
+	xt.OK(t, err)
+
+	count := func(t *testing.T, id int) int {
+		var n int
+		xt.OK(t, db.QueryRow("SELECT COUNT(*) FROM t1 WHERE id = ?", id).Scan(&n))
+		return n
+	}
+
+	ctx := context.Background()
+
+	t.Run("rollback to savepoint", func(t *testing.T) {
+		tx, err := db.BeginTx(ctx, nil)
+		xt.OK(t, err)
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO t1 VALUES (1)")
+		xt.OK(t, err)
+
+		sp, err := NewSavepoint(ctx, tx)
+		xt.OK(t, err)
+		xt.MatchString(t, `^xmysql_sp_\d+$`, sp.Name())
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO t1 VALUES (2)")
+		xt.OK(t, err)
+
+		xt.OK(t, sp.Rollback(ctx))
+		xt.OK(t, sp.Release(ctx))
+		xt.OK(t, tx.Commit())
+
+		xt.Eq(t, 1, count(t, 1))
+		xt.Eq(t, 0, count(t, 2))
+	})
+
+	t.Run("release unknown savepoint", func(t *testing.T) {
+		tx, err := db.BeginTx(ctx, nil)
+		xt.OK(t, err)
+		defer func() { _ = tx.Rollback() }()
+
+		sp, err := NewSavepoint(ctx, tx)
+		xt.OK(t, err)
+		xt.OK(t, sp.Release(ctx))
+
+		err = sp.Release(ctx)
+		xt.KO(t, err)
+		xt.Eq(t, "failed releasing savepoint", err.Error())
+	})
+
+	t.Run("nested WithTx uses savepoint", func(t *testing.T) {
+		err := WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (10)"); err != nil {
+				return err
+			}
+
+			inner, ok := TxFromContext(ctx)
+			xt.Assert(t, ok)
+			xt.Assert(t, inner == tx)
+
+			err := WithTx(ctx, db, nil, func(ctx context.Context, nestedTx *sql.Tx) error {
+				xt.Assert(t, nestedTx == tx, "expected same transaction")
+				if _, err := nestedTx.ExecContext(ctx, "INSERT INTO t1 VALUES (11)"); err != nil {
+					return err
+				}
+				return fmt.Errorf("inner failure")
+			})
+			xt.KO(t, err)
+			xt.Eq(t, "inner failure", err.Error())
+
+			return WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (12)")
+				return err
+			})
+		})
+		xt.OK(t, err)
+
+		xt.Eq(t, 1, count(t, 10))
+		xt.Eq(t, 0, count(t, 11))
+		xt.Eq(t, 1, count(t, 12))
+	})
+
+	t.Run("inner deadlock swallowed by outer", func(t *testing.T) {
+		var calls int
+		err := WithTx(ctx, db, &TxOptions{MinBackoff: time.Millisecond},
+			func(ctx context.Context, tx *sql.Tx) error {
+				calls++
+				if _, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (20)"); err != nil {
+					return err
+				}
+
+				err := WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+					if calls < 2 {
+						return &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+					}
+					_, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (21)")
+					return err
+				})
+				_ = err // swallowed
+
+				// the transaction is not used anymore
+				err = WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error { return nil })
+				if calls < 2 {
+					xt.Assert(t, ErrorIs(err, ErrLockDeadlock))
+				}
+
+				return nil
+			})
+		xt.OK(t, err)
+		xt.Eq(t, 2, calls)
+		xt.Eq(t, 1, count(t, 20))
+		xt.Eq(t, 1, count(t, 21))
+	})
+
+	t.Run("savepoint rollback fails", func(t *testing.T) {
+		err := WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (30)"); err != nil {
+				return err
+			}
+
+			err := WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+				// ends the transaction, removing the savepoint
+				if _, err := tx.ExecContext(ctx, "ROLLBACK"); err != nil {
+					return err
+				}
+				return fmt.Errorf("inner failure")
+			})
+			xt.KO(t, err)
+			xt.MatchString(t, `^inner failure \(rolling back to savepoint: `, err.Error())
+
+			return nil // swallowed
+		})
+		xt.KO(t, err)
+		xt.MatchString(t, `^inner failure \(rolling back to savepoint: `, err.Error())
+		xt.Eq(t, 0, count(t, 30))
+	})
+
+	t.Run("no transaction in context", func(t *testing.T) {
+		_, ok := TxFromContext(ctx)
+		xt.Assert(t, !ok)
+	})
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const defaultScriptDelimiter = ";"
+
+// ScriptOptions configures how LoadScript executes a SQL script.
+type ScriptOptions struct {
+	// ContinueOnError executes the remaining statements when a statement
+	// fails. All errors are returned when the script has finished.
+	ContinueOnError bool
+	// Progress, when not nil, is called after each executed statement.
+	Progress func(ScriptProgress)
+}
+
+// ScriptProgress reports the progress of LoadScript.
+type ScriptProgress struct {
+	// Statements is the number of statements executed so far, including failed ones.
+	Statements int
+	// Failed is the number of statements which failed so far.
+	Failed int
+	// Line is the line at which the last executed statement starts.
+	Line int
+	// BytesRead is the number of bytes read from the script so far.
+	BytesRead int64
+}
+
+// LoadScript reads the SQL script from r and executes its statements one by one
+// using a single connection of db, so that session state such as variables
+// set by the script is kept. The script is streamed and can be, for example,
+// the output of Dump or mysqldump, or a hand-written file. Comments are removed,
+// except for those holding executable code such as /*!40101 ... */. The DELIMITER
+// command, as used by the mysql client, is supported.
+// The opts can be nil in which case defaults are used.
+//
+// By default, execution stops at the first failing statement. When
+// opts.ContinueOnError is set, all statements are executed and errors are
+// returned joined (see errors.Join).
+//
+// When error is returned by the server, it is of type xmysql.Error holding
+// the statement and the line in the script where it starts (see Error.ScriptLine).
+func LoadScript(ctx context.Context, db *sql.DB, r io.Reader, opts *ScriptOptions) error {
+	o := ScriptOptions{}
+	if opts != nil {
+		o = *opts
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return NewError(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	s := newScriptSplitter(r)
+	var progress ScriptProgress
+	var errs []error
+
+	for {
+		stmt, line, err := s.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		progress.Statements++
+		progress.Line = line
+		progress.BytesRead = s.bytesRead
+
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			progress.Failed++
+			e := NewErrorQuery(err, stmt, nil)
+			e.ScriptLine = line
+
+			if !o.ContinueOnError || ctx.Err() != nil {
+				if o.Progress != nil {
+					o.Progress(progress)
+				}
+				return e
+			}
+			errs = append(errs, e)
+		}
+
+		if o.Progress != nil {
+			o.Progress(progress)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// scriptSplitter reads a SQL script and splits it into statements.
+type scriptSplitter struct {
+	r         *bufio.Reader
+	delimiter string
+	lineNo    int
+	bytesRead int64
+	eof       bool
+
+	buf       strings.Builder
+	startLine int
+	quote     byte // quote character when within a quoted string or identifier
+	comment   int  // commentNone, commentDrop or commentKeep
+
+	pending []scriptStatement
+}
+
+type scriptStatement struct {
+	text string
+	line int
+}
+
+const (
+	commentNone = iota
+	commentDrop
+	commentKeep
+)
+
+func newScriptSplitter(r io.Reader) *scriptSplitter {
+	return &scriptSplitter{
+		r:         bufio.NewReader(r),
+		delimiter: defaultScriptDelimiter,
+	}
+}
+
+// next returns the next statement and the line at which it starts. It returns
+// io.EOF when all statements were read.
+func (s *scriptSplitter) next() (string, int, error) {
+	for len(s.pending) == 0 {
+		if s.eof {
+			return "", 0, io.EOF
+		}
+
+		line, err := s.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", 0, err
+		}
+		if err == io.EOF {
+			s.eof = true
+			if line == "" {
+				s.emit()
+				continue
+			}
+		}
+
+		s.lineNo++
+		s.bytesRead += int64(len(line))
+		s.scanLine(line)
+
+		if s.eof {
+			s.emit()
+		}
+	}
+
+	stmt := s.pending[0]
+	s.pending = s.pending[1:]
+	return stmt.text, stmt.line, nil
+}
+
+func (s *scriptSplitter) scanLine(line string) {
+	if s.quote == 0 && s.comment == commentNone && s.startLine == 0 {
+		if d, ok := parseDelimiterCommand(line); ok {
+			s.delimiter = d
+			s.buf.Reset()
+			return
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case s.quote != 0:
+			s.write(c)
+			switch {
+			case c == '\\' && s.quote != '`' && i+1 < len(line):
+				i++
+				s.write(line[i])
+			case c == s.quote && i+1 < len(line) && line[i+1] == s.quote:
+				i++
+				s.write(line[i])
+			case c == s.quote:
+				s.quote = 0
+			}
+
+		case s.comment != commentNone:
+			if strings.HasPrefix(line[i:], "*/") {
+				if s.comment == commentKeep {
+					s.write('*')
+					s.write('/')
+				} else {
+					// avoid tokens around the comment being glued together
+					s.write(' ')
+				}
+				s.comment = commentNone
+				i++
+			} else if s.comment == commentKeep {
+				s.write(c)
+			}
+
+		case strings.HasPrefix(line[i:], s.delimiter):
+			s.emit()
+			i += len(s.delimiter) - 1
+
+		case c == '#' || isDashComment(line[i:]):
+			if strings.HasSuffix(line, "\n") {
+				s.write('\n')
+			}
+			return
+
+		case strings.HasPrefix(line[i:], "/*"):
+			// executable comments and optimizer hints are kept
+			if i+2 < len(line) && (line[i+2] == '!' || line[i+2] == '+') {
+				s.comment = commentKeep
+				s.write('/')
+				s.write('*')
+			} else {
+				s.comment = commentDrop
+			}
+			i++
+
+		case c == '\'' || c == '"' || c == '`':
+			s.quote = c
+			s.write(c)
+
+		default:
+			s.write(c)
+		}
+	}
+}
+
+// write appends c to the current statement, registering the line at which the
+// statement starts when c is its first non-whitespace character.
+func (s *scriptSplitter) write(c byte) {
+	if s.startLine == 0 {
+		if unicode.IsSpace(rune(c)) {
+			return
+		}
+		s.startLine = s.lineNo
+	}
+	s.buf.WriteByte(c)
+}
+
+// emit queues the current statement, if any, and starts a new one.
+func (s *scriptSplitter) emit() {
+	if stmt := strings.TrimSpace(s.buf.String()); stmt != "" {
+		s.pending = append(s.pending, scriptStatement{text: stmt, line: s.startLine})
+	}
+	s.buf.Reset()
+	s.startLine = 0
+}
+
+// isDashComment returns whether text starts with a comment using "--", which
+// must be followed by whitespace or the end of the line.
+func isDashComment(text string) bool {
+	if !strings.HasPrefix(text, "--") {
+		return false
+	}
+	return len(text) == 2 || unicode.IsSpace(rune(text[2]))
+}
+
+// parseDelimiterCommand returns the new delimiter when line holds the
+// DELIMITER command of the mysql client.
+func parseDelimiterCommand(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "DELIMITER") {
+		return "", false
+	}
+	return fields[1], true
+}
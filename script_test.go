@@ -0,0 +1,170 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func splitScript(t *testing.T, script string) ([]string, []int) {
+	t.Helper()
+
+	s := newScriptSplitter(strings.NewReader(script))
+
+	var statements []string
+	var lines []int
+	for {
+		stmt, line, err := s.next()
+		if err == io.EOF {
+			break
+		}
+		xt.OK(t, err)
+		statements = append(statements, stmt)
+		lines = append(lines, line)
+	}
+
+	return statements, lines
+}
+
+func TestScriptSplitter(t *testing.T) {
+	t.Run("statements and line numbers", func(t *testing.T) {
+		statements, lines := splitScript(t, "SELECT 1;\n\n-- comment\nSELECT\n  2; SELECT 3\n")
+		xt.Eq(t, []string{"SELECT 1", "SELECT\n  2", "SELECT 3"}, statements)
+		xt.Eq(t, []int{1, 4, 5}, lines)
+	})
+
+	t.Run("quotes", func(t *testing.T) {
+		statements, _ := splitScript(t, "INSERT INTO t VALUES ('a;b', \"c\\\";\", 'it''s;');\n"+
+			"SELECT `a;``b` FROM t;")
+		xt.Eq(t, []string{
+			"INSERT INTO t VALUES ('a;b', \"c\\\";\", 'it''s;')",
+			"SELECT `a;``b` FROM t",
+		}, statements)
+	})
+
+	t.Run("quotes spanning lines", func(t *testing.T) {
+		statements, lines := splitScript(t, "SELECT 1;\nINSERT INTO t VALUES ('a\n;b');\nSELECT 2;")
+		xt.Eq(t, []string{"SELECT 1", "INSERT INTO t VALUES ('a\n;b')", "SELECT 2"}, statements)
+		xt.Eq(t, []int{1, 2, 4}, lines)
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		statements, _ := splitScript(t, "# hash\nSELECT 1 /* a; */ + 1; -- trailing;\n"+
+			"/* multi\nline; */\n/*!40101 SET NAMES utf8mb4 */;\nSELECT /*+ MAX_EXECUTION_TIME(10) */ 1--1;")
+		xt.Eq(t, []string{
+			"SELECT 1   + 1",
+			"/*!40101 SET NAMES utf8mb4 */",
+			"SELECT /*+ MAX_EXECUTION_TIME(10) */ 1--1",
+		}, statements)
+	})
+
+	t.Run("delimiter", func(t *testing.T) {
+		statements, lines := splitScript(t, "DELIMITER ;;\n"+
+			"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND ;;\n"+
+			"delimiter ;\nCALL p();")
+		xt.Eq(t, []string{"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND", "CALL p()"}, statements)
+		xt.Eq(t, []int{2, 8}, lines)
+	})
+}
+
+func TestLoadScript(t *testing.T) {
+	schemaName := "xmysql_test_script"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+
+	t.Run("session state and routines", func(t *testing.T) {
+		script := "SET @offset = 10;\n" +
+			"CREATE TABLE t1 (id INT PRIMARY KEY);\n" +
+			"INSERT INTO t1 VALUES (@offset + 1), (@offset + 2);\n" +
+			"DELIMITER //\n" +
+			"CREATE FUNCTION f1() RETURNS INT DETERMINISTIC\nBEGIN\n  RETURN (SELECT COUNT(*) FROM t1);\nEND //\n" +
+			"DELIMITER ;\n"
+
+		var progress []ScriptProgress
+		xt.OK(t, LoadScript(ctx, db, strings.NewReader(script), &ScriptOptions{
+			Progress: func(p ScriptProgress) { progress = append(progress, p) },
+		}))
+
+		var count int
+		xt.OK(t, db.QueryRow("SELECT f1()").Scan(&count))
+		xt.Eq(t, 2, count)
+
+		xt.Eq(t, 4, len(progress))
+		xt.Eq(t, 5, progress[3].Line)
+		xt.Eq(t, int64(len(script)), progress[3].BytesRead)
+	})
+
+	t.Run("stop on error", func(t *testing.T) {
+		script := "CREATE TABLE t2 (id INT);\n\nINSERT INTO t2_nope VALUES (1);\nCREATE TABLE t3 (id INT);\n"
+
+		err := LoadScript(ctx, db, strings.NewReader(script), nil)
+		xt.KO(t, err)
+
+		var e Error
+		xt.Assert(t, errors.As(err, &e))
+		xt.Eq(t, 3, e.ScriptLine)
+		xt.Eq(t, "INSERT INTO t2_nope VALUES (1)", e.Query)
+
+		ok, err := TableExists(db, "t3")
+		xt.OK(t, err)
+		xt.Assert(t, !ok)
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		script := "INSERT INTO t4_nope VALUES (1);\nCREATE TABLE t4 (id INT);\nINSERT INTO t5_nope VALUES (1);\n"
+
+		var last ScriptProgress
+		err := LoadScript(ctx, db, strings.NewReader(script), &ScriptOptions{
+			ContinueOnError: true,
+			Progress:        func(p ScriptProgress) { last = p },
+		})
+		xt.KO(t, err)
+		xt.Eq(t, ScriptProgress{Statements: 3, Failed: 2, Line: 3, BytesRead: int64(len(script))}, last)
+
+		ok, err := TableExists(db, "t4")
+		xt.OK(t, err)
+		xt.Assert(t, ok)
+	})
+
+	t.Run("load dump", func(t *testing.T) {
+		var buf bytes.Buffer
+		xt.OK(t, Dump(ctx, db, schemaName, &buf, nil))
+
+		target := "xmysql_test_script_load"
+		_ = DropSchema(testDB, target)
+		xt.OK(t, CreateSchema(testDB, target))
+		defer func() { _ = DropSchema(testDB, target) }()
+
+		dsn, err := xsql.ReplaceDSNDatabase(testDSN, target)
+		xt.OK(t, err)
+
+		loadDB, err := sql.Open("mysql", dsn)
+		xt.OK(t, err)
+		defer func() { _ = loadDB.Close() }()
+
+		xt.OK(t, LoadScript(ctx, loadDB, &buf, nil))
+
+		var count int
+		xt.OK(t, loadDB.QueryRow("SELECT f1()").Scan(&count))
+		xt.Eq(t, 2, count)
+	})
+}
@@ -3,6 +3,8 @@
 package xmysql
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"sort"
 	"strings"
@@ -99,3 +101,82 @@ func MustSQLw(statement string, keyValuePairs ...string) string {
 	}
 	return s
 }
+
+// QuoteIdentifier quotes name, for example a schema, table or column name, using
+// backticks. Backticks within name are escaped.
+func QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// QuoteString returns s as a single-quoted MySQL string literal. Single quotes
+// are doubled, and backslashes are escaped, as well as the NUL character and
+// newlines. When the NO_BACKSLASH_ESCAPES SQL mode is set, the literal cannot
+// be broken out of either, but backslashes are doubled and the other escape
+// sequences are taken as-is; use QuoteStringNoBackslashEscapes instead.
+func QuoteString(s string) string {
+	return quoteString(s, false)
+}
+
+// QuoteStringNoBackslashEscapes returns s as a single-quoted MySQL string
+// literal for sessions using the NO_BACKSLASH_ESCAPES SQL mode. Only single
+// quotes are escaped, by doubling them.
+func QuoteStringNoBackslashEscapes(s string) string {
+	return quoteString(s, true)
+}
+
+func quoteString(s string, noBackslashEscapes bool) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			b.WriteString("''")
+			continue
+		}
+		if noBackslashEscapes {
+			b.WriteByte(c)
+			continue
+		}
+
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case 0:
+			b.WriteString(`\0`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0x1a:
+			b.WriteString(`\Z`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// rowQuerier is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// noBackslashEscapes returns whether sessions of db use the NO_BACKSLASH_ESCAPES
+// SQL mode, in which case string literals must be quoted using
+// QuoteStringNoBackslashEscapes. The db can also be a connection or transaction.
+func noBackslashEscapes(ctx context.Context, db rowQuerier) (bool, error) {
+	var mode string
+	q := "SELECT @@SESSION.sql_mode"
+	if err := db.QueryRowContext(ctx, q).Scan(&mode); err != nil {
+		return false, NewErrorQuery(err, q, nil)
+	}
+
+	for _, m := range strings.Split(mode, ",") {
+		if strings.EqualFold(m, "NO_BACKSLASH_ESCAPES") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
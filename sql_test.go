@@ -3,8 +3,11 @@
 package xmysql
 
 import (
+	"context"
+	"database/sql"
 	"testing"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/golistic/xgo/xt"
 )
 
@@ -84,3 +87,76 @@ func TestSQLw(t *testing.T) {
 		xt.Eq(t, "xmysql: placeholder missing for column", err.Error())
 	})
 }
+
+func TestQuoteIdentifier(t *testing.T) {
+	xt.Eq(t, "`t1`", QuoteIdentifier("t1"))
+	xt.Eq(t, "`with``backtick`", QuoteIdentifier("with`backtick"))
+}
+
+func TestQuoteString(t *testing.T) {
+	var cases = map[string]struct {
+		exp    string
+		expNBE string
+	}{
+		"plain":            {exp: `'plain'`, expNBE: `'plain'`},
+		"it's":             {exp: `'it''s'`, expNBE: `'it''s'`},
+		`back\slash`:       {exp: `'back\\slash'`, expNBE: `'back\slash'`},
+		`x\' OR 1=1 -- `:   {exp: `'x\\'' OR 1=1 -- '`, expNBE: `'x\'' OR 1=1 -- '`},
+		"new\nline":        {exp: `'new\nline'`, expNBE: "'new\nline'"},
+		"nul\x00character": {exp: `'nul\0character'`, expNBE: "'nul\x00character'"},
+	}
+
+	for s, c := range cases {
+		t.Run(s, func(t *testing.T) {
+			xt.Eq(t, c.exp, QuoteString(s))
+			xt.Eq(t, c.expNBE, QuoteStringNoBackslashEscapes(s))
+		})
+	}
+}
+
+func TestNoBackslashEscapes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("default", func(t *testing.T) {
+		nbe, err := noBackslashEscapes(ctx, testDB)
+		xt.OK(t, err)
+		xt.Assert(t, !nbe)
+
+		var have string
+		xt.OK(t, testDB.QueryRow("SELECT "+QuoteString(`x\' OR 1=1 -- `)).Scan(&have))
+		xt.Eq(t, `x\' OR 1=1 -- `, have)
+	})
+
+	t.Run("NO_BACKSLASH_ESCAPES", func(t *testing.T) {
+		db := testDBNoBackslashEscapes(t)
+
+		nbe, err := noBackslashEscapes(ctx, db)
+		xt.OK(t, err)
+		xt.Assert(t, nbe)
+
+		for _, s := range []string{`x\' OR 1=1 -- `, `back\slash`, "it's"} {
+			var have string
+			xt.OK(t, db.QueryRow("SELECT "+QuoteStringNoBackslashEscapes(s)).Scan(&have))
+			xt.Eq(t, s, have)
+		}
+	})
+}
+
+// testDBNoBackslashEscapes returns a database of which the sessions use the
+// NO_BACKSLASH_ESCAPES SQL mode. It is closed when the test finishes.
+func testDBNoBackslashEscapes(t *testing.T) *sql.DB {
+	t.Helper()
+
+	cfg, err := mysql.ParseDSN(testDSN)
+	xt.OK(t, err)
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	cfg.Params["sql_mode"] = "'NO_BACKSLASH_ESCAPES'"
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	xt.OK(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
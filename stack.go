@@ -0,0 +1,92 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+const maxStackDepth = 32
+
+// pkgFuncPrefix is the prefix of the fully qualified function names of this
+// package, for example "github.com/golistic/xmysql.". It is determined at
+// runtime so that it is correct when the module is vendored or renamed.
+var pkgFuncPrefix = reflect.TypeOf(Error{}).PkgPath() + "."
+
+// callStack holds the frames of the call stack captured when an Error was
+// created. The leading frames of this package are not included.
+type callStack []runtime.Frame
+
+// captureStack records the call stack of the caller, skipping all leading
+// frames which belong to this package (tests excluded).
+func captureStack() *callStack {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+
+	var st callStack
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if len(st) > 0 || !isPackageFrame(frame) {
+			st = append(st, frame)
+		}
+		if !more {
+			break
+		}
+	}
+
+	return &st
+}
+
+// Frames returns the frames of the call stack.
+func (st *callStack) Frames() []runtime.Frame {
+	if st == nil {
+		return nil
+	}
+	return *st
+}
+
+func (st *callStack) format(w io.Writer) {
+	for _, frame := range st.Frames() {
+		_, _ = fmt.Fprintf(w, "\n%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+	}
+}
+
+func isPackageFrame(frame runtime.Frame) bool {
+	return strings.HasPrefix(frame.Function, pkgFuncPrefix) &&
+		!strings.HasSuffix(frame.File, "_test.go")
+}
+
+// frameFilename returns the filename of frame prefixed with the import path
+// of the package of the function. For example, the function
+// "github.com/acme/app/store.(*Repo).Save" defined in "/src/store/repo.go"
+// results in "github.com/acme/app/store/repo.go". This does not depend on
+// where the source is located (GOPATH, module cache, or vendor directory).
+//
+// The runtime escapes dots in the last element of the import path, for
+// example, "gopkg.in/yaml%2ev3.(*Decoder).Decode", so the first dot after
+// the last slash ends the import path, which is then unescaped.
+func frameFilename(frame runtime.Frame) string {
+	fn := frame.Function
+	slash := strings.LastIndex(fn, "/")
+	dot := strings.Index(fn[slash+1:], ".")
+	if fn == "" || dot < 0 {
+		return reGoPkg.ReplaceAllString(frame.File, "")
+	}
+
+	pkg := fn[:slash+1+dot]
+	if pkg == "main" {
+		return reGoPkg.ReplaceAllString(frame.File, "")
+	}
+	if p, err := url.PathUnescape(pkg); err == nil {
+		pkg = p
+	}
+
+	return path.Join(pkg, path.Base(frame.File))
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/golistic/xgo/xt"
+)
+
+func TestFrameFilename(t *testing.T) {
+	var cases = map[string]struct {
+		frame runtime.Frame
+		exp   string
+	}{
+		"method": {
+			frame: runtime.Frame{Function: "github.com/acme/app/store.(*Repo).Save", File: "/src/store/repo.go"},
+			exp:   "github.com/acme/app/store/repo.go",
+		},
+		"closure": {
+			frame: runtime.Frame{Function: "github.com/acme/app.Run.func1", File: "/home/go/src/github.com/acme/app/run.go"},
+			exp:   "github.com/acme/app/run.go",
+		},
+		"dotted last path element": {
+			frame: runtime.Frame{
+				Function: "gopkg.in/yaml%2ev3.(*Decoder).Decode",
+				File:     "/home/go/pkg/mod/gopkg.in/yaml.v3@v3.0.1/yaml.go",
+			},
+			exp: "gopkg.in/yaml.v3/yaml.go",
+		},
+		"main": {
+			frame: runtime.Frame{Function: "main.main", File: "/home/go/src/acme/main.go"},
+			exp:   "acme/main.go",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			xt.Eq(t, c.exp, frameFilename(c.frame))
+		})
+	}
+
+	t.Run("runtime frame", func(t *testing.T) {
+		pc, _, _, _ := runtime.Caller(0)
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		xt.Eq(t, "github.com/golistic/xmysql/stack_test.go", frameFilename(frame))
+	})
+}
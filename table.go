@@ -7,14 +7,21 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
-// TableExists returns whether table with given name exists in schema db.
-func TableExists(db *sql.DB, name string) (bool, error) {
-	schema, err := CurrentSchema(db)
-	if err != nil {
-		return false, err
+// TableExists returns whether table with given name exists. If schema is not
+// provided, current schema will be used.
+func TableExists(db *sql.DB, name string, schema ...string) (bool, error) {
+	var s string
+	if len(schema) > 0 && schema[0] != "" {
+		s = schema[0]
+	} else {
+		var err error
+		if s, err = CurrentSchema(db); err != nil {
+			return false, err
+		}
 	}
 
 	q := "SELECT 1 FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
@@ -25,7 +32,7 @@ func TableExists(db *sql.DB, name string) (bool, error) {
 	defer cancel()
 
 	var n int
-	if err := db.QueryRowContext(ctx, q, schema, name).Scan(&n); err != nil {
+	if err := db.QueryRowContext(ctx, q, s, name).Scan(&n); err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
 		}
@@ -105,3 +112,169 @@ func SetTableCommentJSON(db *sql.DB, table string, comment any, schema ...string
 
 	return nil
 }
+
+// Column describes a column of a table as stored in information_schema.COLUMNS.
+type Column struct {
+	Name     string
+	Position int
+	// DataType is the type without attributes, for example "varchar".
+	DataType string
+	// ColumnType is the full type, for example "varchar(20)" or "int unsigned".
+	ColumnType string
+	Nullable   bool
+	Default    *string
+	// Key is "PRI", "UNI", or "MUL" when the column is (part of) an index.
+	Key string
+	// Extra holds additional information such as "auto_increment", or
+	// "VIRTUAL GENERATED" for generated columns.
+	Extra   string
+	Comment string
+}
+
+// IsGenerated returns whether values of the column are generated by the server
+// and can therefore not be inserted.
+func (c *Column) IsGenerated() bool {
+	return strings.Contains(strings.ToUpper(c.Extra), "GENERATED")
+}
+
+// TableColumns retrieves the columns of a table ordered by their position. If schema
+// is not provided, current schema will be used.
+//
+// When error is returned, it is of type xmysql.Error.
+func TableColumns(db *sql.DB, table string, schema ...string) ([]*Column, error) {
+	q := "SELECT COLUMN_NAME, ORDINAL_POSITION, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, " +
+		"COLUMN_KEY, EXTRA, COLUMN_COMMENT FROM information_schema.COLUMNS WHERE TABLE_NAME = ? AND TABLE_SCHEMA = "
+	args := []any{table}
+	if len(schema) > 0 && schema[0] != "" {
+		q += "?"
+		args = append(args, schema[0])
+	} else {
+		q += "SCHEMA()"
+	}
+	q += " ORDER BY ORDINAL_POSITION"
+
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var columns []*Column
+	for rows.Next() {
+		c := &Column{}
+		var nullable string
+		if err := rows.Scan(&c.Name, &c.Position, &c.DataType, &c.ColumnType, &nullable, &c.Default,
+			&c.Key, &c.Extra, &c.Comment); err != nil {
+			return nil, NewError(err)
+		}
+		c.Nullable = nullable == "YES"
+		columns = append(columns, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return columns, nil
+}
+
+// ForeignKey describes a foreign key constraint.
+type ForeignKey struct {
+	Name              string
+	Table             string
+	Columns           []string
+	ReferencedSchema  string
+	ReferencedTable   string
+	ReferencedColumns []string
+}
+
+// ForeignKeys retrieves the foreign keys defined on the tables of schema. If schema
+// is not provided, current schema will be used.
+//
+// When error is returned, it is of type xmysql.Error.
+func ForeignKeys(db *sql.DB, schema ...string) ([]*ForeignKey, error) {
+	q := "SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, " +
+		"REFERENCED_COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE " +
+		"WHERE REFERENCED_TABLE_NAME IS NOT NULL AND TABLE_SCHEMA = "
+	var args []any
+	if len(schema) > 0 && schema[0] != "" {
+		q += "?"
+		args = append(args, schema[0])
+	} else {
+		q += "SCHEMA()"
+	}
+	q += " ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION"
+
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var keys []*ForeignKey
+	var fk *ForeignKey
+	for rows.Next() {
+		var name, table, column, refSchema, refTable, refColumn string
+		if err := rows.Scan(&name, &table, &column, &refSchema, &refTable, &refColumn); err != nil {
+			return nil, NewError(err)
+		}
+
+		if fk == nil || fk.Name != name || fk.Table != table {
+			fk = &ForeignKey{
+				Name:             name,
+				Table:            table,
+				ReferencedSchema: refSchema,
+				ReferencedTable:  refTable,
+			}
+			keys = append(keys, fk)
+		}
+
+		fk.Columns = append(fk.Columns, column)
+		fk.ReferencedColumns = append(fk.ReferencedColumns, refColumn)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return keys, nil
+}
+
+// PrimaryKey retrieves the columns of the primary key of a table, in the order
+// they are defined in the key. If the table has no primary key, nil is returned.
+// If schema is not provided, current schema will be used.
+//
+// When error is returned, it is of type xmysql.Error.
+func PrimaryKey(db *sql.DB, table string, schema ...string) ([]string, error) {
+	q := "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE " +
+		"WHERE CONSTRAINT_NAME = 'PRIMARY' AND TABLE_NAME = ? AND TABLE_SCHEMA = "
+	args := []any{table}
+	if len(schema) > 0 && schema[0] != "" {
+		q += "?"
+		args = append(args, schema[0])
+	} else {
+		q += "SCHEMA()"
+	}
+	q += " ORDER BY ORDINAL_POSITION"
+
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, NewError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, NewError(err)
+		}
+		columns = append(columns, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, NewError(err)
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,368 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCopyChunkSize = 1000
+
+var (
+	reCreateTableIndex      = regexp.MustCompile("^(\\s+(?:UNIQUE |FULLTEXT |SPATIAL )?KEY )`((?:[^`]|``)+)`")
+	reCreateTableConstraint = regexp.MustCompile("^(\\s+CONSTRAINT )`((?:[^`]|``)+)`")
+	reCreateTableAutoInc    = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+)
+
+// CloneOptions configures CloneTable.
+type CloneOptions struct {
+	// SourceSchema is the schema of the source table; defaults to the current schema.
+	SourceSchema string
+	// TargetSchema is the schema of the new table; defaults to the current schema.
+	TargetSchema string
+	// FromDefinition creates the table using the definition of the source table
+	// as reported by SHOW CREATE TABLE instead of using CREATE TABLE ... LIKE.
+	// Unlike the latter, foreign keys are cloned, and indexes and constraints
+	// can be renamed.
+	FromDefinition bool
+	// RenameIndex returns the new name of an index when using FromDefinition.
+	// By default, indexes keep their name.
+	RenameIndex func(name string) string
+	// RenameConstraint returns the new name of a foreign key or check constraint
+	// when using FromDefinition. Since these names must be unique within a schema,
+	// by default, the name of the source table within the name is replaced by the
+	// name of the new table, or, when not found, the name of the new table
+	// is used as prefix.
+	RenameConstraint func(name string) string
+}
+
+// CloneTable creates table target having the same structure as table source.
+// The opts can be nil in which case defaults are used.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func CloneTable(ctx context.Context, db *sql.DB, source, target string, opts *CloneOptions) error {
+	o := CloneOptions{}
+	if opts != nil {
+		o = *opts
+	}
+
+	exists, err := TableExists(db, target, o.TargetSchema)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("xmysql: table %s already exists", target)
+	}
+
+	sourceName := qualifiedTableName(o.SourceSchema, source)
+	targetName := qualifiedTableName(o.TargetSchema, target)
+
+	if !o.FromDefinition {
+		q := "CREATE TABLE " + targetName + " LIKE " + sourceName
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return NewErrorQuery(err, q, nil)
+		}
+		return nil
+	}
+
+	var name, create string
+	if err := db.QueryRowContext(ctx, "SHOW CREATE TABLE "+sourceName).Scan(&name, &create); err != nil {
+		return NewError(err)
+	}
+
+	if o.RenameIndex == nil {
+		o.RenameIndex = func(name string) string { return name }
+	}
+	if o.RenameConstraint == nil {
+		o.RenameConstraint = func(name string) string {
+			if strings.Contains(name, source) {
+				return strings.Replace(name, source, target, 1)
+			}
+			return target + "_" + name
+		}
+	}
+
+	q := cloneDefinition(create, targetName, o.RenameIndex, o.RenameConstraint)
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return NewErrorQuery(err, q, nil)
+	}
+
+	return nil
+}
+
+// cloneDefinition returns the CREATE TABLE statement create, as reported by
+// SHOW CREATE TABLE, for a table named name (which must be quoted), renaming
+// indexes and constraints. The AUTO_INCREMENT table option is removed.
+func cloneDefinition(create, name string, renameIndex, renameConstraint func(string) string) string {
+	lines := strings.Split(create, "\n")
+
+	unquote := func(s string) string { return strings.ReplaceAll(s, "``", "`") }
+
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = "CREATE TABLE " + name + " ("
+		case reCreateTableIndex.MatchString(line):
+			parts := reCreateTableIndex.FindStringSubmatch(line)
+			lines[i] = parts[1] + QuoteIdentifier(renameIndex(unquote(parts[2]))) + line[len(parts[0]):]
+		case reCreateTableConstraint.MatchString(line):
+			parts := reCreateTableConstraint.FindStringSubmatch(line)
+			lines[i] = parts[1] + QuoteIdentifier(renameConstraint(unquote(parts[2]))) + line[len(parts[0]):]
+		case strings.HasPrefix(line, ")"):
+			lines[i] = reCreateTableAutoInc.ReplaceAllString(line, "")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// CopyOptions configures CopyTableData.
+type CopyOptions struct {
+	// SourceSchema is the schema of the source table; defaults to the current schema.
+	SourceSchema string
+	// TargetSchema is the schema of the target table; defaults to the current schema.
+	TargetSchema string
+	// Mode defines how rows conflicting with rows in the target table are
+	// handled; only BulkModeInsert (default), BulkModeIgnore, and BulkModeReplace
+	// are supported.
+	Mode BulkMode
+	// Where is the condition used to filter the rows to copy.
+	Where string
+	// ChunkSize is the number of rows copied per statement; defaults to 1000.
+	ChunkSize int
+	// Pause is the time waited after each chunk.
+	Pause time.Duration
+	// Throttle, when not nil, is called before each chunk. It can block to
+	// delay copying, for example, when the server is too busy. When it returns
+	// an error, copying stops and the error is returned.
+	Throttle func(ctx context.Context) error
+	// Progress, when not nil, is called after each chunk.
+	Progress func(CopyProgress)
+}
+
+// CopyProgress reports the progress of CopyTableData.
+type CopyProgress struct {
+	// Chunks is the number of chunks copied so far.
+	Chunks int
+	// Rows is the number of rows affected so far.
+	Rows int64
+	// EstimatedRows is the number of rows in the source table as estimated
+	// by the server.
+	EstimatedRows int64
+}
+
+// CopyTableData copies the rows of table source into table target. The rows are
+// copied in chunks ordered by the primary key of source using
+// INSERT ... SELECT statements; source must have a primary key. Only columns
+// which exist in both tables, and which are not generated in target, are copied.
+// It returns the number of affected rows.
+// The opts can be nil in which case defaults are used.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func CopyTableData(ctx context.Context, db *sql.DB, source, target string, opts *CopyOptions) (int64, error) {
+	o := CopyOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.ChunkSize < 1 {
+		o.ChunkSize = defaultCopyChunkSize
+	}
+
+	verb := "INSERT"
+	switch o.Mode {
+	case "", BulkModeInsert:
+	case BulkModeIgnore, BulkModeReplace:
+		verb = string(o.Mode)
+	default:
+		return 0, fmt.Errorf("xmysql: unsupported mode %q for copying data", o.Mode)
+	}
+
+	pk, err := PrimaryKey(db, source, o.SourceSchema)
+	if err != nil {
+		return 0, err
+	}
+	if len(pk) == 0 {
+		return 0, fmt.Errorf("xmysql: table %s has no primary key", source)
+	}
+
+	copied, err := copyColumns(db, source, target, &o)
+	if err != nil {
+		return 0, err
+	}
+	columns := strings.Join(copied, ", ")
+
+	progress := CopyProgress{}
+	q := "SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_NAME = ? AND TABLE_SCHEMA = " +
+		"COALESCE(NULLIF(?, ''), SCHEMA())"
+	var estimated sql.NullInt64
+	if err := db.QueryRowContext(ctx, q, source, o.SourceSchema).Scan(&estimated); err != nil {
+		return 0, NewError(err)
+	}
+	progress.EstimatedRows = estimated.Int64
+
+	sourceName := qualifiedTableName(o.SourceSchema, source)
+	quotedPK := make([]string, len(pk))
+	placeholders := make([]string, len(pk))
+	for i, c := range pk {
+		quotedPK[i] = QuoteIdentifier(c)
+		placeholders[i] = "?"
+	}
+	keyList := "(" + strings.Join(quotedPK, ", ") + ")"
+	keyValues := "(" + strings.Join(placeholders, ", ") + ")"
+
+	insert := verb + " INTO " + qualifiedTableName(o.TargetSchema, target) + " (" + columns + ") " +
+		"SELECT " + columns + " FROM " + sourceName
+
+	var lower []any
+	for {
+		if o.Throttle != nil {
+			if err := o.Throttle(ctx); err != nil {
+				return progress.Rows, err
+			}
+		}
+
+		var conditions []string
+		var args []any
+		if o.Where != "" {
+			conditions = append(conditions, "("+o.Where+")")
+		}
+		if lower != nil {
+			conditions = append(conditions, keyList+" > "+keyValues)
+			args = append(args, lower...)
+		}
+
+		// find the primary key of the last row of the chunk
+		bound := "SELECT " + strings.Join(quotedPK, ", ") + " FROM " + sourceName +
+			whereClause(conditions) + " ORDER BY " + strings.Join(quotedPK, ", ") +
+			" LIMIT 1 OFFSET " + strconv.Itoa(o.ChunkSize-1)
+
+		upper := make([]any, len(pk))
+		pointers := make([]any, len(pk))
+		for i := range upper {
+			pointers[i] = &upper[i]
+		}
+
+		last := false
+		if err := db.QueryRowContext(ctx, bound, args...).Scan(pointers...); err != nil {
+			if err != sql.ErrNoRows {
+				return progress.Rows, NewErrorQuery(err, bound, args)
+			}
+			last = true
+		}
+
+		chunk := insert
+		if last {
+			chunk += whereClause(conditions)
+		} else {
+			chunk += whereClause(append(conditions, keyList+" <= "+keyValues))
+			args = append(args, upper...)
+		}
+
+		res, err := db.ExecContext(ctx, chunk, args...)
+		if err != nil {
+			return progress.Rows, NewErrorQuery(err, chunk, args)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return progress.Rows, NewError(err)
+		}
+
+		progress.Chunks++
+		progress.Rows += n
+		if o.Progress != nil {
+			o.Progress(progress)
+		}
+
+		if last {
+			break
+		}
+		lower = upper
+
+		if o.Pause > 0 {
+			select {
+			case <-ctx.Done():
+				return progress.Rows, ctx.Err()
+			case <-time.After(o.Pause):
+			}
+		}
+	}
+
+	return progress.Rows, nil
+}
+
+// copyColumns returns the quoted names of the columns which can be copied from
+// source to target.
+func copyColumns(db *sql.DB, source, target string, o *CopyOptions) ([]string, error) {
+	sourceColumns, err := TableColumns(db, source, o.SourceSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	targetColumns, err := TableColumns(db, target, o.TargetSchema)
+	if err != nil {
+		return nil, err
+	}
+	if len(targetColumns) == 0 {
+		return nil, fmt.Errorf("xmysql: table %s does not exist", target)
+	}
+
+	insertable := map[string]bool{}
+	for _, c := range targetColumns {
+		insertable[strings.ToLower(c.Name)] = !c.IsGenerated()
+	}
+
+	var columns []string
+	for _, c := range sourceColumns {
+		if insertable[strings.ToLower(c.Name)] {
+			columns = append(columns, QuoteIdentifier(c.Name))
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("xmysql: tables %s and %s have no columns in common", source, target)
+	}
+
+	return columns, nil
+}
+
+// SwapTables swaps the names of table and other using a single, atomic,
+// RENAME TABLE statement. This is typically used to replace a table with
+// a rebuilt copy. If schema is not provided, current schema will be used.
+//
+// When error is returned by the server, it is of type xmysql.Error.
+func SwapTables(ctx context.Context, db *sql.DB, table, other string, schema ...string) error {
+	var s string
+	if len(schema) > 0 {
+		s = schema[0]
+	}
+
+	a := qualifiedTableName(s, table)
+	b := qualifiedTableName(s, other)
+	tmp := qualifiedTableName(s, "_xmysql_swap_"+strconv.FormatInt(time.Now().UnixNano(), 36))
+
+	q := "RENAME TABLE " + a + " TO " + tmp + ", " + b + " TO " + a + ", " + tmp + " TO " + b
+	if _, err := db.ExecContext(ctx, q); err != nil {
+		return NewErrorQuery(err, q, nil)
+	}
+
+	return nil
+}
+
+func qualifiedTableName(schema, table string) string {
+	if schema == "" {
+		return QuoteIdentifier(table)
+	}
+	return QuoteIdentifier(schema) + "." + QuoteIdentifier(table)
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestCloneDefinition(t *testing.T) {
+	create := "CREATE TABLE `orders` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `customer_id` int DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `uq_orders``x` (`customer_id`,`id`),\n" +
+		"  KEY `idx_customer` (`customer_id`),\n" +
+		"  CONSTRAINT `fk_orders_customer` FOREIGN KEY (`customer_id`) REFERENCES `customers` (`id`),\n" +
+		"  CONSTRAINT `chk_id` CHECK ((`id` > 0))\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=42 DEFAULT CHARSET=utf8mb4"
+
+	have := cloneDefinition(create, "`s`.`orders_new`",
+		func(name string) string { return "new_" + name },
+		func(name string) string { return strings.Replace(name, "orders", "orders_new", 1) },
+	)
+
+	xt.Eq(t, "CREATE TABLE `s`.`orders_new` (\n"+
+		"  `id` int NOT NULL AUTO_INCREMENT,\n"+
+		"  `customer_id` int DEFAULT NULL,\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  UNIQUE KEY `new_uq_orders``x` (`customer_id`,`id`),\n"+
+		"  KEY `new_idx_customer` (`customer_id`),\n"+
+		"  CONSTRAINT `fk_orders_new_customer` FOREIGN KEY (`customer_id`) REFERENCES `customers` (`id`),\n"+
+		"  CONSTRAINT `chk_id` CHECK ((`id` > 0))\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", have)
+}
+
+func TestCopyTable(t *testing.T) {
+	schemaName := "xmysql_test_copy"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	for _, stmt := range []string{
+		"CREATE TABLE customers (id INT PRIMARY KEY)",
+		"CREATE TABLE orders (id INT AUTO_INCREMENT PRIMARY KEY, customer_id INT, total INT, " +
+			"KEY idx_customer (customer_id), " +
+			"CONSTRAINT fk_orders_customer FOREIGN KEY (customer_id) REFERENCES customers (id))",
+		"INSERT INTO customers VALUES (1)",
+	} {
+		_, err := db.Exec(stmt)
+		xt.OK(t, err)
+	}
+	for i := 1; i <= 25; i++ {
+		_, err := db.Exec("INSERT INTO orders (customer_id, total) VALUES (1, ?)", i*10)
+		xt.OK(t, err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("clone like", func(t *testing.T) {
+		xt.OK(t, CloneTable(ctx, db, "orders", "orders_like", nil))
+
+		keys, err := ForeignKeys(db)
+		xt.OK(t, err)
+		xt.Eq(t, 1, len(keys))
+
+		xt.KO(t, CloneTable(ctx, db, "orders", "orders_like", nil))
+	})
+
+	t.Run("clone from definition", func(t *testing.T) {
+		xt.OK(t, CloneTable(ctx, db, "orders", "orders_new", &CloneOptions{FromDefinition: true}))
+
+		keys, err := ForeignKeys(db)
+		xt.OK(t, err)
+		xt.Eq(t, 2, len(keys))
+		xt.Eq(t, "fk_orders_new_customer", keys[1].Name)
+	})
+
+	t.Run("copy data", func(t *testing.T) {
+		_, err := db.Exec("ALTER TABLE orders_new ADD COLUMN doubled INT AS (total * 2)")
+		xt.OK(t, err)
+
+		var progress []CopyProgress
+		var throttled int
+		n, err := CopyTableData(ctx, db, "orders", "orders_new", &CopyOptions{
+			ChunkSize: 10,
+			Throttle: func(context.Context) error {
+				throttled++
+				return nil
+			},
+			Progress: func(p CopyProgress) { progress = append(progress, p) },
+		})
+		xt.OK(t, err)
+		xt.Eq(t, int64(25), n)
+		xt.Eq(t, 3, len(progress))
+		xt.Eq(t, int64(20), progress[1].Rows)
+		xt.Eq(t, 3, throttled)
+
+		var sum int
+		xt.OK(t, db.QueryRow("SELECT SUM(doubled) FROM orders_new").Scan(&sum))
+		xt.Eq(t, 6500, sum)
+	})
+
+	t.Run("copy with where and ignore", func(t *testing.T) {
+		n, err := CopyTableData(ctx, db, "orders", "orders_new", &CopyOptions{
+			Mode:      BulkModeIgnore,
+			Where:     "total > 200",
+			ChunkSize: 2,
+		})
+		xt.OK(t, err)
+		xt.Eq(t, int64(0), n)
+
+		_, err = CopyTableData(ctx, db, "orders", "orders_new", &CopyOptions{Where: "total > 200"})
+		xt.KO(t, err)
+	})
+
+	t.Run("throttle error", func(t *testing.T) {
+		_, err := CopyTableData(ctx, db, "orders", "orders_like", &CopyOptions{
+			Throttle: func(context.Context) error { return fmt.Errorf("too busy") },
+		})
+		xt.KO(t, err)
+	})
+
+	t.Run("swap", func(t *testing.T) {
+		xt.OK(t, SwapTables(ctx, db, "orders", "orders_new"))
+
+		columns, err := TableColumns(db, "orders")
+		xt.OK(t, err)
+		xt.Eq(t, 4, len(columns))
+
+		columns, err = TableColumns(testDB, "orders_new", schemaName)
+		xt.OK(t, err)
+		xt.Eq(t, 3, len(columns))
+	})
+}
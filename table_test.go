@@ -33,6 +33,12 @@ func TestTableExists(t *testing.T) {
 		xt.Assert(t, !have)
 	})
 
+	t.Run("table exists in other schema", func(t *testing.T) {
+		have, err := TableExists(db, "user", "mysql")
+		xt.OK(t, err)
+		xt.Assert(t, have)
+	})
+
 	t.Run("error", func(t *testing.T) {
 		db, err := sql.Open("mysql", "root:mysql@tcp(127.0.0.1:12345)/?parseTime=true")
 		xt.OK(t, err)
@@ -158,3 +164,75 @@ func TestTableComment(t *testing.T) {
 		xt.Eq(t, exp, have)
 	})
 }
+
+func TestTableColumns(t *testing.T) {
+	schemaName := "xmysql_test_table_columns"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dns, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dns)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	_, err = db.Exec("CREATE TABLE parent (id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY, " +
+		"name VARCHAR(20) DEFAULT 'x' COMMENT 'the name', upper_name VARCHAR(20) AS (UPPER(name)))")
+	xt.OK(t, err)
+	_, err = db.Exec("CREATE TABLE child (id INT PRIMARY KEY, parent_id INT UNSIGNED, " +
+		"CONSTRAINT fk_parent FOREIGN KEY (parent_id) REFERENCES parent (id))")
+	xt.OK(t, err)
+
+	t.Run("columns", func(t *testing.T) {
+		columns, err := TableColumns(db, "parent")
+		xt.OK(t, err)
+		xt.Eq(t, 3, len(columns))
+
+		xt.Eq(t, "id", columns[0].Name)
+		xt.Eq(t, "int unsigned", columns[0].ColumnType)
+		xt.Eq(t, "PRI", columns[0].Key)
+		xt.Assert(t, !columns[0].Nullable)
+
+		xt.Eq(t, "name", columns[1].Name)
+		xt.Eq(t, "varchar", columns[1].DataType)
+		xt.Eq(t, "x", *columns[1].Default)
+		xt.Eq(t, "the name", columns[1].Comment)
+		xt.Assert(t, columns[1].Nullable)
+
+		xt.Assert(t, columns[2].IsGenerated())
+	})
+
+	t.Run("columns of table in other schema", func(t *testing.T) {
+		columns, err := TableColumns(testDB, "child", schemaName)
+		xt.OK(t, err)
+		xt.Eq(t, 2, len(columns))
+	})
+
+	t.Run("foreign keys", func(t *testing.T) {
+		keys, err := ForeignKeys(testDB, schemaName)
+		xt.OK(t, err)
+		xt.Eq(t, 1, len(keys))
+		xt.Eq(t, &ForeignKey{
+			Name:              "fk_parent",
+			Table:             "child",
+			Columns:           []string{"parent_id"},
+			ReferencedSchema:  schemaName,
+			ReferencedTable:   "parent",
+			ReferencedColumns: []string{"id"},
+		}, keys[0])
+	})
+	t.Run("primary key", func(t *testing.T) {
+		_, err = db.Exec("CREATE TABLE composite (a INT, b INT, c INT, PRIMARY KEY (c, a))")
+		xt.OK(t, err)
+
+		columns, err := PrimaryKey(db, "composite")
+		xt.OK(t, err)
+		xt.Eq(t, []string{"c", "a"}, columns)
+
+		columns, err = PrimaryKey(testDB, "child", schemaName)
+		xt.OK(t, err)
+		xt.Eq(t, []string{"id"}, columns)
+	})
+}
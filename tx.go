@@ -0,0 +1,241 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultTxMaxAttempts = 3
+	defaultTxMinBackoff  = 20 * time.Millisecond
+	defaultTxMaxBackoff  = time.Second
+)
+
+// TxOptions configures how WithTx starts and retries a transaction.
+type TxOptions struct {
+	// Isolation is the isolation level of the transaction. The zero value
+	// uses the default of the server (or session).
+	Isolation sql.IsolationLevel
+	// ReadOnly starts the transaction using START TRANSACTION READ ONLY.
+	ReadOnly bool
+	// MaxAttempts is the number of times the transaction is tried in total
+	// when it fails with a retryable error. Defaults to 3.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the jittered exponential backoff
+	// between attempts. They default to 20ms and 1s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// TxFunc is the function executed within a transaction by WithTx.
+type TxFunc func(ctx context.Context, tx *sql.Tx) error
+
+// WithTx starts a transaction using db and executes fn within it. The transaction
+// is committed when fn returns no error, and rolled back otherwise. When fn panics,
+// the transaction is rolled back and the panic is propagated.
+//
+// When the transaction fails with a retryable error, for example a deadlock
+// (ErrLockDeadlock) or lock wait timeout (ErrLockWaitTimeout), the whole of fn
+// is executed again in a new transaction, waiting with jittered exponential backoff
+// between attempts. The opts can be nil in which case defaults are used.
+//
+// When ctx was passed down by an enclosing WithTx using the same db, no new
+// transaction is started. Instead, a savepoint is created within the already
+// open transaction and fn is executed using it. When fn fails, only the changes
+// since the savepoint are rolled back. Retrying is left to the outermost WithTx,
+// and the isolation level and read-only options are ignored. When the nested fn
+// fails with a retryable error, after which the server might have rolled back
+// the whole transaction, or the savepoint cannot be rolled back, the enclosing
+// transaction is not committed, even when the error is ignored by the enclosing
+// fn. Instead, the error is returned, and retried when retryable.
+//
+// When error is returned, it is of type xmysql.Error and its Attempts field holds
+// the number of times the transaction was tried.
+func WithTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn TxFunc) error {
+	if cur, ok := ctx.Value(txContextKey{}).(*txContext); ok && cur.db == db {
+		return runNestedTx(ctx, cur, fn)
+	}
+
+	o := TxOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxAttempts < 1 {
+		o.MaxAttempts = defaultTxMaxAttempts
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultTxMinBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = defaultTxMaxBackoff
+		if o.MaxBackoff < o.MinBackoff {
+			o.MaxBackoff = o.MinBackoff
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, &o, fn)
+		if err == nil {
+			return nil
+		}
+
+		var e Error
+		if !errors.As(err, &e) {
+			e = NewError(err)
+		}
+		e.Attempts = attempt
+
+		if attempt >= o.MaxAttempts || !IsRetryable(err) {
+			return e
+		}
+
+		t := time.NewTimer(txBackoff(attempt, o.MinBackoff, o.MaxBackoff))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return e
+		case <-t.C:
+		}
+	}
+}
+
+func runTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn TxFunc) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return ErrorTxBegin(err)
+	}
+
+	cur := &txContext{db: db, tx: tx}
+	ctx = context.WithValue(ctx, txContextKey{}, cur)
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if cur.broken != nil {
+		_ = tx.Rollback()
+		return cur.broken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ErrorTxCommit(err)
+	}
+
+	return nil
+}
+
+func runNestedTx(ctx context.Context, cur *txContext, fn TxFunc) error {
+	if cur.broken != nil {
+		return cur.broken
+	}
+
+	tx := cur.tx
+	sp, err := NewSavepoint(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = sp.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		var e Error
+		if !errors.As(err, &e) {
+			e = NewError(err)
+		}
+		e.Attempts = 1
+
+		if rbErr := sp.Rollback(ctx); rbErr != nil {
+			e.Message = fmt.Sprintf("%s (rolling back to savepoint: %s)", e.Error(), rbErr)
+			e.DriverError = errors.Join(e.DriverError, rbErr)
+			cur.broken = e
+		}
+
+		// after a deadlock, for example, the server rolled back the whole
+		// transaction, so the changes preceding the savepoint are gone
+		if IsRetryable(err) {
+			cur.broken = e
+		}
+
+		return e
+	}
+
+	return sp.Release(ctx)
+}
+
+// txContextKey is the key used to store the transaction started by WithTx
+// in the context passed on to its function.
+type txContextKey struct{}
+
+type txContext struct {
+	db *sql.DB
+	tx *sql.Tx
+	// broken is the error of a nested transaction after which tx cannot
+	// be committed.
+	broken error
+}
+
+// TxFromContext returns the transaction started by WithTx which is stored in
+// ctx. It returns false when ctx does not carry a transaction.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	cur, ok := ctx.Value(txContextKey{}).(*txContext)
+	if !ok {
+		return nil, false
+	}
+	return cur.tx, true
+}
+
+// txBackoff returns the time to wait before the next attempt using the
+// "full jitter" strategy: a random duration between lo and the exponentially
+// growing ceiling, which is capped by hi.
+func txBackoff(attempt int, lo, hi time.Duration) time.Duration {
+	ceiling := hi
+	if attempt < 32 {
+		if c := lo << attempt; c > 0 && c < hi {
+			ceiling = c
+		}
+	}
+
+	if ceiling <= lo {
+		return lo
+	}
+
+	return lo + time.Duration(rand.Int63n(int64(ceiling-lo)))
+}
+
+// IsRetryable returns whether err is a MySQL error after which the transaction
+// can be tried again, such as a deadlock or a lock wait timeout.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	info, _ := ExtractError(err)
+	switch info.Number {
+	case ErrLockDeadlock, ErrLockWaitTimeout:
+		return true
+	default:
+		return false
+	}
+}
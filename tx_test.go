@@ -0,0 +1,171 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golistic/xgo/xsql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestIsRetryable(t *testing.T) {
+	var cases = map[string]struct {
+		err error
+		exp bool
+	}{
+		"deadlock": {
+			err: &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"},
+			exp: true,
+		},
+		"lock wait timeout": {
+			err: &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"},
+			exp: true,
+		},
+		"wrapped in xmysql.Error": {
+			err: NewError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}),
+			exp: true,
+		},
+		"duplicate entry": {
+			err: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"},
+			exp: false,
+		},
+		"not a MySQL error": {
+			err: fmt.Errorf("something else"),
+			exp: false,
+		},
+		"nil": {
+			err: nil,
+			exp: false,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			xt.Eq(t, c.exp, IsRetryable(c.err))
+		})
+	}
+}
+
+func TestTxBackoff(t *testing.T) {
+	lo, hi := 10*time.Millisecond, 100*time.Millisecond
+
+	for attempt := 1; attempt < 40; attempt++ {
+		d := txBackoff(attempt, lo, hi)
+		xt.Assert(t, d >= lo, fmt.Sprintf("attempt %d: %s below %s", attempt, d, lo))
+		xt.Assert(t, d <= hi, fmt.Sprintf("attempt %d: %s above %s", attempt, d, hi))
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	schemaName := "xmysql_test_with_tx"
+	_ = DropSchema(testDB, schemaName)
+	xt.OK(t, CreateSchema(testDB, schemaName))
+	defer func() { _ = DropSchema(testDB, schemaName) }()
+
+	dsn, err := xsql.ReplaceDSNDatabase(testDSN, schemaName)
+	xt.OK(t, err)
+
+	db, err := sql.Open("mysql", dsn)
+	xt.OK(t, err)
+	defer func() { _ = db.Close() }()
+
+	_, err = db.Exec("CREATE TABLE t1 (id INT PRIMARY KEY)")
+	xt.OK(t, err)
+
+	count := func(t *testing.T, id int) int {
+		var n int
+		xt.OK(t, db.QueryRow("SELECT COUNT(*) FROM t1 WHERE id = ?", id).Scan(&n))
+		return n
+	}
+
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		err := WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (1)")
+			return err
+		})
+		xt.OK(t, err)
+		xt.Eq(t, 1, count(t, 1))
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		err := WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (2)"); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (1)")
+			return err
+		})
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, ErrDubEntry))
+
+		var e Error
+		xt.Assert(t, errors.As(err, &e))
+		xt.Eq(t, 1, e.Attempts)
+		xt.Eq(t, 0, count(t, 2))
+	})
+
+	t.Run("rollback on panic", func(t *testing.T) {
+		xt.Panics(t, func() {
+			_ = WithTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (3)"); err != nil {
+					return err
+				}
+				panic("oops")
+			})
+		})
+		xt.Eq(t, 0, count(t, 3))
+	})
+
+	t.Run("retry on deadlock", func(t *testing.T) {
+		var calls int
+		err := WithTx(ctx, db, &TxOptions{MinBackoff: time.Millisecond},
+			func(ctx context.Context, tx *sql.Tx) error {
+				calls++
+				if _, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (4)"); err != nil {
+					return err
+				}
+				if calls < 2 {
+					return &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+				}
+				return nil
+			})
+		xt.OK(t, err)
+		xt.Eq(t, 2, calls)
+		xt.Eq(t, 1, count(t, 4))
+	})
+
+	t.Run("give up after max attempts", func(t *testing.T) {
+		var calls int
+		err := WithTx(ctx, db, &TxOptions{MaxAttempts: 3, MinBackoff: time.Millisecond},
+			func(ctx context.Context, tx *sql.Tx) error {
+				calls++
+				return &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+			})
+		xt.KO(t, err)
+		xt.Eq(t, 3, calls)
+
+		var e Error
+		xt.Assert(t, errors.As(err, &e))
+		xt.Eq(t, 3, e.Attempts)
+		xt.Eq(t, ErrLockWaitTimeout, e.Number)
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		err := WithTx(ctx, db, &TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead},
+			func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "INSERT INTO t1 VALUES (5)")
+				return err
+			})
+		xt.KO(t, err)
+		xt.Eq(t, 0, count(t, 5))
+	})
+}
@@ -14,3 +14,14 @@ func GlobalVariable(db *sql.DB, name string) (string, error) {
 
 	return v, nil
 }
+
+// GlobalStatus returns value of a global status variable by its name.
+func GlobalStatus(db *sql.DB, name string) (string, error) {
+	var v string
+	q := "SELECT VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME = ?"
+	if err := db.QueryRow(q, name).Scan(&v); err != nil {
+		return "", err
+	}
+
+	return v, nil
+}
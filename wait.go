@@ -0,0 +1,175 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultWaitMinBackoff = 100 * time.Millisecond
+	defaultWaitMaxBackoff = 5 * time.Second
+)
+
+// WaitOptions configures what WaitReady waits for.
+type WaitOptions struct {
+	// Schema, when not empty, is the schema which must exist.
+	Schema string
+	// Variable, when not empty, is the global variable which must have
+	// VariableValue as value. Values are compared case-insensitively so that,
+	// for example, "ON" matches "on".
+	Variable      string
+	VariableValue string
+	// MinBackoff and MaxBackoff bound the jittered exponential backoff
+	// between attempts. They default to 100ms and 5s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// waitConditionError is reported when the server accepts queries, but the
+// conditions of WaitOptions are not (yet) met.
+type waitConditionError struct {
+	msg string
+}
+
+func (e waitConditionError) Error() string {
+	return e.msg
+}
+
+// WaitReady connects to the server using dsn, and keeps trying until it
+// accepts queries and the conditions set in opts are met, or until ctx is
+// done. It waits with jittered exponential backoff between attempts. This is
+// useful, for example, when a container running MySQL was just started.
+// The opts can be nil in which case defaults are used.
+//
+// Errors meaning the server is not up yet, such as connections being refused
+// (ErrClientConnRefused) or lost, are retried. Other errors, for example when
+// access is denied, are returned immediately.
+//
+// When error is returned, it is of type xmysql.Error and its Attempts field holds
+// the number of times the server was tried.
+func WaitReady(ctx context.Context, dsn string, opts *WaitOptions) error {
+	o := WaitOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultWaitMinBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = defaultWaitMaxBackoff
+		if o.MaxBackoff < o.MinBackoff {
+			o.MaxBackoff = o.MinBackoff
+		}
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return NewError(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		err := waitReadyCheck(ctx, db, &o)
+		if err == nil {
+			return nil
+		}
+
+		// keep the reason of the previous attempt when ctx ended this one
+		if lastErr == nil || ctx.Err() == nil {
+			lastErr = err
+		}
+
+		var e Error
+		if !errors.As(lastErr, &e) {
+			e = NewError(lastErr)
+		}
+		e.Attempts = attempt
+
+		if ctx.Err() != nil || !serverNotReady(err, &o) {
+			return e
+		}
+
+		t := time.NewTimer(txBackoff(attempt, o.MinBackoff, o.MaxBackoff))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return e
+		case <-t.C:
+		}
+	}
+}
+
+func waitReadyCheck(ctx context.Context, db *sql.DB, opts *WaitOptions) error {
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	if opts.Schema != "" {
+		var n int
+		q := "SELECT COUNT(*) FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?"
+		if err := db.QueryRowContext(ctx, q, opts.Schema).Scan(&n); err != nil {
+			return NewErrorQuery(err, q, []any{opts.Schema})
+		}
+		if n == 0 {
+			return waitConditionError{msg: fmt.Sprintf("xmysql: schema '%s' does not exist", opts.Schema)}
+		}
+	}
+
+	if opts.Variable != "" {
+		var name, value string
+		q := "SHOW GLOBAL VARIABLES WHERE Variable_name = " + QuoteString(opts.Variable)
+		switch err := db.QueryRowContext(ctx, q).Scan(&name, &value); {
+		case errors.Is(err, sql.ErrNoRows):
+			return waitConditionError{msg: fmt.Sprintf("xmysql: variable '%s' not available", opts.Variable)}
+		case err != nil:
+			return NewErrorQuery(err, q, nil)
+		case !strings.EqualFold(value, opts.VariableValue):
+			return waitConditionError{msg: fmt.Sprintf("xmysql: variable '%s' is '%s' (waiting for '%s')",
+				opts.Variable, value, opts.VariableValue)}
+		}
+	}
+
+	return nil
+}
+
+// serverNotReady returns whether err means that the server is not (yet)
+// accepting queries, or that the conditions of opts are not yet met.
+func serverNotReady(err error, opts *WaitOptions) bool {
+	var condErr waitConditionError
+	switch {
+	case errors.As(err, &condErr):
+		return true
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		// connection closed while the server is starting or shutting down
+		return true
+	}
+
+	info, _ := ExtractError(err)
+	switch info.Number {
+	case ErrClientConnRefused,
+		1040, // ER_CON_COUNT_ERROR
+		1053, // ER_SERVER_SHUTDOWN
+		2002, // CR_CONNECTION_ERROR
+		2003, // CR_CONN_HOST_ERROR
+		2006, // CR_SERVER_GONE_ERROR
+		2013: // CR_SERVER_LOST
+		return true
+	case 1049: // ER_BAD_DB_ERROR
+		// dsn selects the schema we are waiting for
+		return opts.Schema != ""
+	default:
+		return false
+	}
+}
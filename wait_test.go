@@ -0,0 +1,83 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golistic/xgo/xt"
+)
+
+func TestServerNotReady(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connect: connection refused")}
+
+	xt.Assert(t, serverNotReady(refused, &WaitOptions{}))
+	xt.Assert(t, serverNotReady(NewError(refused), &WaitOptions{}))
+	xt.Assert(t, serverNotReady(driver.ErrBadConn, &WaitOptions{}))
+	xt.Assert(t, serverNotReady(&mysql.MySQLError{Number: 1053}, &WaitOptions{}))
+	xt.Assert(t, serverNotReady(waitConditionError{msg: "not yet"}, &WaitOptions{}))
+	xt.Assert(t, !serverNotReady(&mysql.MySQLError{Number: 1045}, &WaitOptions{}))
+	xt.Assert(t, !serverNotReady(&mysql.MySQLError{Number: 1049}, &WaitOptions{}))
+	xt.Assert(t, serverNotReady(&mysql.MySQLError{Number: 1049}, &WaitOptions{Schema: "app"}))
+}
+
+func TestWaitReady(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		xt.OK(t, WaitReady(ctx, testDSN, &WaitOptions{
+			Schema:        "mysql",
+			Variable:      "autocommit",
+			VariableValue: "on",
+		}))
+	})
+
+	t.Run("condition not met", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		err := WaitReady(ctx, testDSN, &WaitOptions{
+			Schema:     "xmysql_test_never_created",
+			MinBackoff: 10 * time.Millisecond,
+		})
+		xt.KO(t, err)
+		xt.Eq(t, "xmysql: schema 'xmysql_test_never_created' does not exist", err.Error())
+		xt.Assert(t, err.(Error).Attempts > 1)
+	})
+
+	t.Run("access denied fails fast", func(t *testing.T) {
+		cfg, err := mysql.ParseDSN(testDSN)
+		xt.OK(t, err)
+		cfg.Passwd = "wrong" + cfg.Passwd
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = WaitReady(ctx, cfg.FormatDSN(), nil)
+		xt.KO(t, err)
+		xt.Assert(t, ErrorIs(err, 1045))
+		xt.Eq(t, 1, err.(Error).Attempts)
+	})
+}
+
+func TestWaitReady_refused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	xt.OK(t, err)
+	addr := l.Addr().String()
+	xt.OK(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err = WaitReady(ctx, "root@tcp("+addr+")/", &WaitOptions{MinBackoff: 10 * time.Millisecond})
+	xt.KO(t, err)
+	xt.Assert(t, ErrorIs(err, ErrClientConnRefused))
+	xt.Assert(t, err.(Error).Attempts > 1)
+}
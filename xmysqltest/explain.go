@@ -0,0 +1,83 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysqltest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/golistic/xmysql"
+)
+
+// AssertUsesIndex reports an error when the execution plan of query does not
+// use the index with given name for any of its tables. The plan is returned
+// for further inspection. See xmysql.Explain.
+func AssertUsesIndex(t testing.TB, db *sql.DB, index string, query string, args ...any) *xmysql.Plan {
+	t.Helper()
+
+	plan := explain(t, db, query, args)
+	if !plan.UsesIndex(index) {
+		t.Errorf("xmysqltest: query does not use index %s\n%s\n%s", index, query, plan)
+	}
+
+	return plan
+}
+
+// AssertNoFullTableScan reports an error when the execution plan of query
+// reads any table entirely. The plan is returned for further inspection.
+// See xmysql.Explain.
+func AssertNoFullTableScan(t testing.TB, db *sql.DB, query string, args ...any) *xmysql.Plan {
+	t.Helper()
+
+	plan := explain(t, db, query, args)
+	if scans := plan.FullTableScans(); len(scans) > 0 {
+		names := make([]string, len(scans))
+		for i, n := range scans {
+			names[i] = n.Table
+		}
+		t.Errorf("xmysqltest: query scans table %s\n%s\n%s", strings.Join(names, ", "), query, plan)
+	}
+
+	return plan
+}
+
+// AssertNoFilesort reports an error when the execution plan of query sorts
+// rows instead of reading them in order using an index. The plan is returned
+// for further inspection. See xmysql.Explain.
+func AssertNoFilesort(t testing.TB, db *sql.DB, query string, args ...any) *xmysql.Plan {
+	t.Helper()
+
+	plan := explain(t, db, query, args)
+	if plan.UsesFilesort() {
+		t.Errorf("xmysqltest: query uses filesort\n%s\n%s", query, plan)
+	}
+
+	return plan
+}
+
+// AssertNoTemporaryTable reports an error when the execution plan of query
+// uses an internal temporary table. The plan is returned for further
+// inspection. See xmysql.Explain.
+func AssertNoTemporaryTable(t testing.TB, db *sql.DB, query string, args ...any) *xmysql.Plan {
+	t.Helper()
+
+	plan := explain(t, db, query, args)
+	if plan.UsesTemporaryTable() {
+		t.Errorf("xmysqltest: query uses a temporary table\n%s\n%s", query, plan)
+	}
+
+	return plan
+}
+
+func explain(t testing.TB, db *sql.DB, query string, args []any) *xmysql.Plan {
+	t.Helper()
+
+	plan, err := xmysql.Explain(context.Background(), db, query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return plan
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysqltest
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/golistic/xgo/xt"
+)
+
+// recordingTB records errors instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertPlan(t *testing.T) {
+	db := New(t, &Options{
+		Setup: func(db *sql.DB) error {
+			for _, q := range []string{
+				"CREATE TABLE users (id INT PRIMARY KEY, email VARCHAR(100), name VARCHAR(100), KEY idx_email (email))",
+				"INSERT INTO users VALUES (1, 'alice@example.com', 'Alice'), (2, 'bob@example.com', 'Bob')",
+			} {
+				if _, err := db.Exec(q); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+
+	t.Run("passing", func(t *testing.T) {
+		q := "SELECT id FROM users WHERE email = ?"
+		plan := AssertUsesIndex(t, db, "idx_email", q, "bob@example.com")
+		xt.Eq(t, q, plan.Query)
+
+		AssertNoFullTableScan(t, db, q, "bob@example.com")
+		AssertNoFilesort(t, db, q, "bob@example.com")
+		AssertNoTemporaryTable(t, db, q, "bob@example.com")
+	})
+
+	t.Run("failing", func(t *testing.T) {
+		rec := &recordingTB{TB: t}
+		q := "SELECT name, COUNT(*) FROM users WHERE name <> ? GROUP BY name ORDER BY COUNT(*)"
+
+		AssertUsesIndex(rec, db, "idx_email", q, "Alice")
+		AssertNoFullTableScan(rec, db, q, "Alice")
+		AssertNoTemporaryTable(rec, db, q, "Alice")
+
+		xt.Eq(t, 3, len(rec.errors))
+		xt.MatchString(t, `^xmysqltest: query does not use index idx_email\n`, rec.errors[0])
+		xt.MatchString(t, `^xmysqltest: query scans table users\n`, rec.errors[1])
+	})
+}
@@ -0,0 +1,449 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysqltest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/golistic/xmysql"
+)
+
+const defaultFixtureBatchSize = 100
+
+// fixtureNull is used in CSV fixtures to denote NULL, same as in the output
+// of SELECT ... INTO OUTFILE.
+const fixtureNull = `\N`
+
+// Fixtures holds the rows to insert per table.
+type Fixtures struct {
+	tables map[string][]map[string]any
+	// loaded holds the options of the last Load, reused by Reset.
+	loaded *FixtureOptions
+}
+
+// FixtureOptions configures how fixtures are loaded.
+type FixtureOptions struct {
+	// DisableForeignKeyChecks turns off FOREIGN_KEY_CHECKS while loading.
+	DisableForeignKeyChecks bool
+	// Truncate empties the tables before loading.
+	Truncate bool
+	// BatchSize is the number of rows inserted per statement; defaults to 100.
+	BatchSize int
+}
+
+// NewFixtures returns an empty set of fixtures.
+func NewFixtures() *Fixtures {
+	return &Fixtures{tables: map[string][]map[string]any{}}
+}
+
+// ReadFixtures reads fixture files from fsys matching the patterns (see fs.Glob).
+// When no patterns are provided, all fixture files in the root of fsys are read.
+// Each file holds the rows of one table, named after the file without extension.
+// Supported are YAML (.yaml, .yml) and JSON (.json) files holding a list of
+// objects, and CSV (.csv) files of which the first record holds the column
+// names; in CSV files NULL is written as \N.
+func ReadFixtures(fsys fs.FS, patterns ...string) (*Fixtures, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*.yaml", "*.yml", "*.json", "*.csv"}
+	}
+
+	f := NewFixtures()
+
+	for _, pattern := range patterns {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+
+			ext := path.Ext(name)
+			table := strings.TrimSuffix(path.Base(name), ext)
+
+			rows, err := decodeFixture(ext, data)
+			if err != nil {
+				return nil, fmt.Errorf("xmysqltest: reading fixture %s: %w", name, err)
+			}
+
+			f.Add(table, rows...)
+		}
+	}
+
+	return f, nil
+}
+
+func decodeFixture(ext string, data []byte) ([]map[string]any, error) {
+	var rows []map[string]any
+
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &rows); err != nil {
+			return nil, err
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&rows); err != nil {
+			return nil, err
+		}
+	case ".csv":
+		r := csv.NewReader(bytes.NewReader(data))
+		header, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			row := make(map[string]any, len(header))
+			for i, column := range header {
+				if record[i] == fixtureNull {
+					row[column] = nil
+				} else {
+					row[column] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", ext)
+	}
+
+	return rows, nil
+}
+
+// Add adds rows to the fixtures of table.
+func (f *Fixtures) Add(table string, rows ...map[string]any) {
+	f.tables[table] = append(f.tables[table], rows...)
+}
+
+// Tables returns the names of the tables having fixtures, sorted by name.
+func (f *Fixtures) Tables() []string {
+	tables := make([]string, 0, len(f.tables))
+	for t := range f.tables {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Load inserts the fixtures into the tables of the current schema of db. Tables are
+// loaded in order of their foreign keys so that referenced rows are inserted first.
+// Values are converted to the type of their column.
+// The opts can be nil in which case defaults are used.
+func (f *Fixtures) Load(ctx context.Context, db *sql.DB, opts *FixtureOptions) error {
+	o := FixtureOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = defaultFixtureBatchSize
+	}
+	f.loaded = &o
+
+	order, err := f.loadOrder(db, o.DisableForeignKeyChecks)
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return xmysql.NewError(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	var fkChecks int
+	if err := conn.QueryRowContext(ctx, "SELECT @@SESSION.foreign_key_checks").Scan(&fkChecks); err != nil {
+		return xmysql.NewError(err)
+	}
+	setFKChecks := func(v int) error {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET SESSION foreign_key_checks = %d", v)); err != nil {
+			return xmysql.NewError(err)
+		}
+		return nil
+	}
+	defer func() { _ = setFKChecks(fkChecks) }()
+
+	if o.Truncate {
+		// truncating a table referenced by a foreign key requires checks to be off
+		if err := setFKChecks(0); err != nil {
+			return err
+		}
+		for i := len(order) - 1; i >= 0; i-- {
+			if _, err := conn.ExecContext(ctx, "TRUNCATE TABLE "+xmysql.QuoteIdentifier(order[i])); err != nil {
+				return xmysql.NewError(err)
+			}
+		}
+		if err := setFKChecks(fkChecks); err != nil {
+			return err
+		}
+	}
+
+	if o.DisableForeignKeyChecks {
+		if err := setFKChecks(0); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range order {
+		if err := f.loadTable(ctx, db, conn, table, o.BatchSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset empties the tables having fixtures and loads the fixtures again using
+// the options of the last Load, for example, with foreign key checks disabled.
+// This is typically used between tests which modify the data.
+func (f *Fixtures) Reset(ctx context.Context, db *sql.DB) error {
+	o := FixtureOptions{}
+	if f.loaded != nil {
+		o = *f.loaded
+	}
+	o.Truncate = true
+
+	return f.Load(ctx, db, &o)
+}
+
+// loadOrder returns the tables sorted so that tables are loaded after the tables
+// they reference. When the references are circular, an error is returned unless
+// foreign key checks are disabled, in which case the tables are sorted by name.
+func (f *Fixtures) loadOrder(db *sql.DB, fkChecksDisabled bool) ([]string, error) {
+	tables := f.Tables()
+
+	keys, err := xmysql.ForeignKeys(db)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := map[string]map[string]bool{}
+	for _, fk := range keys {
+		_, isFixture := f.tables[fk.ReferencedTable]
+		if !isFixture || fk.ReferencedTable == fk.Table {
+			continue
+		}
+		if deps[fk.Table] == nil {
+			deps[fk.Table] = map[string]bool{}
+		}
+		deps[fk.Table][fk.ReferencedTable] = true
+	}
+
+	var order []string
+	done := map[string]bool{}
+	for len(order) < len(tables) {
+		progress := false
+		for _, t := range tables {
+			if done[t] {
+				continue
+			}
+
+			ready := true
+			for dep := range deps[t] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				order = append(order, t)
+				done[t] = true
+				progress = true
+			}
+		}
+
+		if !progress {
+			if fkChecksDisabled {
+				return tables, nil
+			}
+			return nil, fmt.Errorf("xmysqltest: circular foreign keys between fixture tables; " +
+				"disable foreign key checks to load")
+		}
+	}
+
+	return order, nil
+}
+
+func (f *Fixtures) loadTable(ctx context.Context, db *sql.DB, conn *sql.Conn, table string, batchSize int) error {
+	rows := f.tables[table]
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tableColumns, err := xmysql.TableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	if len(tableColumns) == 0 {
+		return fmt.Errorf("xmysqltest: fixture table %s does not exist", table)
+	}
+
+	byName := map[string]*xmysql.Column{}
+	for _, c := range tableColumns {
+		byName[c.Name] = c
+	}
+
+	used := map[string]bool{}
+	for _, row := range rows {
+		for name := range row {
+			if _, ok := byName[name]; !ok {
+				return fmt.Errorf("xmysqltest: fixture for table %s has unknown column %s", table, name)
+			}
+			used[name] = true
+		}
+	}
+
+	var columns []*xmysql.Column
+	var quoted []string
+	for _, c := range tableColumns {
+		if used[c.Name] {
+			columns = append(columns, c)
+			quoted = append(quoted, xmysql.QuoteIdentifier(c.Name))
+		}
+	}
+
+	stmt := "INSERT INTO " + xmysql.QuoteIdentifier(table) + " (" + strings.Join(quoted, ", ") + ") VALUES "
+
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var values []string
+		var args []any
+		for _, row := range rows[start:end] {
+			placeholders := make([]string, len(columns))
+			for i, c := range columns {
+				v, ok := row[c.Name]
+				if !ok {
+					placeholders[i] = "DEFAULT"
+					continue
+				}
+
+				cv, err := convertFixtureValue(c, v)
+				if err != nil {
+					return fmt.Errorf("xmysqltest: fixture for table %s column %s: %w", table, c.Name, err)
+				}
+				placeholders[i] = "?"
+				args = append(args, cv)
+			}
+			values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		}
+
+		if _, err := conn.ExecContext(ctx, stmt+strings.Join(values, ", "), args...); err != nil {
+			return xmysql.NewError(err)
+		}
+	}
+
+	return nil
+}
+
+// convertFixtureValue converts v, as decoded from a fixture file, to a value
+// suitable for column c.
+func convertFixtureValue(c *xmysql.Column, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	unsigned := strings.Contains(c.ColumnType, "unsigned")
+
+	switch c.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year", "bit":
+		switch t := v.(type) {
+		case bool:
+			if t {
+				return 1, nil
+			}
+			return 0, nil
+		case int, int64, uint64:
+			return t, nil
+		case float64:
+			if t != float64(int64(t)) {
+				return nil, fmt.Errorf("%v is not an integer", t)
+			}
+			return int64(t), nil
+		case json.Number:
+			return parseFixtureInt(t.String(), unsigned)
+		case string:
+			return parseFixtureInt(t, unsigned)
+		}
+	case "decimal", "float", "double":
+		switch t := v.(type) {
+		case float64:
+			return strconv.FormatFloat(t, 'f', -1, 64), nil
+		case json.Number:
+			return t.String(), nil
+		case int, int64, uint64, string:
+			return fmt.Sprint(t), nil
+		}
+	case "json":
+		switch t := v.(type) {
+		case string:
+			return t, nil
+		default:
+			data, err := json.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			return string(data), nil
+		}
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		switch t := v.(type) {
+		case string:
+			return []byte(t), nil
+		case []byte:
+			return t, nil
+		}
+	case "date", "datetime", "timestamp", "time":
+		switch t := v.(type) {
+		case time.Time, string:
+			return t, nil
+		}
+	default:
+		switch t := v.(type) {
+		case string:
+			return t, nil
+		case json.Number:
+			return t.String(), nil
+		case bool, int, int64, uint64, float64:
+			return fmt.Sprint(t), nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot use %T as %s", v, c.ColumnType)
+}
+
+func parseFixtureInt(s string, unsigned bool) (any, error) {
+	if unsigned {
+		return strconv.ParseUint(s, 10, 64)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
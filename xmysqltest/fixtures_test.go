@@ -0,0 +1,180 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysqltest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/golistic/xgo/xt"
+
+	"github.com/golistic/xmysql"
+)
+
+var testFixtureFS = fstest.MapFS{
+	"countries.yaml": {Data: []byte(`
+- code: BE
+  name: Belgium
+- code: NL
+  name: Netherlands
+`)},
+	"cities.json": {Data: []byte(`[
+  {"id": 1, "name": "Brussels", "country": "BE", "population": 1222637, "info": {"capital": true}},
+  {"id": 2, "name": "Amsterdam", "country": "NL", "population": null}
+]`)},
+	"people.csv": {Data: []byte("id,name,city_id,balance\n1,Alice,1,10.50\n2,Bob,\\N,0\n")},
+	"README.md":  {Data: []byte("not a fixture")},
+}
+
+func TestReadFixtures(t *testing.T) {
+	f, err := ReadFixtures(testFixtureFS)
+	xt.OK(t, err)
+	xt.Eq(t, []string{"cities", "countries", "people"}, f.Tables())
+
+	xt.Eq(t, "Belgium", f.tables["countries"][0]["name"])
+	xt.Eq(t, json.Number("1222637"), f.tables["cities"][0]["population"])
+	xt.Eq(t, nil, f.tables["people"][1]["city_id"])
+	xt.Eq(t, "10.50", f.tables["people"][0]["balance"])
+
+	t.Run("pattern", func(t *testing.T) {
+		f, err := ReadFixtures(testFixtureFS, "*.csv")
+		xt.OK(t, err)
+		xt.Eq(t, []string{"people"}, f.Tables())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ReadFixtures(fstest.MapFS{"t1.json": {Data: []byte(`{"id": 1}`)}})
+		xt.KO(t, err)
+	})
+}
+
+func TestConvertFixtureValue(t *testing.T) {
+	var cases = map[string]struct {
+		column *xmysql.Column
+		value  any
+		exp    any
+	}{
+		"int from CSV": {
+			column: &xmysql.Column{DataType: "int", ColumnType: "int"},
+			value:  "-42",
+			exp:    int64(-42),
+		},
+		"unsigned bigint from JSON": {
+			column: &xmysql.Column{DataType: "bigint", ColumnType: "bigint unsigned"},
+			value:  json.Number("18446744073709551615"),
+			exp:    uint64(18446744073709551615),
+		},
+		"boolean as tinyint": {
+			column: &xmysql.Column{DataType: "tinyint", ColumnType: "tinyint(1)"},
+			value:  true,
+			exp:    1,
+		},
+		"decimal from float": {
+			column: &xmysql.Column{DataType: "decimal", ColumnType: "decimal(10,2)"},
+			value:  10.5,
+			exp:    "10.5",
+		},
+		"JSON document": {
+			column: &xmysql.Column{DataType: "json", ColumnType: "json"},
+			value:  map[string]any{"capital": true},
+			exp:    `{"capital":true}`,
+		},
+		"binary": {
+			column: &xmysql.Column{DataType: "varbinary", ColumnType: "varbinary(10)"},
+			value:  "abc",
+			exp:    []byte("abc"),
+		},
+		"NULL": {
+			column: &xmysql.Column{DataType: "varchar", ColumnType: "varchar(10)"},
+			value:  nil,
+			exp:    nil,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			have, err := convertFixtureValue(c.column, c.value)
+			xt.OK(t, err)
+			xt.Eq(t, c.exp, have)
+		})
+	}
+
+	t.Run("not an integer", func(t *testing.T) {
+		_, err := convertFixtureValue(&xmysql.Column{DataType: "int", ColumnType: "int"}, 1.5)
+		xt.KO(t, err)
+	})
+}
+
+func TestFixtures_Load(t *testing.T) {
+	db := New(t, &Options{
+		Setup: func(db *sql.DB) error {
+			for _, ddl := range []string{
+				"CREATE TABLE countries (code CHAR(2) PRIMARY KEY, name VARCHAR(40))",
+				"CREATE TABLE cities (id INT PRIMARY KEY, name VARCHAR(40), country CHAR(2), " +
+					"population INT UNSIGNED, info JSON, FOREIGN KEY (country) REFERENCES countries (code))",
+				"CREATE TABLE people (id INT PRIMARY KEY, name VARCHAR(40), city_id INT, " +
+					"balance DECIMAL(10,2), FOREIGN KEY (city_id) REFERENCES cities (id))",
+			} {
+				if _, err := db.Exec(ddl); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+
+	f, err := ReadFixtures(testFixtureFS)
+	xt.OK(t, err)
+
+	ctx := context.Background()
+
+	count := func(t *testing.T, table string) int {
+		var n int
+		xt.OK(t, db.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&n))
+		return n
+	}
+
+	t.Run("load in foreign key order", func(t *testing.T) {
+		xt.OK(t, f.Load(ctx, db, nil))
+		xt.Eq(t, 2, count(t, "countries"))
+		xt.Eq(t, 2, count(t, "cities"))
+		xt.Eq(t, 2, count(t, "people"))
+
+		var balance string
+		xt.OK(t, db.QueryRow("SELECT balance FROM people WHERE id = 1").Scan(&balance))
+		xt.Eq(t, "10.50", balance)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		_, err := db.Exec("DELETE FROM people WHERE id = 2")
+		xt.OK(t, err)
+
+		xt.OK(t, f.Reset(ctx, db))
+		xt.Eq(t, 2, count(t, "people"))
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		f := NewFixtures()
+		f.Add("countries", map[string]any{"code": "FR", "capital": "Paris"})
+
+		err := f.Load(ctx, db, nil)
+		xt.KO(t, err)
+		xt.Eq(t, "xmysqltest: fixture for table countries has unknown column capital", err.Error())
+	})
+
+	t.Run("disable foreign key checks", func(t *testing.T) {
+		f := NewFixtures()
+		f.Add("people", map[string]any{"id": 3, "name": "Carol", "city_id": 99})
+
+		xt.KO(t, f.Load(ctx, db, nil))
+		xt.OK(t, f.Load(ctx, db, &FixtureOptions{DisableForeignKeyChecks: true}))
+		xt.Eq(t, 3, count(t, "people"))
+
+		// Reset keeps foreign key checks disabled
+		xt.OK(t, f.Reset(ctx, db))
+		xt.Eq(t, 1, count(t, "people"))
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+// Package xmysqltest offers helpers for tests which need a MySQL schema of their
+// own. Each test, or package, gets a uniquely named schema which is dropped when
+// done, allowing tests to run in parallel.
+package xmysqltest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xsql"
+
+	"github.com/golistic/xmysql"
+)
+
+const (
+	// DefaultDSN is used when neither Options.DSN nor the environment
+	// variable XMYSQL_DSN is set.
+	DefaultDSN = "root:mysql@tcp(127.0.0.1:13399)/?parseTime=true"
+	// DefaultPrefix is the default prefix of the names of the schemas.
+	DefaultPrefix = "xmysqltest"
+	// DefaultMaxAge is the default age after which left-over schemas are dropped.
+	DefaultMaxAge = time.Hour
+)
+
+// Options configures how schemas are created.
+type Options struct {
+	// DSN is the data source name used to connect; its schema is replaced. When
+	// empty, the environment variable XMYSQL_DSN is used, or DefaultDSN.
+	DSN string
+	// DriverName is the name of the SQL driver; defaults to "mysql".
+	DriverName string
+	// Prefix is the prefix of the schema names; defaults to DefaultPrefix.
+	Prefix string
+	// MaxAge is the age after which schemas using Prefix are considered
+	// left over from crashed runs and dropped; defaults to DefaultMaxAge.
+	MaxAge time.Duration
+	// Setup is called after the schema was created, for example, to load
+	// fixtures or run migrations.
+	Setup func(db *sql.DB) error
+}
+
+func (o *Options) withDefaults() Options {
+	r := Options{}
+	if o != nil {
+		r = *o
+	}
+
+	if r.DSN == "" {
+		r.DSN = os.Getenv("XMYSQL_DSN")
+		if r.DSN == "" {
+			r.DSN = DefaultDSN
+		}
+	}
+	if r.DriverName == "" {
+		r.DriverName = "mysql"
+	}
+	if r.Prefix == "" {
+		r.Prefix = DefaultPrefix
+	}
+	if r.MaxAge <= 0 {
+		r.MaxAge = DefaultMaxAge
+	}
+
+	return r
+}
+
+// Schema is a schema created for testing.
+type Schema struct {
+	// Name is the name of the schema.
+	Name string
+	// DSN is the data source name with its schema set to Name.
+	DSN string
+	// DB is connected using DSN.
+	DB *sql.DB
+
+	admin *sql.DB
+}
+
+// New creates a uniquely named schema and returns a connection which uses it. The
+// schema is dropped, and the connection closed, when t and its subtests complete.
+// Left-over schemas of crashed runs are dropped first (see Sweep).
+// The opts can be nil in which case defaults are used.
+func New(t testing.TB, opts *Options) *sql.DB {
+	t.Helper()
+
+	s, err := Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := s.Drop(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return s.DB
+}
+
+var swept sync.Map
+
+// Create creates a uniquely named schema and connects to it. It is the
+// counterpart of New for use outside tests, for example in TestMain to share
+// a schema within a package. The caller must call Drop when done.
+// Left-over schemas of crashed runs are dropped first (see Sweep).
+func Create(opts *Options) (*Schema, error) {
+	o := opts.withDefaults()
+
+	admin, err := sql.Open(o.DriverName, o.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, done := swept.LoadOrStore(o.Prefix, true); !done {
+		if _, err := Sweep(admin, o.Prefix, o.MaxAge); err != nil {
+			_ = admin.Close()
+			return nil, err
+		}
+	}
+
+	s := &Schema{admin: admin}
+
+	s.Name, err = schemaName(o.Prefix, time.Now())
+	if err != nil {
+		_ = admin.Close()
+		return nil, err
+	}
+
+	if err := xmysql.CreateSchema(admin, s.Name); err != nil {
+		_ = admin.Close()
+		return nil, err
+	}
+
+	if s.DSN, err = xsql.ReplaceDSNDatabase(o.DSN, s.Name); err != nil {
+		_ = s.Drop()
+		return nil, err
+	}
+
+	if s.DB, err = sql.Open(o.DriverName, s.DSN); err != nil {
+		_ = s.Drop()
+		return nil, err
+	}
+
+	if o.Setup != nil {
+		if err := o.Setup(s.DB); err != nil {
+			_ = s.Drop()
+			return nil, fmt.Errorf("xmysqltest: setting up schema %s: %w", s.Name, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Drop closes the connection to the schema, drops it, and closes the
+// administrative connection.
+func (s *Schema) Drop() error {
+	if s.DB != nil {
+		_ = s.DB.Close()
+	}
+
+	defer func() { _ = s.admin.Close() }()
+
+	return xmysql.DropSchema(s.admin, s.Name)
+}
+
+// Sweep drops schemas with names starting with prefix which were created more
+// than maxAge ago, for example, because a test run crashed. It returns the names
+// of the dropped schemas.
+//
+// MySQL schemas cannot have a comment, and therefore the time of creation is
+// stored within the name of the schema.
+func Sweep(db *sql.DB, prefix string, maxAge time.Duration) ([]string, error) {
+	q := "SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME LIKE ?"
+
+	rows, err := db.Query(q, likeEscape(prefix)+`\_%`)
+	if err != nil {
+		return nil, xmysql.NewError(err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return nil, xmysql.NewError(err)
+		}
+		names = append(names, name)
+	}
+	_ = rows.Close()
+
+	var dropped []string
+	for _, name := range names {
+		created, ok := schemaCreated(prefix, name)
+		if !ok || time.Since(created) < maxAge {
+			continue
+		}
+
+		if err := xmysql.DropSchema(db, name); err != nil {
+			if xmysql.ErrorIs(err, xmysql.ErrDBDropExists) {
+				// dropped concurrently by another run
+				continue
+			}
+			return dropped, err
+		}
+		dropped = append(dropped, name)
+	}
+
+	return dropped, nil
+}
+
+// schemaName returns a unique schema name using prefix and the time of
+// creation, for example "xmysqltest_1700000000_4f2a9c1e".
+func schemaName(prefix string, created time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s_%d_%s", prefix, created.Unix(), hex.EncodeToString(b)), nil
+}
+
+// schemaCreated returns the time of creation stored in the name of a schema
+// which was created using schemaName.
+func schemaCreated(prefix, name string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(name, prefix+"_")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	ts, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(sec, 0), true
+}
+
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2023, Geert JM Vanderkelen
+
+package xmysqltest
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golistic/xgo/xt"
+
+	"github.com/golistic/xmysql"
+
+	_ "github.com/go-sql-driver/mysql" // activate SQL driver 'mysql`
+)
+
+func TestSchemaName(t *testing.T) {
+	created := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+
+	name, err := schemaName("xmysqltest", created)
+	xt.OK(t, err)
+	xt.MatchString(t, `^xmysqltest_1700000000_[0-9a-f]{8}$`, name)
+
+	have, ok := schemaCreated("xmysqltest", name)
+	xt.Assert(t, ok)
+	xt.Eq(t, created.Unix(), have.Unix())
+
+	_, ok = schemaCreated("xmysqltest", "xmysqltest_notatime_abc")
+	xt.Assert(t, !ok)
+
+	_, ok = schemaCreated("other", name)
+	xt.Assert(t, !ok)
+}
+
+func TestNew(t *testing.T) {
+	var name string
+
+	t.Run("schema is used and dropped", func(t *testing.T) {
+		db := New(t, &Options{
+			Setup: func(db *sql.DB) error {
+				_, err := db.Exec("CREATE TABLE t1 (id INT)")
+				return err
+			},
+		})
+
+		var err error
+		name, err = xmysql.CurrentSchema(db)
+		xt.OK(t, err)
+		xt.MatchString(t, `^xmysqltest_\d+_[0-9a-f]{8}$`, name)
+
+		have, err := xmysql.TableExists(db, "t1")
+		xt.OK(t, err)
+		xt.Assert(t, have)
+	})
+
+	s, err := Create(nil)
+	xt.OK(t, err)
+	defer func() { _ = s.Drop() }()
+
+	have, err := xmysql.SchemaExists(s.admin, name)
+	xt.OK(t, err)
+	xt.Assert(t, !have, "expected schema to be dropped")
+}
+
+func TestSweep(t *testing.T) {
+	s, err := Create(nil)
+	xt.OK(t, err)
+	defer func() { _ = s.Drop() }()
+
+	prefix := "xmysqltest_sweep"
+	old := fmt.Sprintf("%s_%d_deadbeef", prefix, time.Now().Add(-2*time.Hour).Unix())
+	recent := fmt.Sprintf("%s_%d_deadbeef", prefix, time.Now().Unix())
+
+	for _, name := range []string{old, recent} {
+		_ = xmysql.DropSchema(s.admin, name)
+		xt.OK(t, xmysql.CreateSchema(s.admin, name))
+	}
+	defer func() { _ = xmysql.DropSchema(s.admin, recent) }()
+
+	dropped, err := Sweep(s.admin, prefix, time.Hour)
+	xt.OK(t, err)
+	xt.Eq(t, []string{old}, dropped)
+
+	have, err := xmysql.SchemaExists(s.admin, recent)
+	xt.OK(t, err)
+	xt.Assert(t, have)
+}